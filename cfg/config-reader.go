@@ -7,6 +7,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func ReadInitConfig(filePath string) (*StartupConfig, error) {
@@ -25,34 +26,80 @@ func ReadInitConfig(filePath string) (*StartupConfig, error) {
 }
 
 type StartupConfig struct {
-	StartupPort                   string `json:"port"`
-	NFSPath                       string `json:"nfs_path"`
-	SmbSharePath                  string `json:"smb_share_path,omitempty"`
-	BufferSize                    string `json:"buffer_size"`
-	ChunkSize                     string `json:"chunk_size"`
-	EnableChunking                bool   `json:"enable_chunking"`
-	ChunkingThreshold             string `json:"chunking_threshold"`
-	Mode                          Mode   `json:"mode"`
-	SendDockerEnabled             bool   `json:"send_docker_enabled,omitempty"`
-	SendDockerRegistry            string `json:"send_docker_registry,omitempty"`
-	SendDockerRegistryLogin       string `json:"send_docker_registry_login,omitempty"`
-	SendDockerRegistryPassword    string `json:"send_docker_registry_password,omitempty"`
-	SendNexusUrl                  string `json:"send_nexus_url,omitempty"`
-	SendNexusLogin                string `json:"send_nexus_login,omitempty"`
-	SendNexusPassword             string `json:"send_nexus_password,omitempty"`
-	SendNexusPypiRepository       string `json:"send_nexus_pypi_repository,omitempty"`
-	SendNexusHFRepository         string `json:"send_nexus_hf_repository,omitempty"`
-	ReceiveDockerEnabled          bool   `json:"receive_docker_enabled,omitempty"`
-	ReceiveDockerRegistry         string `json:"receive_docker_registry,omitempty"`
-	ReceiveDockerRegistryLogin    string `json:"receive_docker_registry_login,omitempty"`
-	ReceiveDockerRegistryPassword string `json:"receive_docker_registry_password,omitempty"`
-	ReceivePypiEnabled            bool   `json:"receive_pypi_enabled,omitempty"`
-	ReceiveHfEnabled              bool   `json:"receive_hf_enabled,omitempty"`
-	ReceiveNexusUrl               string `json:"receive_nexus_url,omitempty"`
-	ReceiveNexusLogin             string `json:"receive_nexus_login,omitempty"`
-	ReceiveNexusPassword          string `json:"receive_nexus_password,omitempty"`
-	ReceiveNexusPypiRepository    string `json:"receive_nexus_pypi_repository,omitempty"`
-	ReceiveNexusHfRepository      string `json:"receive_nexus_hf_repository,omitempty"`
+	StartupPort                   string         `json:"port"`
+	NFSPath                       string         `json:"nfs_path"`
+	SmbSharePath                  string         `json:"smb_share_path,omitempty"`
+	BufferSize                    string         `json:"buffer_size"`
+	ChunkSize                     string         `json:"chunk_size"`
+	EnableChunking                bool           `json:"enable_chunking"`
+	ChunkingThreshold             string         `json:"chunking_threshold"`
+	Mode                          Mode           `json:"mode"`
+	RetryMaxAttempts              int            `json:"retry_max_attempts,omitempty"`
+	RetryInitialBackoff           string         `json:"retry_initial_backoff,omitempty"`
+	RetryMaxBackoff               string         `json:"retry_max_backoff,omitempty"`
+	SendJobStore                  string         `json:"send_job_store,omitempty"`
+	SendJobStorePath              string         `json:"send_job_store_path,omitempty"`
+	SendQueueSize                 int            `json:"send_queue_size,omitempty"`
+	SendConcurrency               map[string]int `json:"send_concurrency,omitempty"`
+	SendDockerEnabled             bool           `json:"send_docker_enabled,omitempty"`
+	SendDockerRegistry            string         `json:"send_docker_registry,omitempty"`
+	SendDockerRegistryLogin       string         `json:"send_docker_registry_login,omitempty"`
+	SendDockerRegistryPassword    string         `json:"send_docker_registry_password,omitempty"`
+	SendDockerRegistryInsecure    bool           `json:"send_docker_registry_insecure,omitempty"`
+	SendDockerTransport           string         `json:"send_docker_transport,omitempty"`
+	SendDockerDedupEnabled        bool           `json:"send_docker_dedup_enabled,omitempty"`
+	SendNexusUrl                  string         `json:"send_nexus_url,omitempty"`
+	SendNexusLogin                string         `json:"send_nexus_login,omitempty"`
+	SendNexusPassword             string         `json:"send_nexus_password,omitempty"`
+	SendNexusPypiRepository       string         `json:"send_nexus_pypi_repository,omitempty"`
+	SendPypiPythonVersion         string         `json:"send_pypi_python_version,omitempty"`
+	SendNexusHFRepository         string         `json:"send_nexus_hf_repository,omitempty"`
+	SendNexusNpmRepository        string         `json:"send_nexus_npm_repository,omitempty"`
+	SendNexusMavenRepository      string         `json:"send_nexus_maven_repository,omitempty"`
+	SendNexusRawRepository        string         `json:"send_nexus_raw_repository,omitempty"`
+	SendNexusHelmRepository       string         `json:"send_nexus_helm_repository,omitempty"`
+	SendNexusGoRepository         string         `json:"send_nexus_go_repository,omitempty"`
+	SendNexusAptRepository        string         `json:"send_nexus_apt_repository,omitempty"`
+	SendNexusYumRepository        string         `json:"send_nexus_yum_repository,omitempty"`
+	SendNexusNugetRepository      string         `json:"send_nexus_nuget_repository,omitempty"`
+	SendNexusCondaRepository      string         `json:"send_nexus_conda_repository,omitempty"`
+	SendNexusCargoRepository      string         `json:"send_nexus_cargo_repository,omitempty"`
+	ReceiveDockerEnabled          bool           `json:"receive_docker_enabled,omitempty"`
+	ReceiveDockerRegistry         string         `json:"receive_docker_registry,omitempty"`
+	ReceiveDockerRegistryLogin    string         `json:"receive_docker_registry_login,omitempty"`
+	ReceiveDockerRegistryPassword string         `json:"receive_docker_registry_password,omitempty"`
+	ReceiveDockerRegistryInsecure bool           `json:"receive_docker_registry_insecure,omitempty"`
+	ReceiveDockerTransport        string         `json:"receive_docker_transport,omitempty"`
+	ReceiveDockerInventoryEnabled bool           `json:"receive_docker_inventory_enabled,omitempty"`
+	ReceiveDockerInventoryPeriod  string         `json:"receive_docker_inventory_period,omitempty"`
+	ReceivePypiEnabled            bool           `json:"receive_pypi_enabled,omitempty"`
+	ReceiveHfEnabled              bool           `json:"receive_hf_enabled,omitempty"`
+	ReceiveNpmEnabled             bool           `json:"receive_npm_enabled,omitempty"`
+	ReceiveMavenEnabled           bool           `json:"receive_maven_enabled,omitempty"`
+	ReceiveRawEnabled             bool           `json:"receive_raw_enabled,omitempty"`
+	ReceiveHelmEnabled            bool           `json:"receive_helm_enabled,omitempty"`
+	ReceiveGoEnabled              bool           `json:"receive_go_enabled,omitempty"`
+	ReceiveAptEnabled             bool           `json:"receive_apt_enabled,omitempty"`
+	ReceiveYumEnabled             bool           `json:"receive_yum_enabled,omitempty"`
+	ReceiveNugetEnabled           bool           `json:"receive_nuget_enabled,omitempty"`
+	ReceiveCondaEnabled           bool           `json:"receive_conda_enabled,omitempty"`
+	ReceiveCargoEnabled           bool           `json:"receive_cargo_enabled,omitempty"`
+	ReceiveNexusUrl               string         `json:"receive_nexus_url,omitempty"`
+	ReceiveNexusLogin             string         `json:"receive_nexus_login,omitempty"`
+	ReceiveNexusPassword          string         `json:"receive_nexus_password,omitempty"`
+	ReceiveNexusPypiRepository    string         `json:"receive_nexus_pypi_repository,omitempty"`
+	ReceiveNexusHfRepository      string         `json:"receive_nexus_hf_repository,omitempty"`
+	ReceiveNexusNpmRepository     string         `json:"receive_nexus_npm_repository,omitempty"`
+	ReceiveNexusMavenRepository   string         `json:"receive_nexus_maven_repository,omitempty"`
+	ReceiveNexusRawRepository     string         `json:"receive_nexus_raw_repository,omitempty"`
+	ReceiveNexusRawDirectory      string         `json:"receive_nexus_raw_directory,omitempty"`
+	ReceiveNexusHelmRepository    string         `json:"receive_nexus_helm_repository,omitempty"`
+	ReceiveNexusGoRepository      string         `json:"receive_nexus_go_repository,omitempty"`
+	ReceiveNexusAptRepository     string         `json:"receive_nexus_apt_repository,omitempty"`
+	ReceiveNexusYumRepository     string         `json:"receive_nexus_yum_repository,omitempty"`
+	ReceiveNexusNugetRepository   string         `json:"receive_nexus_nuget_repository,omitempty"`
+	ReceiveNexusCondaRepository   string         `json:"receive_nexus_conda_repository,omitempty"`
+	ReceiveNexusCargoRepository   string         `json:"receive_nexus_cargo_repository,omitempty"`
 }
 
 func (cfg *StartupConfig) RefineConfig() {
@@ -78,12 +125,87 @@ func (cfg *StartupConfig) RefineConfig() {
 			log.Fatalln("config key `receive_docker_password` must be set!")
 		}
 	}
+	cfg.SendDockerTransport = refineDockerTransport("send_docker_transport", cfg.SendDockerTransport)
+	cfg.ReceiveDockerTransport = refineDockerTransport("receive_docker_transport", cfg.ReceiveDockerTransport)
+	if cfg.Mode == CdSendMode && cfg.SendDockerDedupEnabled && cfg.SendDockerTransport != RegistryDockerTransport {
+		log.Fatalf("config key `send_docker_dedup_enabled` requires `send_docker_transport` set to '%s'\n", RegistryDockerTransport)
+	}
+	// список блобов RECEIVE читается с шары, смонтированной локально
+	if cfg.Mode == CdSendMode && cfg.SendDockerDedupEnabled && !strings.HasPrefix(strings.ToLower(cfg.NFSPath), "fs://") {
+		log.Fatalf("config key `send_docker_dedup_enabled` requires `nfs_path` to be fs:// url, but it is %s\n", cfg.NFSPath)
+	}
+	if cfg.Mode == CdReceiveMode && cfg.ReceiveDockerInventoryEnabled && cfg.ReceiveDockerTransport != RegistryDockerTransport {
+		log.Fatalf("config key `receive_docker_inventory_enabled` requires `receive_docker_transport` set to '%s'\n", RegistryDockerTransport)
+	}
 	if strings.Contains(cfg.SendNexusPassword, "#") {
 		log.Println("config key `send_nexus_password` contains '#' symbol. It is better to be escaped with `%23`.")
 		log.Println("For more details see https://github.com/jackc/pgx/issues/1285")
 	}
 
 	cfg.SendNexusUrl = strings.TrimSuffix(cfg.SendNexusUrl, "/")
+
+	if cfg.SendJobStore == "" {
+		cfg.SendJobStore = BoltJobStore
+	}
+	if cfg.SendJobStore != BoltJobStore && cfg.SendJobStore != MemoryJobStore {
+		log.Fatalf("config key `send_job_store` must be one of '%s', '%s'\n", BoltJobStore, MemoryJobStore)
+	}
+	if cfg.SendJobStorePath == "" {
+		cfg.SendJobStorePath = DEFAULT_JOB_STORE_PATH
+	}
+	if cfg.SendQueueSize <= 0 {
+		cfg.SendQueueSize = DEFAULT_QUEUE_SIZE
+	}
+}
+
+func refineDockerTransport(key string, transport string) string {
+	if transport == "" {
+		return DaemonDockerTransport
+	}
+	if transport != DaemonDockerTransport && transport != RegistryDockerTransport {
+		log.Fatalf("config key `%s` must be one of '%s', '%s'\n", key, DaemonDockerTransport, RegistryDockerTransport)
+	}
+	return transport
+}
+
+func (cfg *StartupConfig) GetRetryMaxAttempts() int {
+	if cfg.RetryMaxAttempts <= 0 {
+		return DEFAULT_RETRY_MAX_ATTEMPTS
+	}
+	return cfg.RetryMaxAttempts
+}
+
+func (cfg *StartupConfig) GetRetryInitialBackoff() time.Duration {
+	return parseDurationOrDefault(cfg.RetryInitialBackoff, DEFAULT_RETRY_INITIAL_BACKOFF)
+}
+
+func (cfg *StartupConfig) GetRetryMaxBackoff() time.Duration {
+	return parseDurationOrDefault(cfg.RetryMaxBackoff, DEFAULT_RETRY_MAX_BACKOFF)
+}
+
+// GetDockerInventoryPeriod возвращает период полного обновления списка блобов registry RECEIVE
+func (cfg *StartupConfig) GetDockerInventoryPeriod() time.Duration {
+	return parseDurationOrDefault(cfg.ReceiveDockerInventoryPeriod, DEFAULT_DOCKER_INVENTORY_PERIOD)
+}
+
+func parseDurationOrDefault(value string, defaultValue time.Duration) time.Duration {
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("failed to parse duration '%s', using default %s\n", value, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
+
+// GetConcurrency возвращает число одновременно выполняемых заданий для типа артефакта
+func (cfg *StartupConfig) GetConcurrency(artifactType string) int {
+	if concurrency, ok := cfg.SendConcurrency[artifactType]; ok && concurrency > 0 {
+		return concurrency
+	}
+	return DEFAULT_CONCURRENCY
 }
 
 func (cfg *StartupConfig) GetBufferSize() (retVal int, defaultValue bool) {
@@ -121,10 +243,28 @@ func (cfg *StartupConfig) GetBufferSize() (retVal int, defaultValue bool) {
 
 const DEFAULT_BUFFER_SIZE = 5 * 1024 * 1024
 const DEFAULT_BUFFER_SIZE_NAME = "5MB"
+const DEFAULT_JOB_STORE_PATH = "fts-cd-jobs.db"
+const DEFAULT_QUEUE_SIZE = 100
+const DEFAULT_CONCURRENCY = 2
+const DEFAULT_RETRY_MAX_ATTEMPTS = 3
+const DEFAULT_RETRY_INITIAL_BACKOFF = 2 * time.Second
+const DEFAULT_RETRY_MAX_BACKOFF = time.Minute
+const DEFAULT_DOCKER_INVENTORY_PERIOD = time.Hour
+
+const (
+	BoltJobStore   = "bolt"
+	MemoryJobStore = "memory"
+)
+
+// Способ скачивания и загрузки docker образов: через docker daemon или напрямую через API registry
+const (
+	DaemonDockerTransport   = "daemon"
+	RegistryDockerTransport = "registry"
+)
 
 type Mode string
 
 const (
 	CdSendMode    Mode = "SEND"
 	CdReceiveMode Mode = "RECEIVE"
-)
\ No newline at end of file
+)
@@ -0,0 +1,64 @@
+package common
+
+import (
+	"context"
+	"strings"
+)
+
+const AptAnyArchitecture = "all"
+
+// AptArtifact - .deb пакет из apt-репозитория Nexus.
+// Version - версия пакета (по умолчанию последняя), Architecture - например amd64 (по умолчанию любая)
+type AptArtifact struct {
+	PackageName  string
+	Version      string
+	Architecture string
+}
+
+func (a AptArtifact) GetType() ArtifactType {
+	return APT
+}
+
+func (a AptArtifact) GetOriginalResourceName() string {
+	return a.query().resourceName()
+}
+
+func (a AptArtifact) GetArtifactNameAndStream(ctx context.Context) (ArtifactNameAndStream, error) {
+	return a.GetArtifactNameAndStreamFrom(ctx, 0, "")
+}
+
+func (a AptArtifact) GetArtifactNameAndStreamFrom(ctx context.Context, offset int64, validator string) (ArtifactNameAndStream, error) {
+	return openOsPackage(ctx, a.query(), offset, validator)
+}
+
+func (a AptArtifact) query() osPackageQuery {
+	return osPackageQuery{
+		kind:              "apt",
+		repository:        StartupConfig.SendNexusAptRepository,
+		name:              a.PackageName,
+		version:           a.Version,
+		architecture:      a.Architecture,
+		assetArchitecture: GetDebArchitecture,
+		anyArchitecture:   AptAnyArchitecture,
+	}
+}
+
+// GetDebArchitecture возвращает архитектуру из имени файла вида <name>_<version>_<arch>.deb
+func GetDebArchitecture(fileName string) string {
+	if !strings.HasSuffix(fileName, ".deb") {
+		return ""
+	}
+	parts := strings.Split(strings.TrimSuffix(fileName, ".deb"), "_")
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[len(parts)-1]
+}
+
+func (a AptArtifact) DeliverCleanup() error {
+	return nil
+}
+
+func (a AptArtifact) DeployCleanup() error {
+	return nil
+}
@@ -0,0 +1,155 @@
+package common
+
+import (
+	"fmt"
+	"github.com/hirochachacha/go-smb2"
+	"strings"
+)
+
+// JobRequest - тело запроса на запуск задания. Проверяет поля и строит по ним артефакт,
+// скачиванием которого на стороне SEND занимается сам артефакт (GetArtifactNameAndStream)
+type JobRequest interface {
+	ToArtifact() (Artifact, error)
+}
+
+// JobRequestError - некорректное тело запроса на запуск задания, возвращается клиенту с кодом 400
+type JobRequestError struct {
+	Message string
+}
+
+func (e *JobRequestError) Error() string {
+	return e.Message
+}
+
+// ArtifactPublisher - загрузка артефакта с шары в целевой репозиторий на стороне RECEIVE.
+// Пакет common не зависит от deploy, поэтому загрузку добавляет в реестр пакет deploy через RegisterArtifactPublisher
+type ArtifactPublisher struct {
+	// Description - название артефакта в логах
+	Description string
+	// Toggle - feature-toggle в конфигурации, Enabled возвращает его значение
+	Toggle  string
+	Enabled func() bool
+	// Publish загружает файл filePath и возвращает адрес и digest загруженного артефакта.
+	// jobStatus.Artifact - указатель на артефакт, созданный NewArtifact
+	Publish func(fs *smb2.Share, filePath string, jobStatus *JobStatus) (string, string, error)
+}
+
+// ArtifactTypeDefinition - описание типа артефакта. По реестру типов строятся эндпоинты запуска заданий,
+// восстанавливаются артефакты из .job файлов и выбирается загрузка на стороне RECEIVE
+type ArtifactTypeDefinition struct {
+	Type ArtifactType
+	// Name - имя типа в путях /cd-start/:type и /cd-<name>-start
+	Name string
+	// NewArtifact возвращает пустой артефакт, в который десериализуется поле `artifact` из JobStatus
+	NewArtifact func() Artifact
+	// NewJob возвращает пустое тело запроса на запуск задания
+	NewJob func() JobRequest
+	// SendEnabled - можно ли запускать задания этого типа на стороне SEND. nil - всегда
+	SendEnabled func() bool
+	// Publisher - загрузка на стороне RECEIVE, nil до вызова RegisterArtifactPublisher
+	Publisher *ArtifactPublisher
+}
+
+func (d ArtifactTypeDefinition) IsSendEnabled() bool {
+	return d.SendEnabled == nil || d.SendEnabled()
+}
+
+var artifactTypeDefinitions = []ArtifactTypeDefinition{
+	{Type: DOCKER, Name: "docker",
+		NewArtifact: func() Artifact { return &DockerArtifact{} },
+		NewJob:      func() JobRequest { return &Job{} },
+		SendEnabled: func() bool { return StartupConfig.SendDockerEnabled }},
+	{Type: PYPI, Name: "pypi",
+		NewArtifact: func() Artifact { return &PypiArtifact{} },
+		NewJob:      func() JobRequest { return &PypiJob{} }},
+	{Type: HF, Name: "hf",
+		NewArtifact: func() Artifact { return &HfArtifact{} },
+		NewJob:      func() JobRequest { return &HfJob{} }},
+	{Type: NPM, Name: "npm",
+		NewArtifact: func() Artifact { return &NpmArtifact{} },
+		NewJob:      func() JobRequest { return &NpmJob{} }},
+	{Type: MAVEN, Name: "maven",
+		NewArtifact: func() Artifact { return &MavenArtifact{} },
+		NewJob:      func() JobRequest { return &MavenJob{} }},
+	{Type: RAW, Name: "raw",
+		NewArtifact: func() Artifact { return &HttpArtifact{} },
+		NewJob:      func() JobRequest { return &RawJob{} }},
+	{Type: HELM, Name: "helm",
+		NewArtifact: func() Artifact { return &HelmArtifact{} },
+		NewJob:      func() JobRequest { return &HelmJob{} }},
+	{Type: GO, Name: "go",
+		NewArtifact: func() Artifact { return &GoModuleArtifact{} },
+		NewJob:      func() JobRequest { return &GoModuleJob{} }},
+	{Type: APT, Name: "apt",
+		NewArtifact: func() Artifact { return &AptArtifact{} },
+		NewJob:      func() JobRequest { return &AptJob{} }},
+	{Type: YUM, Name: "yum",
+		NewArtifact: func() Artifact { return &YumArtifact{} },
+		NewJob:      func() JobRequest { return &YumJob{} }},
+	{Type: NUGET, Name: "nuget",
+		NewArtifact: func() Artifact { return &NugetArtifact{} },
+		NewJob:      func() JobRequest { return &NugetJob{} }},
+	{Type: CONDA, Name: "conda",
+		NewArtifact: func() Artifact { return &CondaArtifact{} },
+		NewJob:      func() JobRequest { return &CondaJob{} }},
+	{Type: CARGO, Name: "cargo",
+		NewArtifact: func() Artifact { return &CargoArtifact{} },
+		NewJob:      func() JobRequest { return &CargoJob{} }},
+}
+
+// RegisterArtifactType добавляет тип артефакта в реестр. Должна вызываться до запуска приложения
+func RegisterArtifactType(definition ArtifactTypeDefinition) error {
+	if definition.Type == "" || definition.Name == "" || definition.NewArtifact == nil || definition.NewJob == nil {
+		return fmt.Errorf("artifact type definition %+v is incomplete", definition)
+	}
+	for _, registered := range artifactTypeDefinitions {
+		if registered.Type == definition.Type || strings.EqualFold(registered.Name, definition.Name) {
+			return fmt.Errorf("artifact type '%s' (%s) is already registered", definition.Type, definition.Name)
+		}
+	}
+	artifactTypeDefinitions = append(artifactTypeDefinitions, definition)
+	return nil
+}
+
+// RegisterArtifactPublisher добавляет к зарегистрированному типу загрузку на стороне RECEIVE.
+// Должна вызываться до запуска приложения
+func RegisterArtifactPublisher(artifactType ArtifactType, publisher ArtifactPublisher) error {
+	if publisher.Description == "" || publisher.Enabled == nil || publisher.Publish == nil {
+		return fmt.Errorf("publisher %+v of artifact type '%s' is incomplete", publisher, artifactType)
+	}
+	for i := range artifactTypeDefinitions {
+		if artifactTypeDefinitions[i].Type != artifactType {
+			continue
+		}
+		if artifactTypeDefinitions[i].Publisher != nil {
+			return fmt.Errorf("publisher of artifact type '%s' is already registered", artifactType)
+		}
+		artifactTypeDefinitions[i].Publisher = &publisher
+		return nil
+	}
+	return fmt.Errorf("artifact type '%s' is not registered", artifactType)
+}
+
+// GetArtifactTypeDefinitions возвращает все зарегистрированные типы в порядке регистрации
+func GetArtifactTypeDefinitions() []ArtifactTypeDefinition {
+	return append([]ArtifactTypeDefinition(nil), artifactTypeDefinitions...)
+}
+
+func GetArtifactTypeDefinition(artifactType ArtifactType) (ArtifactTypeDefinition, bool) {
+	for _, definition := range artifactTypeDefinitions {
+		if definition.Type == artifactType {
+			return definition, true
+		}
+	}
+	return ArtifactTypeDefinition{}, false
+}
+
+// FindArtifactTypeByName ищет тип по имени из пути запроса, без учёта регистра
+func FindArtifactTypeByName(name string) (ArtifactTypeDefinition, bool) {
+	for _, definition := range artifactTypeDefinitions {
+		if strings.EqualFold(definition.Name, name) {
+			return definition, true
+		}
+	}
+	return ArtifactTypeDefinition{}, false
+}
@@ -0,0 +1,28 @@
+package common
+
+import (
+	"github.com/hirochachacha/go-smb2"
+	"testing"
+)
+
+func TestRegisterArtifactTypeRejectsInvalidDefinitions(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition ArtifactTypeDefinition
+	}{
+		{"incomplete", ArtifactTypeDefinition{Type: "TEST", Name: "test"}},
+		{"duplicate type", ArtifactTypeDefinition{Type: RAW, Name: "test",
+			NewArtifact: func() Artifact { return &HttpArtifact{} }, NewJob: func() JobRequest { return &RawJob{} }}},
+		{"duplicate name", ArtifactTypeDefinition{Type: "TEST", Name: "RAW",
+			NewArtifact: func() Artifact { return &HttpArtifact{} }, NewJob: func() JobRequest { return &RawJob{} }}},
+	}
+	for _, test := range tests {
+		if err := RegisterArtifactType(test.definition); err == nil {
+			t.Errorf("%s: definition is registered", test.name)
+		}
+	}
+	if err := RegisterArtifactPublisher("TEST", ArtifactPublisher{Description: "test", Enabled: func() bool { return true },
+		Publish: func(*smb2.Share, string, *JobStatus) (string, string, error) { return "", "", nil }}); err == nil {
+		t.Error("publisher of unknown type is registered")
+	}
+}
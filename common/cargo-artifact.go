@@ -0,0 +1,165 @@
+package common
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CargoMetaIndex - строка из sparse index исходного реестра с зависимостями и features версии крейта,
+// нужна для публикации крейта на стороне RECEIVE
+const CargoMetaIndex = "index"
+
+// CargoArtifact - .crate архив из cargo-репозитория Nexus. Version - по умолчанию последняя
+type CargoArtifact struct {
+	CrateName string
+	Version   string
+}
+
+func (a CargoArtifact) GetType() ArtifactType {
+	return CARGO
+}
+
+func (a CargoArtifact) GetOriginalResourceName() string {
+	if a.Version != "" {
+		return a.CrateName + " " + a.Version
+	}
+	return a.CrateName
+}
+
+func (a CargoArtifact) GetArtifactNameAndStream(ctx context.Context) (ArtifactNameAndStream, error) {
+	return a.GetArtifactNameAndStreamFrom(ctx, 0, "")
+}
+
+func (a CargoArtifact) GetArtifactNameAndStreamFrom(ctx context.Context, offset int64, validator string) (ArtifactNameAndStream, error) {
+	params := url.Values{}
+	params.Set("repository", StartupConfig.SendNexusCargoRepository)
+	params.Set("name", a.CrateName)
+	if a.Version != "" {
+		params.Set("version", a.Version)
+	}
+	params.Set("sort", "version")
+	params.Set("direction", "desc")
+	searchResponse, err := SearchNexus(ctx, params)
+	if err != nil {
+		return ArtifactNameAndStream{}, err
+	}
+	for _, item := range searchResponse.Items {
+		for _, asset := range item.Assets {
+			// крейт лежит в репозитории как .crate или по пути api/v1/crates/<name>/<version>/download
+			if !strings.HasSuffix(asset.Path, ".crate") && !strings.HasSuffix(asset.Path, "/download") {
+				continue
+			}
+			artifactNameAndStream, err := OpenNexusAsset(ctx, asset, offset, validator)
+			if err != nil {
+				return ArtifactNameAndStream{}, err
+			}
+			artifactNameAndStream.Name = item.Name + "-" + item.Version + ".crate"
+			artifactNameAndStream.Metadata = map[string]string{
+				PackageMetaName:    item.Name,
+				PackageMetaVersion: item.Version,
+				PackageMetaPath:    asset.Path,
+			}
+			if sha256, found := asset.Checksum["sha256"]; found {
+				artifactNameAndStream.Metadata[PackageMetaSha256] = sha256
+			}
+			if entry, err := getCargoIndexEntry(ctx, item.Name, item.Version); err == nil {
+				artifactNameAndStream.Metadata[CargoMetaIndex] = string(entry)
+			} else {
+				log.Printf("failed to get index entry of crate %s %s, it will be published without dependencies: %v\n", item.Name, item.Version, err)
+			}
+			return artifactNameAndStream, nil
+		}
+	}
+	msg := fmt.Sprintf("crate %s not found in Nexus", a.GetOriginalResourceName())
+	log.Println(msg)
+	return ArtifactNameAndStream{}, &ArtifactNotFoundError{Message: msg}
+}
+
+// CargoIndexEntry - строка sparse index: одна версия крейта
+type CargoIndexEntry struct {
+	Name     string              `json:"name"`
+	Vers     string              `json:"vers"`
+	Deps     []CargoIndexDep     `json:"deps"`
+	Cksum    string              `json:"cksum"`
+	Features map[string][]string `json:"features"`
+	// features с синтаксисом dep: и ?, вынесенные отдельно для старых версий cargo
+	Features2   map[string][]string `json:"features2,omitempty"`
+	Yanked      bool                `json:"yanked"`
+	Links       string              `json:"links,omitempty"`
+	RustVersion string              `json:"rust_version,omitempty"`
+}
+
+type CargoIndexDep struct {
+	Name            string   `json:"name"`
+	Req             string   `json:"req"`
+	Features        []string `json:"features"`
+	Optional        bool     `json:"optional"`
+	DefaultFeatures bool     `json:"default_features"`
+	Target          string   `json:"target,omitempty"`
+	Kind            string   `json:"kind,omitempty"`
+	Registry        string   `json:"registry,omitempty"`
+	// Настоящее имя крейта, если зависимость переименована в Cargo.toml
+	Package string `json:"package,omitempty"`
+}
+
+// GetCargoIndexPath возвращает путь файла крейта в индексе реестра: 1/a, 2/ab, 3/a/abc, ab/cd/abcd...
+func GetCargoIndexPath(name string) string {
+	name = strings.ToLower(name)
+	switch len(name) {
+	case 1:
+		return "1/" + name
+	case 2:
+		return "2/" + name
+	case 3:
+		return "3/" + name[:1] + "/" + name
+	}
+	return name[:2] + "/" + name[2:4] + "/" + name
+}
+
+// getCargoIndexEntry возвращает строку sparse index репозитория SEND для версии крейта
+func getCargoIndexEntry(ctx context.Context, name, version string) ([]byte, error) {
+	indexUrl := fmt.Sprintf("%s/repository/%s/index/%s", StartupConfig.SendNexusUrl,
+		strings.Trim(StartupConfig.SendNexusCargoRepository, "/"), GetCargoIndexPath(name))
+	req, err := http.NewRequestWithContext(ctx, "GET", indexUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(StartupConfig.SendNexusLogin, StartupConfig.SendNexusPassword)
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HttpStatusError{Url: indexUrl, StatusCode: resp.StatusCode}
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry CargoIndexEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if entry.Vers == version {
+			return append([]byte(nil), scanner.Bytes()...), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("version %s is not listed in %s", version, indexUrl)
+}
+
+func (a CargoArtifact) DeliverCleanup() error {
+	return nil
+}
+
+func (a CargoArtifact) DeployCleanup() error {
+	return nil
+}
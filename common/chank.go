@@ -242,7 +242,7 @@ func MergeChunks(manifestPath, targetDir string) (string, error) {
 		if err != nil {
 			log.Printf("Warning: Failed to calculate SHA256 hash for merged file: %v", err)
 		} else if calculatedSHA256 != manifest.SHA256Hash {
-			return "", fmt.Errorf("SHA256 hash mismatch for merged file: expected %s, got %s", 
+			return "", fmt.Errorf("%w: SHA256 hash mismatch for merged file: expected %s, got %s", ErrChecksumMismatch,
 				manifest.SHA256Hash, calculatedSHA256)
 		} else {
 			log.Printf("SHA256 hash verification successful for %s", outputPath)
@@ -93,6 +93,11 @@ func GetJobMetaFileName(jobId string) string {
 	return jobId + ".job"
 }
 
+// GetJobCancelFileName возвращает имя файла-маркера отмены задания на шаре
+func GetJobCancelFileName(jobId string) string {
+	return jobId + ".cancel"
+}
+
 func GetDownloadFileNameFromUrl(urlPath string) (string, error) {
 	downloadUrl, err := url.Parse(urlPath)
 	if err != nil {
@@ -103,3 +108,8 @@ func GetDownloadFileNameFromUrl(urlPath string) (string, error) {
 	fileName := pathParts[len(pathParts)-1]
 	return fileName, nil
 }
+
+// GetJobAckFileName возвращает имя файла подтверждения загрузки, который RECEIVE кладёт на шару
+func GetJobAckFileName(jobId string) string {
+	return jobId + ".ack"
+}
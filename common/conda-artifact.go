@@ -0,0 +1,184 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const CondaNoarchSubdir = "noarch"
+
+// Ключи метаданных conda пакетов в .job файле, вместе с PackageMeta*
+const (
+	CondaMetaSubdir = "subdir"
+	CondaMetaBuild  = "build"
+	// Запись пакета из repodata.json исходного канала, нужна для индекса канала на стороне RECEIVE
+	CondaMetaRepodata = "repodata"
+)
+
+// CondaArtifact - conda пакет (.conda или .tar.bz2) из conda-репозитория Nexus.
+// Version - по умолчанию последняя, Build - строка сборки, например py311h64a7726_0 (по умолчанию любая),
+// Subdir - платформа канала, например linux-64 (по умолчанию любая). Пакеты noarch подходят для любой платформы
+type CondaArtifact struct {
+	PackageName string
+	Version     string
+	Build       string
+	Subdir      string
+}
+
+func (a CondaArtifact) GetType() ArtifactType {
+	return CONDA
+}
+
+func (a CondaArtifact) GetOriginalResourceName() string {
+	name := a.PackageName
+	if a.Version != "" {
+		name += " " + a.Version
+		if a.Build != "" {
+			name += " " + a.Build
+		}
+	}
+	if a.Subdir != "" {
+		name += " (" + a.Subdir + ")"
+	}
+	return name
+}
+
+func (a CondaArtifact) GetArtifactNameAndStream(ctx context.Context) (ArtifactNameAndStream, error) {
+	return a.GetArtifactNameAndStreamFrom(ctx, 0, "")
+}
+
+func (a CondaArtifact) GetArtifactNameAndStreamFrom(ctx context.Context, offset int64, validator string) (ArtifactNameAndStream, error) {
+	params := url.Values{}
+	params.Set("repository", StartupConfig.SendNexusCondaRepository)
+	params.Set("name", a.PackageName)
+	if a.Version != "" {
+		params.Set("version", a.Version)
+	}
+	params.Set("sort", "version")
+	params.Set("direction", "desc")
+	searchResponse, err := SearchNexus(ctx, params)
+	if err != nil {
+		return ArtifactNameAndStream{}, err
+	}
+	for _, item := range searchResponse.Items {
+		asset, build, found := a.selectAsset(item)
+		if !found {
+			continue
+		}
+		artifactNameAndStream, err := OpenNexusAsset(ctx, asset, offset, validator)
+		if err != nil {
+			return ArtifactNameAndStream{}, err
+		}
+		artifactNameAndStream.Metadata = map[string]string{
+			PackageMetaName:    item.Name,
+			PackageMetaVersion: item.Version,
+			PackageMetaPath:    asset.Path,
+			CondaMetaSubdir:    GetCondaSubdir(asset.Path),
+			CondaMetaBuild:     build,
+		}
+		if sha256, found := asset.Checksum["sha256"]; found {
+			artifactNameAndStream.Metadata[PackageMetaSha256] = sha256
+		}
+		if entry, err := getCondaRepodataEntry(ctx, asset.Path); err == nil {
+			artifactNameAndStream.Metadata[CondaMetaRepodata] = string(entry)
+		} else {
+			log.Printf("failed to get repodata.json entry of %s, RECEIVE will index the package itself: %v\n", asset.Path, err)
+		}
+		return artifactNameAndStream, nil
+	}
+	msg := fmt.Sprintf("conda package %s not found in Nexus", a.GetOriginalResourceName())
+	log.Println(msg)
+	return ArtifactNameAndStream{}, &ArtifactNotFoundError{Message: msg}
+}
+
+// selectAsset выбирает пакет подходящей сборки и платформы. Формат .conda предпочтительнее .tar.bz2
+func (a CondaArtifact) selectAsset(item NexusItem) (NexusItemAsset, string, bool) {
+	var selected NexusItemAsset
+	var selectedBuild string
+	found := false
+	for _, asset := range item.Assets {
+		fileName := path.Base(asset.Path)
+		build, ok := GetCondaBuild(fileName, item.Name, item.Version)
+		if !ok || (a.Build != "" && build != a.Build) {
+			continue
+		}
+		subdir := GetCondaSubdir(asset.Path)
+		if a.Subdir != "" && subdir != a.Subdir && subdir != CondaNoarchSubdir {
+			continue
+		}
+		if !found || (strings.HasSuffix(fileName, ".conda") && !strings.HasSuffix(selected.Path, ".conda")) {
+			selected, selectedBuild, found = asset, build, true
+		}
+	}
+	return selected, selectedBuild, found
+}
+
+// GetCondaBuild возвращает строку сборки из имени файла <name>-<version>-<build>.conda или .tar.bz2
+func GetCondaBuild(fileName, name, version string) (string, bool) {
+	baseName, found := strings.CutSuffix(fileName, ".conda")
+	if !found {
+		if baseName, found = strings.CutSuffix(fileName, ".tar.bz2"); !found {
+			return "", false
+		}
+	}
+	return strings.CutPrefix(baseName, name+"-"+version+"-")
+}
+
+// GetCondaSubdir возвращает платформу канала - каталог, в котором лежит пакет, например linux-64
+func GetCondaSubdir(assetPath string) string {
+	return path.Base(path.Dir("/" + strings.TrimPrefix(assetPath, "/")))
+}
+
+// CondaRepodata - repodata.json канала conda. Записи пакетов хранятся как есть, чтобы не потерять поля
+type CondaRepodata struct {
+	Info            map[string]interface{}     `json:"info,omitempty"`
+	Packages        map[string]json.RawMessage `json:"packages"`
+	PackagesConda   map[string]json.RawMessage `json:"packages.conda"`
+	Removed         []string                   `json:"removed,omitempty"`
+	RepodataVersion int                        `json:"repodata_version"`
+}
+
+// getCondaRepodataEntry возвращает запись пакета из repodata.json того же каталога репозитория SEND
+func getCondaRepodataEntry(ctx context.Context, assetPath string) (json.RawMessage, error) {
+	repodataUrl := fmt.Sprintf("%s/repository/%s/%s/repodata.json", StartupConfig.SendNexusUrl,
+		strings.Trim(StartupConfig.SendNexusCondaRepository, "/"), strings.Trim(path.Dir("/"+strings.TrimPrefix(assetPath, "/")), "/"))
+	req, err := http.NewRequestWithContext(ctx, "GET", repodataUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(StartupConfig.SendNexusLogin, StartupConfig.SendNexusPassword)
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HttpStatusError{Url: repodataUrl, StatusCode: resp.StatusCode}
+	}
+	var repodata CondaRepodata
+	if err := json.NewDecoder(resp.Body).Decode(&repodata); err != nil {
+		return nil, err
+	}
+	fileName := path.Base(assetPath)
+	if entry, found := repodata.PackagesConda[fileName]; found {
+		return entry, nil
+	}
+	if entry, found := repodata.Packages[fileName]; found {
+		return entry, nil
+	}
+	return nil, fmt.Errorf("%s is not listed in %s", fileName, repodataUrl)
+}
+
+func (a CondaArtifact) DeliverCleanup() error {
+	return nil
+}
+
+func (a CondaArtifact) DeployCleanup() error {
+	return nil
+}
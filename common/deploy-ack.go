@@ -0,0 +1,27 @@
+package common
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrChecksumMismatch - хеш-сумма артефакта на шаре не совпала с хеш-суммой, посчитанной SEND
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// DeployAck - подтверждение загрузки артефакта в целевой репозиторий.
+// RECEIVE кладёт его на шару в файл <jobId>.ack, SEND по нему проставляет статус DEPLOYED, DEPLOY_FAILED или CANCELLED
+type DeployAck struct {
+	JobId  string   `json:"jobId"`
+	Result CdStatus `json:"result"`
+	// Куда загружен артефакт: образ с digest, url ассета в Nexus или url репозитория
+	Location string `json:"location,omitempty"`
+	// Digest загруженного docker образа
+	Digest string `json:"digest,omitempty"`
+	// sha256 артефакта, проверенная при загрузке
+	Checksum         string       `json:"checksum,omitempty"`
+	ChecksumVerified bool         `json:"checksumVerified"`
+	ErrorCode        JobErrorCode `json:"errorCode,omitempty"`
+	ErrorMessage     string       `json:"errorMessage,omitempty"`
+	Attempts         int          `json:"attempts,omitempty"`
+	Dttm             time.Time    `json:"dttm"`
+}
@@ -0,0 +1,418 @@
+package common
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"runtime"
+	"strings"
+)
+
+// Архив образа без docker daemon - OCI image layout, который также понимает `docker load`:
+// oci-layout, index.json, manifest.json (формат docker save) и blobs/sha256/<hex>.
+// index.json и манифесты пишутся в начало архива, чтобы при чтении они были известны раньше слоёв
+
+const (
+	OciLayoutFileName      = "oci-layout"
+	OciIndexFileName       = "index.json"
+	DockerManifestFileName = "manifest.json"
+
+	OciImageNameAnnotation = "io.containerd.image.name"
+	OciRefNameAnnotation   = "org.opencontainers.image.ref.name"
+	// attestationReferenceAnnotation - digest образа, к которому относится манифест аттестации buildx
+	attestationReferenceAnnotation = "vnd.docker.reference.digest"
+	// attestationTypeAnnotation - тип манифеста аттестации buildx в индексе
+	attestationTypeAnnotation = "vnd.docker.reference.type"
+)
+
+// DockerArchiveManifest - запись manifest.json в формате docker save
+type DockerArchiveManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// OciBlobPath возвращает путь блоба в OCI layout: blobs/<алгоритм>/<hex>
+func OciBlobPath(digest string) string {
+	return "blobs/" + strings.Replace(digest, ":", "/", 1)
+}
+
+// imageArchive - образ, скачиваемый из registry: манифесты с содержимым и блобы (конфигурации и слои)
+type imageArchive struct {
+	imageName string
+	ref       ImageReference
+	client    *RegistryClient
+	// root - манифест, на который указывает index.json
+	root      OciDescriptor
+	manifests []imageArchiveManifest
+	blobs     []OciDescriptor
+	// inventory - блобы registry RECEIVE, слои из него не пишутся в архив и попадают в external
+	inventory *DockerBlobInventory
+	external  []ExternalBlob
+}
+
+type imageArchiveManifest struct {
+	descriptor OciDescriptor
+	content    []byte
+	manifest   OciManifest
+}
+
+// openRegistryImageArchive скачивает образ из registry SEND напрямую через distribution API
+// и возвращает поток архива. Если по тегу лежит индекс, без platforms берётся образ под платформу linux/<архитектура приложения>,
+// иначе переносится индекс с образами запрошенных платформ
+func openRegistryImageArchive(ctx context.Context, imageName string, platforms []string, dedup bool) (io.ReadCloser, error) {
+	ref := ParseImageReference(StartupConfig.SendDockerRegistry, imageName)
+	archive := &imageArchive{
+		imageName: imageName,
+		ref:       ref,
+		client:    NewRegistryClient(ref.Registry, StartupConfig.SendDockerRegistryLogin, StartupConfig.SendDockerRegistryPassword, StartupConfig.SendDockerRegistryInsecure),
+	}
+	if dedup {
+		inventory, err := ReadDockerBlobInventory()
+		if err != nil {
+			log.Println("failed to read docker blob inventory, all layers will be sent", err)
+		}
+		archive.inventory = inventory
+	}
+	log.Println("starting to pull image", ref.String(), "from registry")
+	content, descriptor, err := archive.client.GetManifest(ctx, ref.Repository, ref.Reference())
+	if err != nil {
+		log.Println("failed to get manifest of image", ref.String(), err)
+		return nil, err
+	}
+	if IsImageIndex(descriptor.MediaType) && len(platforms) > 0 {
+		if descriptor, err = archive.addIndex(ctx, descriptor, content, platforms); err != nil {
+			return nil, err
+		}
+	} else {
+		if IsImageIndex(descriptor.MediaType) {
+			if content, descriptor, err = archive.selectPlatform(ctx, content, defaultPlatform()); err != nil {
+				return nil, err
+			}
+		} else if len(platforms) > 0 {
+			log.Printf("image %s is not multi-platform, platforms %v are ignored\n", ref.String(), platforms)
+		}
+		if err := archive.addManifest(descriptor, content); err != nil {
+			return nil, err
+		}
+	}
+	archive.root = descriptor
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(archive.write(ctx, writer))
+	}()
+	return reader, nil
+}
+
+func defaultPlatform() OciPlatform {
+	return OciPlatform{OS: "linux", Architecture: runtime.GOARCH}
+}
+
+// addIndex добавляет в архив индекс и образы выбранных платформ. Для всех платформ индекс переносится без изменений
+// и сохраняет digest, для части платформ из индекса убираются остальные манифесты и digest меняется
+func (a *imageArchive) addIndex(ctx context.Context, descriptor OciDescriptor, content []byte, platforms []string) (OciDescriptor, error) {
+	var index OciManifest
+	if err := json.Unmarshal(content, &index); err != nil {
+		return OciDescriptor{}, err
+	}
+	selected := index.Manifests
+	if platforms[0] != AllPlatforms {
+		var err error
+		if selected, err = a.selectManifests(index.Manifests, platforms); err != nil {
+			return OciDescriptor{}, err
+		}
+	}
+	if len(selected) != len(index.Manifests) {
+		var err error
+		if content, err = filterIndexManifests(content, selected); err != nil {
+			return OciDescriptor{}, err
+		}
+		originalDigest := descriptor.Digest
+		descriptor.Digest = fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+		descriptor.Size = int64(len(content))
+		log.Printf("image %s: index %s reduced to %d of %d manifests, new index digest %s\n", a.ref.String(), originalDigest, len(selected), len(index.Manifests), descriptor.Digest)
+	}
+	if err := a.addManifest(descriptor, content); err != nil {
+		return OciDescriptor{}, err
+	}
+	for _, child := range selected {
+		childContent, _, err := a.client.GetManifest(ctx, a.ref.Repository, child.Digest)
+		if err != nil {
+			return OciDescriptor{}, err
+		}
+		if err := a.addManifest(child, childContent); err != nil {
+			return OciDescriptor{}, err
+		}
+	}
+	return descriptor, nil
+}
+
+// selectManifests выбирает из индекса манифесты запрошенных платформ и ссылающиеся на них аттестации buildx
+func (a *imageArchive) selectManifests(manifests []OciDescriptor, platforms []string) ([]OciDescriptor, error) {
+	selected := map[string]bool{}
+	for _, value := range platforms {
+		platform, err := ParseOciPlatform(value)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, descriptor := range manifests {
+			if descriptor.Platform != nil && descriptor.Platform.Matches(platform) {
+				selected[descriptor.Digest], found = true, true
+			}
+		}
+		if !found {
+			return nil, &ArtifactNotFoundError{Message: fmt.Sprintf("image %s has no manifest for platform %s", a.ref.String(), value)}
+		}
+	}
+	var result []OciDescriptor
+	for _, descriptor := range manifests {
+		if selected[descriptor.Digest] || selected[descriptor.Annotations[attestationReferenceAnnotation]] {
+			result = append(result, descriptor)
+		}
+	}
+	return result, nil
+}
+
+// filterIndexManifests оставляет в индексе только выбранные манифесты, остальные поля индекса не меняются
+func filterIndexManifests(content []byte, manifests []OciDescriptor) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return nil, err
+	}
+	manifestsContent, err := json.Marshal(manifests)
+	if err != nil {
+		return nil, err
+	}
+	fields["manifests"] = manifestsContent
+	return json.Marshal(fields)
+}
+
+// selectPlatform выбирает из индекса манифест образа под платформу и скачивает его
+func (a *imageArchive) selectPlatform(ctx context.Context, indexContent []byte, platform OciPlatform) ([]byte, OciDescriptor, error) {
+	var index OciManifest
+	if err := json.Unmarshal(indexContent, &index); err != nil {
+		return nil, OciDescriptor{}, err
+	}
+	for _, descriptor := range index.Manifests {
+		if descriptor.Platform == nil || descriptor.Platform.OS != platform.OS || descriptor.Platform.Architecture != platform.Architecture {
+			continue
+		}
+		if platform.Variant != "" && descriptor.Platform.Variant != platform.Variant {
+			continue
+		}
+		log.Printf("image %s: using manifest %s for platform %s/%s\n", a.ref.String(), descriptor.Digest, platform.OS, platform.Architecture)
+		content, manifestDescriptor, err := a.client.GetManifest(ctx, a.ref.Repository, descriptor.Digest)
+		manifestDescriptor.Platform = descriptor.Platform
+		return content, manifestDescriptor, err
+	}
+	return nil, OciDescriptor{}, &ArtifactNotFoundError{Message: fmt.Sprintf("image %s has no manifest for platform %s/%s", a.ref.String(), platform.OS, platform.Architecture)}
+}
+
+// addManifest запоминает манифест образа и его блобы. Одинаковые блобы скачиваются один раз.
+// Слои, которые уже есть в registry RECEIVE, не скачиваются. Конфигурация пишется всегда, она небольшая
+func (a *imageArchive) addManifest(descriptor OciDescriptor, content []byte) error {
+	var manifest OciManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return err
+	}
+	if !IsImageIndex(descriptor.MediaType) {
+		if manifest.Config == nil {
+			return fmt.Errorf("manifest %s of image %s has no config", descriptor.Digest, a.ref.String())
+		}
+		for i, blob := range append([]OciDescriptor{*manifest.Config}, manifest.Layers...) {
+			if a.hasBlob(blob.Digest) {
+				continue
+			}
+			if repository := a.receiveRepository(blob.Digest); i > 0 && repository != "" {
+				a.external = append(a.external, ExternalBlob{Digest: blob.Digest, Size: blob.Size, Repository: repository})
+				continue
+			}
+			a.blobs = append(a.blobs, blob)
+		}
+	}
+	a.manifests = append(a.manifests, imageArchiveManifest{descriptor: descriptor, content: content, manifest: manifest})
+	return nil
+}
+
+func (a *imageArchive) hasBlob(digest string) bool {
+	for _, blob := range a.blobs {
+		if blob.Digest == digest {
+			return true
+		}
+	}
+	for _, blob := range a.external {
+		if blob.Digest == digest {
+			return true
+		}
+	}
+	return false
+}
+
+// receiveRepository возвращает репозиторий registry RECEIVE, в котором уже есть блоб
+func (a *imageArchive) receiveRepository(digest string) string {
+	if a.inventory == nil {
+		return ""
+	}
+	return a.inventory.Blobs[digest]
+}
+
+// repoTag - тег образа в manifest.json, под которым его загрузит `docker load`.
+// Совпадает с именем, которое при загрузке через docker daemon тегируется под registry RECEIVE
+func (a *imageArchive) repoTag() string {
+	if a.ref.Tag == "" {
+		return ""
+	}
+	name, _, _ := strings.Cut(a.imageName, "@")
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	return BuildTargetImageName(StartupConfig.SendDockerRegistry, name) + ":" + a.ref.Tag
+}
+
+// taggedManifestDigest - образ, который получит тег при `docker load`. Для индекса - образ под платформу SEND или первый
+func (a *imageArchive) taggedManifestDigest() string {
+	if !IsImageIndex(a.root.MediaType) {
+		return a.root.Digest
+	}
+	tagged := ""
+	for _, manifest := range a.manifests {
+		if !manifest.isLoadableImage() || manifest.descriptor.Platform == nil {
+			continue
+		}
+		if manifest.descriptor.Platform.Matches(defaultPlatform()) {
+			return manifest.descriptor.Digest
+		}
+		if tagged == "" {
+			tagged = manifest.descriptor.Digest
+		}
+	}
+	return tagged
+}
+
+// isLoadableImage - манифест образа, который можно загрузить через `docker load`.
+// Индексы и аттестации buildx (платформа unknown/unknown, слои в формате in-toto) к ним не относятся
+func (m imageArchiveManifest) isLoadableImage() bool {
+	if IsImageIndex(m.descriptor.MediaType) || m.manifest.Config == nil {
+		return false
+	}
+	if m.manifest.Config.MediaType != MediaTypeOciConfig && m.manifest.Config.MediaType != MediaTypeDockerConfig {
+		return false
+	}
+	if m.descriptor.Annotations[attestationTypeAnnotation] != "" || m.descriptor.Annotations[attestationReferenceAnnotation] != "" {
+		return false
+	}
+	return m.descriptor.Platform == nil || m.descriptor.Platform.OS != "unknown"
+}
+
+func (a *imageArchive) write(ctx context.Context, writer io.Writer) error {
+	tarWriter := tar.NewWriter(writer)
+	if err := writeTarEntry(tarWriter, OciLayoutFileName, []byte(`{"imageLayoutVersion":"1.0.0"}`)); err != nil {
+		return err
+	}
+
+	root := a.root
+	if a.ref.Tag != "" {
+		// containerd хранит образы Docker Hub под именем docker.io/...
+		imageName := strings.Replace(a.ref.String(), DockerHubRegistry, "docker.io", 1)
+		root.Annotations = map[string]string{OciImageNameAnnotation: imageName, OciRefNameAnnotation: a.ref.Tag}
+	}
+	index, err := json.Marshal(OciManifest{SchemaVersion: 2, MediaType: MediaTypeOciIndex, Manifests: []OciDescriptor{root}})
+	if err != nil {
+		return err
+	}
+	if err := writeTarEntry(tarWriter, OciIndexFileName, index); err != nil {
+		return err
+	}
+	// manifest.json нужен `docker load`, он понимает только образы, но не индексы. Из индекса в manifest.json
+	// попадает только образ, получающий тег: образы других платформ и аттестации docker daemon загрузить не может
+	taggedDigest := a.taggedManifestDigest()
+	dockerManifests := []DockerArchiveManifest{}
+	for _, manifest := range a.manifests {
+		if manifest.descriptor.Digest != taggedDigest || !manifest.isLoadableImage() {
+			continue
+		}
+		dockerManifest := DockerArchiveManifest{Config: OciBlobPath(manifest.manifest.Config.Digest), RepoTags: []string{}}
+		if a.repoTag() != "" {
+			dockerManifest.RepoTags = append(dockerManifest.RepoTags, a.repoTag())
+		}
+		for _, layer := range manifest.manifest.Layers {
+			dockerManifest.Layers = append(dockerManifest.Layers, OciBlobPath(layer.Digest))
+		}
+		dockerManifests = append(dockerManifests, dockerManifest)
+	}
+	content, err := json.Marshal(dockerManifests)
+	if err != nil {
+		return err
+	}
+	if err := writeTarEntry(tarWriter, DockerManifestFileName, content); err != nil {
+		return err
+	}
+	if len(a.external) > 0 {
+		// без этих слоёв архив не загрузится через `docker load`, их подключит RECEIVE в registry
+		var skipped int64
+		for _, blob := range a.external {
+			skipped += blob.Size
+		}
+		log.Printf("image %s: %d layers (%d bytes) already exist in RECEIVE registry and are not sent\n", a.ref.String(), len(a.external), skipped)
+		content, err := json.Marshal(a.external)
+		if err != nil {
+			return err
+		}
+		if err := writeTarEntry(tarWriter, ExternalBlobsFileName, content); err != nil {
+			return err
+		}
+	}
+	for _, manifest := range a.manifests {
+		if err := writeTarEntry(tarWriter, OciBlobPath(manifest.descriptor.Digest), manifest.content); err != nil {
+			return err
+		}
+	}
+
+	for _, blob := range a.blobs {
+		if err := a.writeBlob(ctx, tarWriter, blob); err != nil {
+			log.Printf("failed to pull blob %s of image %s: %v\n", blob.Digest, a.ref.String(), err)
+			return err
+		}
+	}
+	return tarWriter.Close()
+}
+
+// writeBlob скачивает блоб в архив, сверяя размер и sha256 с манифестом
+func (a *imageArchive) writeBlob(ctx context.Context, tarWriter *tar.Writer, blob OciDescriptor) error {
+	algorithm, expected, _ := strings.Cut(blob.Digest, ":")
+	if algorithm != "sha256" {
+		return fmt.Errorf("unsupported digest algorithm of blob %s", blob.Digest)
+	}
+	stream, err := a.client.GetBlob(ctx, a.ref.Repository, blob.Digest)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	if err := tarWriter.WriteHeader(&tar.Header{Name: OciBlobPath(blob.Digest), Mode: 0644, Size: blob.Size}); err != nil {
+		return err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tarWriter, hash), stream); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return fmt.Errorf("blob %s has digest sha256:%s: %w", blob.Digest, actual, ErrChecksumMismatch)
+	}
+	log.Printf("pulled blob %s (%d bytes) of image %s\n", blob.Digest, blob.Size, a.ref.String())
+	return nil
+}
+
+func writeTarEntry(tarWriter *tar.Writer, name string, content []byte) error {
+	if err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+		return err
+	}
+	_, err := tarWriter.Write(content)
+	return err
+}
@@ -0,0 +1,104 @@
+package common
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"runtime"
+	"testing"
+)
+
+func testArchiveManifest(t *testing.T, digest string, platform *OciPlatform, annotations map[string]string, configMediaType string) imageArchiveManifest {
+	t.Helper()
+	manifest := OciManifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOciManifest,
+		Config:        &OciDescriptor{MediaType: configMediaType, Digest: "sha256:config-" + digest[len("sha256:"):]},
+		Layers:        []OciDescriptor{{MediaType: MediaTypeOciLayer, Digest: "sha256:layer-" + digest[len("sha256:"):]}},
+	}
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptor := OciDescriptor{MediaType: MediaTypeOciManifest, Digest: digest, Platform: platform, Annotations: annotations}
+	return imageArchiveManifest{descriptor: descriptor, content: content, manifest: manifest}
+}
+
+func readArchiveEntry(t *testing.T, archive []byte, name string) []byte {
+	t.Helper()
+	reader := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := reader.Next()
+		if err != nil {
+			t.Fatalf("archive has no %s: %v", name, err)
+		}
+		if header.Name == name {
+			content, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return content
+		}
+	}
+}
+
+func TestImageArchiveDockerManifestSkipsAttestationsAndOtherPlatforms(t *testing.T) {
+	StartupConfig.SendDockerRegistry = "registry.send"
+	otherArch := "arm64"
+	if runtime.GOARCH == otherArch {
+		otherArch = "amd64"
+	}
+	own := testArchiveManifest(t, "sha256:own", &OciPlatform{OS: "linux", Architecture: runtime.GOARCH}, nil, MediaTypeOciConfig)
+	other := testArchiveManifest(t, "sha256:other", &OciPlatform{OS: "linux", Architecture: otherArch}, nil, MediaTypeDockerConfig)
+	attestation := testArchiveManifest(t, "sha256:attestation", &OciPlatform{OS: "unknown", Architecture: "unknown"},
+		map[string]string{attestationTypeAnnotation: "attestation-manifest", attestationReferenceAnnotation: "sha256:own"}, MediaTypeOciConfig)
+	index := imageArchiveManifest{descriptor: OciDescriptor{MediaType: MediaTypeOciIndex, Digest: "sha256:index"}, content: []byte(`{}`)}
+
+	archive := &imageArchive{
+		imageName: "alpine:3.20",
+		ref:       ParseImageReference("registry.send", "alpine:3.20"),
+		root:      index.descriptor,
+		manifests: []imageArchiveManifest{index, attestation, other, own},
+	}
+	var buffer bytes.Buffer
+	if err := archive.write(context.Background(), &buffer); err != nil {
+		t.Fatal(err)
+	}
+	var dockerManifests []DockerArchiveManifest
+	if err := json.Unmarshal(readArchiveEntry(t, buffer.Bytes(), DockerManifestFileName), &dockerManifests); err != nil {
+		t.Fatal(err)
+	}
+	if len(dockerManifests) != 1 {
+		t.Fatalf("manifest.json has %d images, want 1: %+v", len(dockerManifests), dockerManifests)
+	}
+	if dockerManifests[0].Config != OciBlobPath(own.manifest.Config.Digest) {
+		t.Errorf("manifest.json contains config %s, want %s", dockerManifests[0].Config, OciBlobPath(own.manifest.Config.Digest))
+	}
+	if len(dockerManifests[0].RepoTags) != 1 || dockerManifests[0].RepoTags[0] != "registry.send/alpine:3.20" {
+		t.Errorf("manifest.json repo tags = %v", dockerManifests[0].RepoTags)
+	}
+}
+
+func TestImageArchiveManifestIsLoadableImage(t *testing.T) {
+	linux := &OciPlatform{OS: "linux", Architecture: "amd64"}
+	tests := []struct {
+		name     string
+		manifest imageArchiveManifest
+		want     bool
+	}{
+		{"oci image", testArchiveManifest(t, "sha256:a", linux, nil, MediaTypeOciConfig), true},
+		{"docker image", testArchiveManifest(t, "sha256:a", linux, nil, MediaTypeDockerConfig), true},
+		{"image without platform", testArchiveManifest(t, "sha256:a", nil, nil, MediaTypeOciConfig), true},
+		{"helm chart", testArchiveManifest(t, "sha256:a", nil, nil, "application/vnd.cncf.helm.config.v1+json"), false},
+		{"attestation", testArchiveManifest(t, "sha256:a", &OciPlatform{OS: "unknown", Architecture: "unknown"},
+			map[string]string{attestationTypeAnnotation: "attestation-manifest"}, MediaTypeOciConfig), false},
+		{"index", imageArchiveManifest{descriptor: OciDescriptor{MediaType: MediaTypeDockerManifestList}}, false},
+	}
+	for _, test := range tests {
+		if got := test.manifest.isLoadableImage(); got != test.want {
+			t.Errorf("%s: isLoadableImage() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"fts-cd-file-utility/cfg"
 	_ "github.com/docker/docker/api/types/container"
 	image "github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/registry"
@@ -20,6 +21,31 @@ var DockerApiVersion string
 
 type DockerArtifact struct {
 	ImageName string
+	// Platforms - платформы индекса образа, которые нужно перенести, или all для всех.
+	// Пусто - только образ под платформу SEND, как при docker pull
+	Platforms []string `json:",omitempty"`
+	// WithoutDedup - отправить все слои, не сверяясь со списком блобов RECEIVE.
+	// Проставляется при повторной отправке, если RECEIVE не смог подключить слой
+	WithoutDedup bool `json:",omitempty"`
+}
+
+// WithoutDockerDedup возвращает копию docker артефакта, которая отправляется со всеми слоями.
+// false - артефакт не docker или уже отправлялся без дедупликации
+func WithoutDockerDedup(artifact Artifact) (Artifact, bool) {
+	var dockerArtifact DockerArtifact
+	switch a := artifact.(type) {
+	case DockerArtifact:
+		dockerArtifact = a
+	case *DockerArtifact:
+		dockerArtifact = *a
+	default:
+		return nil, false
+	}
+	if dockerArtifact.WithoutDedup {
+		return nil, false
+	}
+	dockerArtifact.WithoutDedup = true
+	return dockerArtifact, true
 }
 
 func (a DockerArtifact) GetOriginalResourceName() string {
@@ -54,8 +80,11 @@ func buildPullOptions() (image.PullOptions, error) {
 	return image.PullOptions{}, nil
 }
 
-func (a DockerArtifact) GetStream() (io.ReadCloser, error) {
+func (a DockerArtifact) GetStream(ctx context.Context) (io.ReadCloser, error) {
 	imageName := a.ImageName
+	if StartupConfig.SendDockerTransport == cfg.RegistryDockerTransport {
+		return openRegistryImageArchive(ctx, imageName, a.Platforms, StartupConfig.SendDockerDedupEnabled && !a.WithoutDedup)
+	}
 	apiClient, err := client.NewClientWithOpts(client.WithVersion(DockerApiVersion))
 	if err != nil {
 		log.Println("failed to create docker client", err)
@@ -69,16 +98,19 @@ func (a DockerArtifact) GetStream() (io.ReadCloser, error) {
 	}
 	tgtImageName := BuildTargetImageName(StartupConfig.SendDockerRegistry, imageName)
 	log.Println("starting to pull image", tgtImageName)
-	progressReader, err := apiClient.ImagePull(context.Background(), tgtImageName, pullOptions)
+	progressReader, err := apiClient.ImagePull(ctx, tgtImageName, pullOptions)
 	if err != nil {
 		log.Println("failed to pull image "+tgtImageName, err)
 		return nil, err
 	}
 	defer progressReader.Close()
-	io.Copy(os.Stdout, progressReader)
+	if _, err = io.Copy(os.Stdout, progressReader); err != nil {
+		log.Println("failed to pull image "+tgtImageName, err)
+		return nil, err
+	}
 
 	log.Println("starting to save image", tgtImageName)
-	return apiClient.ImageSave(context.Background(), []string{tgtImageName})
+	return apiClient.ImageSave(ctx, []string{tgtImageName})
 }
 
 func BuildTargetImageName(registry, imageName string) string {
@@ -88,8 +120,8 @@ func BuildTargetImageName(registry, imageName string) string {
 	return registry + "/" + imageName
 }
 
-func (a DockerArtifact) GetArtifactNameAndStream() (ArtifactNameAndStream, error) {
-	stream, err := a.GetStream()
+func (a DockerArtifact) GetArtifactNameAndStream(ctx context.Context) (ArtifactNameAndStream, error) {
+	stream, err := a.GetStream(ctx)
 	if err != nil {
 		log.Printf("failed to get Docker stream %v\n", err)
 		return ArtifactNameAndStream{}, err
@@ -100,12 +132,19 @@ func (a DockerArtifact) GetArtifactNameAndStream() (ArtifactNameAndStream, error
 }
 
 func (a DockerArtifact) DeliverCleanup() error {
+	if StartupConfig.SendDockerTransport == cfg.RegistryDockerTransport {
+		// образ не попадал в docker daemon
+		return nil
+	}
 	// image must be deleted
 	imageName := BuildTargetImageName(StartupConfig.SendDockerRegistry, a.GetOriginalResourceName())
 	return cleanup(imageName)
 }
 
 func (a DockerArtifact) DeployCleanup() error {
+	if StartupConfig.ReceiveDockerTransport == cfg.RegistryDockerTransport {
+		return nil
+	}
 	// image must be deleted
 	imageName := BuildTargetImageName(StartupConfig.ReceiveDockerRegistry, a.GetOriginalResourceName())
 	return cleanup(imageName)
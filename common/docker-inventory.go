@@ -0,0 +1,65 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Дедупликация слоёв образов: RECEIVE кладёт на шару список блобов, которые уже есть в registry RECEIVE,
+// SEND не пишет такие слои в архив, а RECEIVE подключает их из другого репозитория registry (cross-repository mount)
+
+const (
+	DockerBlobInventoryFileName = "docker-blob-inventory.json"
+	// ExternalBlobsFileName - файл архива образа со списком слоёв, не записанных в архив
+	ExternalBlobsFileName = "external-blobs.json"
+)
+
+// ErrDockerLayerMissing - слоя, не записанного в архив, нет в registry RECEIVE: список блобов устарел
+var ErrDockerLayerMissing = errors.New("docker layer is missing in receive registry")
+
+// DockerBlobInventory - блобы registry RECEIVE
+type DockerBlobInventory struct {
+	Registry string    `json:"registry"`
+	Dttm     time.Time `json:"dttm"`
+	// Blobs - digest блоба и репозиторий registry RECEIVE, в котором он есть
+	Blobs map[string]string `json:"blobs"`
+}
+
+// ExternalBlob - слой образа, который не записан в архив и подключается на стороне RECEIVE из репозитория Repository
+type ExternalBlob struct {
+	Digest     string `json:"digest"`
+	Size       int64  `json:"size"`
+	Repository string `json:"repository"`
+}
+
+// ReadDockerBlobInventory читает список блобов registry RECEIVE с шары на стороне SEND.
+// Если RECEIVE его ещё не выложил, возвращает nil
+func ReadDockerBlobInventory() (*DockerBlobInventory, error) {
+	u, err := url.Parse(StartupConfig.NFSPath)
+	if err != nil {
+		return nil, err
+	}
+	if strings.ToLower(u.Scheme) != "fs" {
+		log.Printf("docker blob inventory can't be read since NFSPath %s is not fs url, all layers will be sent\n", StartupConfig.NFSPath)
+		return nil, nil
+	}
+	content, err := os.ReadFile(filepath.Join(u.Path, DockerBlobInventoryFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		log.Println("docker blob inventory is not published by RECEIVE yet, all layers will be sent")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var inventory DockerBlobInventory
+	if err := json.Unmarshal(content, &inventory); err != nil {
+		return nil, err
+	}
+	return &inventory, nil
+}
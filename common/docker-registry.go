@@ -0,0 +1,597 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Клиент OCI distribution API: скачивание и загрузка манифестов и слоёв образов без docker daemon
+
+const (
+	DockerHubRegistry = "registry-1.docker.io"
+
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOciManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOciIndex           = "application/vnd.oci.image.index.v1+json"
+	MediaTypeOciConfig          = "application/vnd.oci.image.config.v1+json"
+	MediaTypeDockerConfig       = "application/vnd.docker.container.image.v1+json"
+	MediaTypeOciLayer           = "application/vnd.oci.image.layer.v1.tar"
+)
+
+// manifestAcceptHeader - форматы манифестов, которые понимает клиент
+var manifestAcceptHeader = strings.Join([]string{MediaTypeOciIndex, MediaTypeDockerManifestList, MediaTypeOciManifest, MediaTypeDockerManifest}, ", ")
+
+type OciPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+type OciDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *OciPlatform      `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// OciManifest - манифест образа (Config, Layers) или индекс образов (Manifests), в зависимости от MediaType
+type OciManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Config        *OciDescriptor    `json:"config,omitempty"`
+	Layers        []OciDescriptor   `json:"layers,omitempty"`
+	Manifests     []OciDescriptor   `json:"manifests,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// AllPlatforms - перенести индекс образа со всеми платформами
+const AllPlatforms = "all"
+
+// ParseOciPlatform разбирает платформу вида os/architecture[/variant], например linux/arm64/v8
+func ParseOciPlatform(value string) (OciPlatform, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return OciPlatform{}, fmt.Errorf("invalid platform '%s', expected os/architecture[/variant]", value)
+	}
+	platform := OciPlatform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		platform.Variant = parts[2]
+	}
+	return platform, nil
+}
+
+// Matches - платформа манифеста из индекса подходит под запрошенную. Пустой вариант подходит под любой
+func (p OciPlatform) Matches(requested OciPlatform) bool {
+	return p.OS == requested.OS && p.Architecture == requested.Architecture && (requested.Variant == "" || p.Variant == requested.Variant)
+}
+
+func (p OciPlatform) String() string {
+	if p.Variant != "" {
+		return p.OS + "/" + p.Architecture + "/" + p.Variant
+	}
+	return p.OS + "/" + p.Architecture
+}
+
+// IsImageIndex - манифест является индексом образов под разные платформы (manifest list)
+func IsImageIndex(mediaType string) bool {
+	return mediaType == MediaTypeOciIndex || mediaType == MediaTypeDockerManifestList
+}
+
+// ImageReference - ссылка на образ в registry: registry/repository:tag или registry/repository@digest
+type ImageReference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseImageReference разбирает имя образа так же, как docker: без registry образ берётся из Docker Hub,
+// однокомпонентные имена Docker Hub получают префикс library/, тег по умолчанию - latest
+func ParseImageReference(registry, imageName string) ImageReference {
+	ref := ImageReference{Registry: registry}
+	name := imageName
+	if before, digest, found := strings.Cut(name, "@"); found {
+		name, ref.Digest = before, digest
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:i], name[i+1:]
+	}
+	if ref.Registry == "" {
+		if host, rest, found := strings.Cut(name, "/"); found && (strings.ContainsAny(host, ".:") || host == "localhost") {
+			ref.Registry, name = host, rest
+		} else {
+			ref.Registry = DockerHubRegistry
+		}
+	}
+	if ref.Registry == "docker.io" || ref.Registry == "index.docker.io" {
+		ref.Registry = DockerHubRegistry
+	}
+	if ref.Registry == DockerHubRegistry && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	ref.Repository = name
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	return ref
+}
+
+// Reference возвращает digest, если он задан, иначе тег
+func (r ImageReference) Reference() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+func (r ImageReference) String() string {
+	name := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		name += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		name += "@" + r.Digest
+	}
+	return name
+}
+
+// RegistryClient выполняет запросы к registry с авторизацией по схеме Basic или Bearer token.
+// Используется https. На http клиент переключается, только если registry не поддерживает https и разрешён insecure
+type RegistryClient struct {
+	registry string
+	login    string
+	password string
+	insecure bool
+
+	lock   sync.Mutex
+	scheme string
+	basic  bool
+	// tokens - bearer токены по scope
+	tokens map[string]string
+}
+
+func NewRegistryClient(registry, login, password string, insecure bool) *RegistryClient {
+	return &RegistryClient{registry: registry, login: login, password: password, insecure: insecure, scheme: "https", tokens: map[string]string{}}
+}
+
+// registryRequest - запрос к registry. Тело создаётся заново при каждой отправке, чтобы запрос можно было повторить
+type registryRequest struct {
+	method     string
+	repository string
+	// path - путь после /v2/<repository>/ или полный url для location из ответа на загрузку
+	path    string
+	query   url.Values
+	header  http.Header
+	body    func() (io.ReadCloser, error)
+	size    int64
+	actions string
+	// scope - scope токена, если запрос не ограничен действиями actions над repository
+	scope string
+}
+
+func (c *RegistryClient) buildUrl(req registryRequest) (string, error) {
+	if strings.HasPrefix(req.path, "http://") || strings.HasPrefix(req.path, "https://") {
+		return withQuery(req.path, req.query)
+	}
+	c.lock.Lock()
+	base := c.scheme + "://" + c.registry
+	c.lock.Unlock()
+	// location от registry бывает относительным
+	if strings.HasPrefix(req.path, "/") {
+		return withQuery(base+req.path, req.query)
+	}
+	return withQuery(base+"/v2/"+req.repository+"/"+req.path, req.query)
+}
+
+func withQuery(rawUrl string, query url.Values) (string, error) {
+	if len(query) == 0 {
+		return rawUrl, nil
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", err
+	}
+	values := u.Query()
+	for key, list := range query {
+		for _, value := range list {
+			values.Add(key, value)
+		}
+	}
+	u.RawQuery = values.Encode()
+	return u.String(), nil
+}
+
+// do отправляет запрос, при необходимости получает токен и повторяет запрос. Ответ с кодом не 2xx возвращается как есть
+func (c *RegistryClient) do(ctx context.Context, req registryRequest) (*http.Response, error) {
+	scope := req.scope
+	if scope == "" {
+		scope = "repository:" + req.repository + ":" + req.actions
+	}
+	authorized := false
+	for {
+		resp, err := c.send(ctx, req, scope)
+		if errors.Is(err, http.ErrSchemeMismatch) {
+			if !c.insecure {
+				// по http учётные данные передавались бы открытым текстом
+				log.Printf("registry %s doesn't support https and insecure registry is not allowed\n", c.registry)
+				return nil, fmt.Errorf("registry %s doesn't support https, plain http must be allowed explicitly by *_docker_registry_insecure: %v", c.registry, err)
+			}
+			c.lock.Lock()
+			switchScheme := c.scheme == "https"
+			c.scheme = "http"
+			c.lock.Unlock()
+			if switchScheme {
+				log.Printf("registry %s doesn't support https, switching to http\n", c.registry)
+				continue
+			}
+		}
+		if err != nil || resp.StatusCode != http.StatusUnauthorized || authorized {
+			return resp, err
+		}
+		challenge := resp.Header.Get("WWW-Authenticate")
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if err := c.authorize(ctx, challenge, scope); err != nil {
+			return nil, err
+		}
+		authorized = true
+	}
+}
+
+func (c *RegistryClient) send(ctx context.Context, req registryRequest, scope string) (*http.Response, error) {
+	requestUrl, err := c.buildUrl(req)
+	if err != nil {
+		return nil, err
+	}
+	var body io.ReadCloser
+	if req.body != nil {
+		if body, err = req.body(); err != nil {
+			return nil, err
+		}
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, requestUrl, body)
+	if err != nil {
+		if body != nil {
+			body.Close()
+		}
+		return nil, err
+	}
+	if req.body != nil {
+		httpReq.ContentLength = req.size
+	}
+	for key, values := range req.header {
+		httpReq.Header[key] = values
+	}
+	c.lock.Lock()
+	token, basic := c.tokens[scope], c.basic
+	c.lock.Unlock()
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	} else if basic {
+		httpReq.SetBasicAuth(c.login, c.password)
+	}
+	return HttpClient.Do(httpReq)
+}
+
+// authorize разбирает WWW-Authenticate и готовит авторизацию: Basic - логин и пароль, Bearer - токен от realm
+func (c *RegistryClient) authorize(ctx context.Context, challenge, scope string) error {
+	authScheme, params := parseAuthChallenge(challenge)
+	switch strings.ToLower(authScheme) {
+	case "basic":
+		if c.login == "" {
+			return fmt.Errorf("registry %s requires login and password", c.registry)
+		}
+		c.lock.Lock()
+		c.basic = true
+		c.lock.Unlock()
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("registry %s returned unsupported authentication challenge '%s'", c.registry, challenge)
+	}
+
+	tokenUrl, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("registry %s returned invalid token realm '%s'", c.registry, params["realm"])
+	}
+	query := tokenUrl.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	// несколько scope передаются отдельными параметрами
+	for _, scopeItem := range strings.Fields(scope) {
+		query.Add("scope", scopeItem)
+	}
+	tokenUrl.RawQuery = query.Encode()
+	tokenReq, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenUrl.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.login != "" {
+		tokenReq.SetBasicAuth(c.login, c.password)
+	}
+	resp, err := HttpClient.Do(tokenReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &HttpStatusError{Url: tokenUrl.String(), StatusCode: resp.StatusCode}
+	}
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return err
+	}
+	token := tokenResponse.Token
+	if token == "" {
+		token = tokenResponse.AccessToken
+	}
+	if token == "" {
+		return fmt.Errorf("token server %s returned no token", tokenUrl.Host)
+	}
+	c.lock.Lock()
+	c.tokens[scope] = token
+	c.lock.Unlock()
+	return nil
+}
+
+// parseAuthChallenge разбирает заголовок вида `Bearer realm="...",service="...",scope="..."`
+func parseAuthChallenge(challenge string) (string, map[string]string) {
+	authScheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := map[string]string{}
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			var found bool
+			value, rest, found = strings.Cut(rest[1:], `"`)
+			if !found {
+				rest = ""
+			}
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key = strings.ToLower(strings.TrimSpace(key)); key != "" {
+			params[key] = value
+		}
+	}
+	return authScheme, params
+}
+
+// GetManifest скачивает манифест или индекс по тегу или digest и возвращает его содержимое и описание
+func (c *RegistryClient) GetManifest(ctx context.Context, repository, reference string) ([]byte, OciDescriptor, error) {
+	resp, err := c.do(ctx, registryRequest{method: http.MethodGet, repository: repository, path: "manifests/" + reference,
+		header: http.Header{"Accept": {manifestAcceptHeader}}, actions: "pull"})
+	if err != nil {
+		return nil, OciDescriptor{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, OciDescriptor{}, &ArtifactNotFoundError{Message: fmt.Sprintf("image %s/%s:%s not found", c.registry, repository, reference)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, OciDescriptor{}, c.statusError(resp)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, OciDescriptor{}, err
+	}
+	descriptor := OciDescriptor{
+		MediaType: resp.Header.Get("Content-Type"),
+		Digest:    fmt.Sprintf("sha256:%x", sha256.Sum256(content)),
+		Size:      int64(len(content)),
+	}
+	// registry может отдать общий Content-Type, тогда тип берётся из самого манифеста
+	var manifest OciManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, OciDescriptor{}, fmt.Errorf("invalid manifest %s:%s: %w", repository, reference, err)
+	}
+	if manifest.MediaType != "" {
+		descriptor.MediaType = manifest.MediaType
+	} else if manifest.Manifests != nil {
+		descriptor.MediaType = MediaTypeOciIndex
+	} else if !strings.Contains(descriptor.MediaType, "manifest") {
+		descriptor.MediaType = MediaTypeOciManifest
+	}
+	if strings.HasPrefix(reference, "sha256:") && reference != descriptor.Digest {
+		return nil, OciDescriptor{}, fmt.Errorf("manifest %s:%s has digest %s: %w", repository, reference, descriptor.Digest, ErrChecksumMismatch)
+	}
+	return content, descriptor, nil
+}
+
+// GetBlob открывает слой или конфигурацию образа
+func (c *RegistryClient) GetBlob(ctx context.Context, repository, digest string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, registryRequest{method: http.MethodGet, repository: repository, path: "blobs/" + digest, actions: "pull"})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, c.statusError(resp)
+	}
+	return resp.Body, nil
+}
+
+// BlobExists проверяет наличие слоя в репозитории
+func (c *RegistryClient) BlobExists(ctx context.Context, repository, digest string) (bool, error) {
+	resp, err := c.do(ctx, registryRequest{method: http.MethodHead, repository: repository, path: "blobs/" + digest, actions: "pull,push"})
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, c.statusError(resp)
+}
+
+// PutBlob загружает слой одним запросом: POST открывает загрузку, PUT с digest её завершает
+func (c *RegistryClient) PutBlob(ctx context.Context, repository, digest string, size int64, open func() (io.ReadCloser, error)) error {
+	resp, err := c.do(ctx, registryRequest{method: http.MethodPost, repository: repository, path: "blobs/uploads/", actions: "pull,push"})
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return c.statusError(resp)
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return fmt.Errorf("registry %s returned no upload location for %s", c.registry, digest)
+	}
+	resp, err = c.do(ctx, registryRequest{method: http.MethodPut, repository: repository, path: location,
+		query: url.Values{"digest": {digest}}, header: http.Header{"Content-Type": {"application/octet-stream"}},
+		body: open, size: size, actions: "pull,push"})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return c.statusError(resp)
+	}
+	return nil
+}
+
+// MountBlob подключает слой из другого репозитория того же registry без загрузки.
+// Возвращает false, если registry не смог подключить слой (нет слоя или нет доступа к репозиторию from)
+func (c *RegistryClient) MountBlob(ctx context.Context, repository, digest, from string) (bool, error) {
+	resp, err := c.do(ctx, registryRequest{method: http.MethodPost, repository: repository, path: "blobs/uploads/",
+		query: url.Values{"mount": {digest}, "from": {from}},
+		scope: "repository:" + repository + ":pull,push repository:" + from + ":pull"})
+	if err != nil {
+		return false, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return true, nil
+	case http.StatusAccepted:
+		// registry открыл обычную загрузку вместо подключения, она не нужна
+		if location := resp.Header.Get("Location"); location != "" {
+			if resp, err := c.do(ctx, registryRequest{method: http.MethodDelete, repository: repository, path: location, actions: "pull,push"}); err == nil {
+				resp.Body.Close()
+			}
+		}
+		return false, nil
+	}
+	return false, c.statusError(resp)
+}
+
+// Catalog возвращает все репозитории registry, постранично по ссылке из заголовка Link
+func (c *RegistryClient) Catalog(ctx context.Context) ([]string, error) {
+	var catalog struct {
+		Repositories []string `json:"repositories"`
+	}
+	var repositories []string
+	err := c.listPages(ctx, registryRequest{method: http.MethodGet, path: "/v2/_catalog", query: url.Values{"n": {"1000"}}, scope: "registry:catalog:*"}, func(body io.Reader) error {
+		catalog.Repositories = nil
+		if err := json.NewDecoder(body).Decode(&catalog); err != nil {
+			return err
+		}
+		repositories = append(repositories, catalog.Repositories...)
+		return nil
+	})
+	return repositories, err
+}
+
+// ListTags возвращает теги репозитория
+func (c *RegistryClient) ListTags(ctx context.Context, repository string) ([]string, error) {
+	var tagList struct {
+		Tags []string `json:"tags"`
+	}
+	var tags []string
+	err := c.listPages(ctx, registryRequest{method: http.MethodGet, repository: repository, path: "tags/list", actions: "pull"}, func(body io.Reader) error {
+		tagList.Tags = nil
+		if err := json.NewDecoder(body).Decode(&tagList); err != nil {
+			return err
+		}
+		tags = append(tags, tagList.Tags...)
+		return nil
+	})
+	return tags, err
+}
+
+// listPages запрашивает страницы списка, пока в ответе есть Link на следующую страницу
+func (c *RegistryClient) listPages(ctx context.Context, req registryRequest, readPage func(body io.Reader) error) error {
+	for {
+		resp, err := c.do(ctx, req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return nil
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return c.statusError(resp)
+		}
+		err = readPage(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		next := parseNextLink(resp.Header.Get("Link"))
+		if next == "" {
+			return nil
+		}
+		req.path, req.query = next, nil
+	}
+}
+
+// parseNextLink возвращает адрес из заголовка вида `</v2/_catalog?last=a&n=100>; rel="next"`
+func parseNextLink(link string) string {
+	target, params, found := strings.Cut(link, ";")
+	if !found || !strings.Contains(params, `rel="next"`) {
+		return ""
+	}
+	return strings.Trim(strings.TrimSpace(target), "<>")
+}
+
+// PutManifest загружает манифест под тегом или digest и возвращает digest, который вернул registry
+func (c *RegistryClient) PutManifest(ctx context.Context, repository, reference, mediaType string, content []byte) (string, error) {
+	resp, err := c.do(ctx, registryRequest{method: http.MethodPut, repository: repository, path: "manifests/" + reference,
+		header: http.Header{"Content-Type": {mediaType}},
+		body: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(content)), nil
+		}, size: int64(len(content)), actions: "pull,push"})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", c.statusError(resp)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+	}
+	return digest, nil
+}
+
+// statusError логирует тело ответа registry с описанием ошибки и возвращает HttpStatusError
+func (c *RegistryClient) statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	log.Printf("registry %s responded %d to %s %s: %s\n", c.registry, resp.StatusCode, resp.Request.Method, resp.Request.URL.Path, strings.TrimSpace(string(body)))
+	return &HttpStatusError{Url: resp.Request.URL.String(), StatusCode: resp.StatusCode}
+}
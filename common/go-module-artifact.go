@@ -0,0 +1,264 @@
+package common
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	GoModuleLatestVersion = "latest"
+	// Суффикс архива, в котором .info, .mod, .zip и .ziphash модуля передаются через шару
+	GoModuleBundleSuffix = ".gomod.tar"
+)
+
+// GoModuleArtifact - go модуль из go-proxy репозитория Nexus.
+// Version - версия (v1.2.3) или latest. Sum - необязательный h1: хеш zip архива из go.sum
+type GoModuleArtifact struct {
+	ModulePath string
+	Version    string
+	Sum        string
+}
+
+// GoModuleInfo - содержимое файла <version>.info
+type GoModuleInfo struct {
+	Version string
+}
+
+func (a GoModuleArtifact) GetType() ArtifactType {
+	return GO
+}
+
+func (a GoModuleArtifact) GetOriginalResourceName() string {
+	if a.Version == "" {
+		return a.ModulePath
+	}
+	return a.ModulePath + "@" + a.Version
+}
+
+func (a GoModuleArtifact) GetArtifactNameAndStream(ctx context.Context) (ArtifactNameAndStream, error) {
+	escapedPath, err := EscapeGoModulePath(a.ModulePath)
+	if err != nil {
+		return ArtifactNameAndStream{}, err
+	}
+	proxyUrl := fmt.Sprintf("%s/repository/%s/%s/", StartupConfig.SendNexusUrl, strings.Trim(StartupConfig.SendNexusGoRepository, "/"), escapedPath)
+	version, err := a.resolveVersion(ctx, proxyUrl)
+	if err != nil {
+		return ArtifactNameAndStream{}, err
+	}
+
+	tempDir, err := os.MkdirTemp("", "gomod_")
+	if err != nil {
+		log.Println("failed to create temp dir", err)
+		return ArtifactNameAndStream{}, err
+	}
+	escapedVersion, err := EscapeGoModuleVersion(version)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return ArtifactNameAndStream{}, err
+	}
+	fileNames, err := a.downloadModuleFiles(ctx, proxyUrl, version, escapedVersion, tempDir)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return ArtifactNameAndStream{}, err
+	}
+
+	return openTarBundle(tempDir, strings.ReplaceAll(escapedPath, "/", "--")+"@"+escapedVersion+GoModuleBundleSuffix, fileNames)
+}
+
+// downloadModuleFiles скачивает .info, .mod и .zip модуля в dir, считает h1: хеш zip архива,
+// сверяет его с Sum и сохраняет в .ziphash. Файлы называются закодированной версией, как в GOPROXY
+func (a GoModuleArtifact) downloadModuleFiles(ctx context.Context, proxyUrl, version, escapedVersion, dir string) ([]string, error) {
+	var fileNames []string
+	for _, extension := range []string{".info", ".mod", ".zip"} {
+		fileName := escapedVersion + extension
+		if err := downloadGoProxyFile(ctx, proxyUrl+"@v/"+fileName, filepath.Join(dir, fileName)); err != nil {
+			log.Printf("failed to download %s of go module %s: %v\n", fileName, a.ModulePath, err)
+			return nil, err
+		}
+		fileNames = append(fileNames, fileName)
+	}
+
+	zipPath := filepath.Join(dir, escapedVersion+".zip")
+	if err := CheckGoModuleZip(zipPath, a.ModulePath, version); err != nil {
+		return nil, err
+	}
+	zipHash, err := GoModuleZipHash(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	if a.Sum != "" && a.Sum != zipHash {
+		return nil, fmt.Errorf("%w: go module %s@%s expected %s, got %s", ErrChecksumMismatch, a.ModulePath, version, a.Sum, zipHash)
+	}
+	log.Printf("go module %s@%s downloaded, hash %s\n", a.ModulePath, version, zipHash)
+	if err := os.WriteFile(filepath.Join(dir, escapedVersion+".ziphash"), []byte(zipHash), 0644); err != nil {
+		return nil, err
+	}
+	return append(fileNames, escapedVersion+".ziphash"), nil
+}
+
+// resolveVersion превращает latest в версию через <module>/@latest
+func (a GoModuleArtifact) resolveVersion(ctx context.Context, proxyUrl string) (string, error) {
+	if a.Version != "" && a.Version != GoModuleLatestVersion {
+		return a.Version, nil
+	}
+	download, err := OpenNexusDownload(ctx, proxyUrl+"@latest", 0, "")
+	if err != nil {
+		return "", goProxyError(a.ModulePath, err)
+	}
+	defer download.Stream.Close()
+	var info GoModuleInfo
+	if err := json.NewDecoder(download.Stream).Decode(&info); err != nil {
+		log.Println("failed to decode latest version of go module", a.ModulePath, err)
+		return "", err
+	}
+	log.Printf("latest version of go module %s resolved to %s\n", a.ModulePath, info.Version)
+	return info.Version, nil
+}
+
+func downloadGoProxyFile(ctx context.Context, fileUrl, filePath string) error {
+	download, err := OpenNexusDownload(ctx, fileUrl, 0, "")
+	if err != nil {
+		return goProxyError(fileUrl, err)
+	}
+	defer download.Stream.Close()
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(file, download.Stream)
+	return err
+}
+
+// goProxyError - GOPROXY отвечает 404 или 410, если модуля или версии нет
+func goProxyError(resourceName string, err error) error {
+	var statusErr *HttpStatusError
+	if errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusGone) {
+		return &ArtifactNotFoundError{Message: fmt.Sprintf("go module %s not found in Nexus", resourceName)}
+	}
+	return err
+}
+
+// EscapeGoModulePath кодирует путь модуля для GOPROXY: заглавные буквы заменяются на '!' и строчную букву
+func EscapeGoModulePath(modulePath string) (string, error) {
+	if modulePath == "" || strings.Contains(modulePath, "!") || strings.Contains(modulePath, "..") {
+		return "", fmt.Errorf("invalid go module path '%s'", modulePath)
+	}
+	return escapeGoModuleCase(modulePath), nil
+}
+
+// EscapeGoModuleVersion кодирует версию для GOPROXY так же, как путь модуля: v1.0.0-RC1 -> v1.0.0-!r!c1
+func EscapeGoModuleVersion(version string) (string, error) {
+	if version == "" || strings.ContainsAny(version, "!/\\") || strings.Contains(version, "..") {
+		return "", fmt.Errorf("invalid go module version '%s'", version)
+	}
+	return escapeGoModuleCase(version), nil
+}
+
+// UnescapeGoModuleVersion восстанавливает версию, закодированную EscapeGoModuleVersion
+func UnescapeGoModuleVersion(escapedVersion string) (string, error) {
+	var builder strings.Builder
+	escaped := false
+	for _, r := range escapedVersion {
+		switch {
+		case escaped && r >= 'a' && r <= 'z':
+			builder.WriteRune(r - ('a' - 'A'))
+			escaped = false
+		case escaped || r >= 'A' && r <= 'Z':
+			return "", fmt.Errorf("invalid escaped go module version '%s'", escapedVersion)
+		case r == '!':
+			escaped = true
+		default:
+			builder.WriteRune(r)
+		}
+	}
+	if escaped || builder.Len() == 0 {
+		return "", fmt.Errorf("invalid escaped go module version '%s'", escapedVersion)
+	}
+	return builder.String(), nil
+}
+
+func escapeGoModuleCase(value string) string {
+	var builder strings.Builder
+	for _, r := range value {
+		if r >= 'A' && r <= 'Z' {
+			builder.WriteByte('!')
+			builder.WriteRune(r + ('a' - 'A'))
+		} else {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+// GoModuleZipHash считает хеш zip архива модуля в формате go.sum (h1:, как dirhash.Hash1)
+func GoModuleZipHash(zipPath string) (string, error) {
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return "", err
+	}
+	defer zipReader.Close()
+
+	files := map[string]*zip.File{}
+	var names []string
+	for _, file := range zipReader.File {
+		if strings.Contains(file.Name, "\n") {
+			return "", fmt.Errorf("file name with newline in go module zip %s", zipPath)
+		}
+		files[file.Name] = file
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+
+	summary := sha256.New()
+	for _, name := range names {
+		reader, err := files[name].Open()
+		if err != nil {
+			return "", err
+		}
+		fileHash := sha256.New()
+		_, err = io.Copy(fileHash, reader)
+		reader.Close()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(summary, "%x  %s\n", fileHash.Sum(nil), name)
+	}
+	return "h1:" + base64.StdEncoding.EncodeToString(summary.Sum(nil)), nil
+}
+
+// CheckGoModuleZip проверяет, что все файлы архива лежат в каталоге <module>@<version>/
+func CheckGoModuleZip(zipPath, modulePath, version string) error {
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer zipReader.Close()
+	prefix := modulePath + "@" + version + "/"
+	for _, file := range zipReader.File {
+		if !strings.HasPrefix(file.Name, prefix) {
+			return fmt.Errorf("file %s in go module zip is outside of %s", file.Name, prefix)
+		}
+	}
+	return nil
+}
+
+func (a GoModuleArtifact) DeliverCleanup() error {
+	return nil
+}
+
+func (a GoModuleArtifact) DeployCleanup() error {
+	return nil
+}
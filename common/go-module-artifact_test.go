@@ -0,0 +1,79 @@
+package common
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestZip(t *testing.T, files map[string]string, order []string) string {
+	t.Helper()
+	zipPath := filepath.Join(t.TempDir(), "module.zip")
+	file, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	writer := zip.NewWriter(file)
+	for _, name := range order {
+		entry, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := entry.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return zipPath
+}
+
+func TestGoModuleZipHash(t *testing.T) {
+	files := map[string]string{
+		"example.com/m@v1.0.0/go.mod": "module example.com/m\n",
+		"example.com/m@v1.0.0/m.go":   "package m\n",
+	}
+	// хеш не зависит от порядка файлов в архиве
+	for _, order := range [][]string{
+		{"example.com/m@v1.0.0/go.mod", "example.com/m@v1.0.0/m.go"},
+		{"example.com/m@v1.0.0/m.go", "example.com/m@v1.0.0/go.mod"},
+	} {
+		hash, err := GoModuleZipHash(writeTestZip(t, files, order))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "h1:fCHMqo5ggHEQvwcrsN81zr5orRk5lClR36KRHpfUjKg="; hash != want {
+			t.Errorf("GoModuleZipHash(%v) = %s, want %s", order, hash, want)
+		}
+	}
+
+	badName := "example.com/m@v1.0.0/a\nb"
+	if _, err := GoModuleZipHash(writeTestZip(t, map[string]string{badName: ""}, []string{badName})); err == nil {
+		t.Error("file name with newline is accepted")
+	}
+}
+
+func TestCheckGoModuleZip(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		wantErr bool
+	}{
+		{"module files", []string{"example.com/m@v1.0.0/go.mod", "example.com/m@v1.0.0/m.go"}, false},
+		{"other version", []string{"example.com/m@v1.0.0/go.mod", "example.com/m@v1.0.1/m.go"}, true},
+		{"other module", []string{"example.com/mod@v1.0.0/go.mod"}, true},
+	}
+	for _, test := range tests {
+		files := map[string]string{}
+		for _, name := range test.files {
+			files[name] = ""
+		}
+		err := CheckGoModuleZip(writeTestZip(t, files, test.files), "example.com/m", "v1.0.0")
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: CheckGoModuleZip() error = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// Суффикс архива, в котором чарт и его образы передаются через шару
+	HelmBundleSuffix = ".helm.tar"
+	// Описание содержимого архива
+	HelmBundleManifestName = "helm-bundle.json"
+)
+
+var helmImageRegexp = regexp.MustCompile(`(?m)^\s*-?\s*image:\s*["']?([^"'\s]+)["']?\s*$`)
+
+// HelmArtifact - helm чарт из Nexus вместе с образами, на которые он ссылается.
+// Images - образы, указанные явно, RenderImages - найти образы в манифестах, отрендеренных `helm template`
+type HelmArtifact struct {
+	ChartName    string
+	Version      string
+	Images       []string
+	RenderImages bool
+}
+
+// HelmBundleManifest - содержимое helm-bundle.json
+type HelmBundleManifest struct {
+	Chart  string            `json:"chart"`
+	Images []HelmBundleImage `json:"images,omitempty"`
+}
+
+type HelmBundleImage struct {
+	// Имя образа относительно registry, как у DockerArtifact
+	Image string `json:"image"`
+	File  string `json:"file"`
+}
+
+func (a HelmArtifact) GetType() ArtifactType {
+	return HELM
+}
+
+func (a HelmArtifact) GetOriginalResourceName() string {
+	if a.Version == "" {
+		return a.ChartName
+	}
+	return a.ChartName + ":" + a.Version
+}
+
+func (a HelmArtifact) GetArtifactNameAndStream(ctx context.Context) (ArtifactNameAndStream, error) {
+	tempDir, err := os.MkdirTemp("", "helm_")
+	if err != nil {
+		log.Println("failed to create temp dir", err)
+		return ArtifactNameAndStream{}, err
+	}
+	manifest, err := a.prepareBundle(ctx, tempDir)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return ArtifactNameAndStream{}, err
+	}
+
+	fileNames := []string{HelmBundleManifestName, manifest.Chart}
+	for _, bundleImage := range manifest.Images {
+		fileNames = append(fileNames, bundleImage.File)
+	}
+	return openTarBundle(tempDir, strings.TrimSuffix(manifest.Chart, ".tgz")+HelmBundleSuffix, fileNames)
+}
+
+// prepareBundle скачивает чарт и образы в dir и пишет helm-bundle.json
+func (a HelmArtifact) prepareBundle(ctx context.Context, dir string) (HelmBundleManifest, error) {
+	chartFileName, err := a.downloadChart(ctx, dir)
+	if err != nil {
+		return HelmBundleManifest{}, err
+	}
+	manifest := HelmBundleManifest{Chart: chartFileName}
+
+	images := a.Images
+	if a.RenderImages {
+		renderedImages, err := renderChartImages(ctx, filepath.Join(dir, chartFileName))
+		if err != nil {
+			return HelmBundleManifest{}, err
+		}
+		images = append(images, renderedImages...)
+	}
+	images = normalizeHelmImages(images)
+	if len(images) > 0 && !StartupConfig.SendDockerEnabled {
+		return HelmBundleManifest{}, fmt.Errorf("chart %s references images, but property `send_docker_enabled` set to false", a.GetOriginalResourceName())
+	}
+	for _, imageName := range images {
+		dockerArtifact := DockerArtifact{ImageName: imageName}
+		if err := saveImage(ctx, dockerArtifact, filepath.Join(dir, dockerArtifact.GetDownloadFileName())); err != nil {
+			return HelmBundleManifest{}, err
+		}
+		manifest.Images = append(manifest.Images, HelmBundleImage{Image: imageName, File: dockerArtifact.GetDownloadFileName()})
+	}
+
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		return HelmBundleManifest{}, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, HelmBundleManifestName), content, 0644); err != nil {
+		return HelmBundleManifest{}, err
+	}
+	return manifest, nil
+}
+
+// downloadChart находит чарт в helm-репозитории Nexus и скачивает его в dir. Без версии берётся последняя
+func (a HelmArtifact) downloadChart(ctx context.Context, dir string) (string, error) {
+	params := url.Values{}
+	params.Set("repository", StartupConfig.SendNexusHelmRepository)
+	params.Set("name", a.ChartName)
+	if a.Version != "" {
+		params.Set("version", a.Version)
+	}
+	params.Set("sort", "version")
+	params.Set("direction", "desc")
+	searchResponse, err := SearchNexus(ctx, params)
+	if err != nil {
+		return "", err
+	}
+	if len(searchResponse.Items) == 0 {
+		msg := fmt.Sprintf("helm chart %s not found in Nexus", a.GetOriginalResourceName())
+		log.Println(msg)
+		return "", &ArtifactNotFoundError{Message: msg}
+	}
+	for _, asset := range searchResponse.Items[0].Assets {
+		if !strings.HasSuffix(asset.DownloadUrl, ".tgz") {
+			continue
+		}
+		download, err := OpenNexusAsset(ctx, asset, 0, "")
+		if err != nil {
+			return "", err
+		}
+		defer download.Stream.Close()
+		chartFile, err := os.Create(filepath.Join(dir, download.Name))
+		if err != nil {
+			return "", err
+		}
+		defer chartFile.Close()
+		if _, err := io.Copy(chartFile, download.Stream); err != nil {
+			log.Printf("failed to download helm chart %s: %v\n", a.GetOriginalResourceName(), err)
+			return "", err
+		}
+		log.Printf("helm chart %s downloaded to %s\n", a.GetOriginalResourceName(), chartFile.Name())
+		return download.Name, nil
+	}
+	msg := fmt.Sprintf("no archive found for helm chart %s", a.GetOriginalResourceName())
+	log.Println(msg)
+	return "", &ArtifactNotFoundError{Message: msg}
+}
+
+// renderChartImages рендерит чарт со значениями по умолчанию через `helm template` и возвращает образы из манифестов
+func renderChartImages(ctx context.Context, chartFilePath string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "helm", "template", "cd-release", chartFilePath)
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			log.Println("helm template failed:", string(exitErr.Stderr))
+		}
+		log.Printf("failed to render helm chart %s: %v\n", chartFilePath, err)
+		return nil, fmt.Errorf("failed to render helm chart: %w", err)
+	}
+	var images []string
+	for _, match := range helmImageRegexp.FindAllStringSubmatch(string(output), -1) {
+		images = append(images, match[1])
+	}
+	log.Printf("images found in helm chart %s: %v\n", chartFilePath, images)
+	return images, nil
+}
+
+// normalizeHelmImages убирает дубликаты и префикс `send_docker_registry`, чтобы имена образов были такими же, как у DockerArtifact
+func normalizeHelmImages(images []string) []string {
+	unique := map[string]bool{}
+	for _, imageName := range images {
+		imageName = strings.TrimSpace(imageName)
+		if StartupConfig.SendDockerRegistry != "" {
+			imageName = strings.TrimPrefix(imageName, StartupConfig.SendDockerRegistry+"/")
+		}
+		if imageName != "" {
+			unique[imageName] = true
+		}
+	}
+	result := make([]string, 0, len(unique))
+	for imageName := range unique {
+		result = append(result, imageName)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// saveImage скачивает образ из registry SEND и сохраняет его в файл.
+// Образ удаляется из docker после сохранения
+func saveImage(ctx context.Context, artifact DockerArtifact, filePath string) error {
+	stream, err := artifact.GetStream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	defer func() {
+		if err := artifact.DeliverCleanup(); err != nil {
+			log.Printf("failed to remove image %s. Error: %v\n", artifact.ImageName, err)
+		}
+	}()
+	imageFile, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer imageFile.Close()
+	if _, err := io.Copy(imageFile, stream); err != nil {
+		log.Printf("failed to save image %s: %v\n", artifact.ImageName, err)
+		return err
+	}
+	return nil
+}
+
+func (a HelmArtifact) DeliverCleanup() error {
+	return nil
+}
+
+func (a HelmArtifact) DeployCleanup() error {
+	return nil
+}
@@ -0,0 +1,362 @@
+package common
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Суффикс tar архива со всеми файлами модели
+	HfBundleSuffix = ".hf.tar"
+	// Описание файлов модели, первая запись архива
+	HfBundleManifestName = "hf-model.json"
+	// Префикс валидатора докачки архива, дальше идёт sha256 манифеста
+	hfBundleValidatorPrefix = "hf-manifest:"
+	DEFAULT_HF_REVISION     = "main"
+)
+
+// GetHfRepoPrefix возвращает префикс пути репозитория по типу, как в url huggingface.co
+func GetHfRepoPrefix(repoType string) (string, bool) {
+	switch repoType {
+	case "", "model":
+		return "", true
+	case "dataset":
+		return "datasets/", true
+	case "space":
+		return "spaces/", true
+	}
+	return "", false
+}
+
+// HfModelManifest - содержимое hf-model.json
+type HfModelManifest struct {
+	Model    string `json:"model"`
+	RepoType string `json:"repoType,omitempty"`
+	// Revision пустая, если файлы модели лежат в старой раскладке <model>/<path>
+	Revision string        `json:"revision,omitempty"`
+	Files    []HfModelFile `json:"files"`
+}
+
+// RepoPath возвращает каталог файлов в raw репозитории: <model> в старой раскладке,
+// иначе [datasets/|spaces/]<repo>/resolve/<revision>, как в url huggingface.co
+func (m HfModelManifest) RepoPath() string {
+	if m.Revision == "" {
+		return m.Model
+	}
+	prefix, _ := GetHfRepoPrefix(m.RepoType)
+	return prefix + m.Model + "/resolve/" + m.Revision
+}
+
+// HfModelFile - файл модели, Path - путь относительно каталога модели, например "onnx/model.onnx"
+type HfModelFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256,omitempty"`
+	url    string
+}
+
+// searchNexusAssets возвращает ассеты всех страниц поиска Nexus
+func searchNexusAssets(ctx context.Context, searchUrl string) ([]NexusItemAsset, error) {
+	var assets []NexusItemAsset
+	continuationToken := ""
+	for {
+		pageUrl := searchUrl
+		if continuationToken != "" {
+			pageUrl += "&continuationToken=" + url.QueryEscape(continuationToken)
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", pageUrl, nil)
+		if err != nil {
+			log.Printf("failed to create request; err: %v\n", err)
+			return nil, err
+		}
+		req.SetBasicAuth(StartupConfig.SendNexusLogin, StartupConfig.SendNexusPassword)
+		resp, err := HttpClient.Do(req)
+		if err != nil {
+			log.Printf("search request %s failed; err: %v\n", pageUrl, err)
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			log.Printf("search request %s failed with status %d\n", pageUrl, resp.StatusCode)
+			return nil, &HttpStatusError{Url: pageUrl, StatusCode: resp.StatusCode}
+		}
+		var searchResponse NexusSearchResponse
+		err = json.NewDecoder(resp.Body).Decode(&searchResponse)
+		resp.Body.Close()
+		if err != nil {
+			log.Println("failed to decode nexus search response", err)
+			return nil, err
+		}
+		for _, item := range searchResponse.Items {
+			assets = append(assets, item.Assets...)
+		}
+		if searchResponse.ContinuationToken == "" {
+			return assets, nil
+		}
+		continuationToken = searchResponse.ContinuationToken
+	}
+}
+
+// getHfModelManifest ищет файлы ревизии репозитория и отбирает их по шаблонам Include и Exclude.
+// Для модели без заданной ревизии, если ревизии main нет, файлы ищутся в старой раскладке <model>/<path>
+func getHfModelManifest(ctx context.Context, artifact HfArtifact) (HfModelManifest, error) {
+	manifest := HfModelManifest{Model: artifact.ModelName, RepoType: artifact.RepoType, Revision: artifact.Revision}
+	if manifest.Revision == "" {
+		manifest.Revision = DEFAULT_HF_REVISION
+	}
+	files, err := searchHfFiles(ctx, manifest.RepoPath())
+	if err != nil {
+		return manifest, err
+	}
+	if len(files) == 0 && artifact.Revision == "" && (artifact.RepoType == "" || artifact.RepoType == "model") {
+		manifest.Revision = ""
+		if files, err = searchHfFiles(ctx, manifest.RepoPath()); err != nil {
+			return manifest, err
+		}
+	}
+	for _, file := range files {
+		// в старой раскладке каталог resolve/ - это ревизии в новой раскладке, а не файлы модели
+		if manifest.Revision == "" && strings.HasPrefix(file.Path, "resolve/") {
+			continue
+		}
+		if matchHfPatterns(file.Path, artifact.Include, true) && !matchHfPatterns(file.Path, artifact.Exclude, false) {
+			manifest.Files = append(manifest.Files, file)
+		}
+	}
+	if len(files) > 0 && len(manifest.Files) == 0 {
+		log.Printf("all %d files of %s are excluded by include/exclude patterns\n", len(files), artifact.GetOriginalResourceName())
+	}
+	return manifest, nil
+}
+
+// searchHfFiles ищет все файлы каталога repoPath (group=/<repoPath>) и вложенных каталогов
+func searchHfFiles(ctx context.Context, repoPath string) ([]HfModelFile, error) {
+	baseUrl := fmt.Sprintf("%s/service/rest/v1/search?repository=%s&group=", strings.TrimSuffix(StartupConfig.SendNexusUrl, "/"), url.QueryEscape(StartupConfig.SendNexusHFRepository))
+	seen := map[string]bool{}
+	var files []HfModelFile
+	for _, group := range []string{"/" + repoPath, "/" + repoPath + "/*"} {
+		assets, err := searchNexusAssets(ctx, baseUrl+url.QueryEscape(group))
+		if err != nil {
+			return nil, err
+		}
+		for _, asset := range assets {
+			relativePath := strings.TrimPrefix(strings.TrimPrefix(asset.Path, "/"), repoPath+"/")
+			if seen[relativePath] || relativePath == "" || strings.HasSuffix(relativePath, "/") {
+				continue
+			}
+			seen[relativePath] = true
+			files = append(files, HfModelFile{
+				Path:   relativePath,
+				Size:   asset.FileSize,
+				Sha256: asset.Checksum["sha256"],
+				url:    asset.DownloadUrl,
+			})
+		}
+	}
+	// порядок файлов должен быть одинаковым при докачке
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// matchHfPatterns проверяет путь по шаблонам fnmatch, как huggingface_hub: '*' совпадает и с '/',
+// шаблон с '/' на конце означает весь каталог. Пустой список шаблонов - emptyResult
+func matchHfPatterns(filePath string, patterns []string, emptyResult bool) bool {
+	if len(patterns) == 0 {
+		return emptyResult
+	}
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "*"
+		}
+		// некорректный шаблон ни с чем не совпадает
+		if patternRegexp, err := regexp.Compile(hfPatternToRegexp(pattern)); err == nil && patternRegexp.MatchString(filePath) {
+			return true
+		}
+	}
+	return false
+}
+
+func hfPatternToRegexp(pattern string) string {
+	var result strings.Builder
+	result.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			result.WriteString(".*")
+		case '?':
+			result.WriteString(".")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				result.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			result.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			result.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	result.WriteString("$")
+	return result.String()
+}
+
+// hfBundleSegment - часть архива: заголовок, манифест или выравнивание в памяти либо файл модели из Nexus
+type hfBundleSegment struct {
+	data []byte
+	file *HfModelFile
+}
+
+func (s hfBundleSegment) size() int64 {
+	if s.file != nil {
+		return s.file.Size
+	}
+	return int64(len(s.data))
+}
+
+// tarHeaderBytes возвращает заголовок записи tar архива (вместе с PAX записями для длинных имён и больших файлов)
+func tarHeaderBytes(name string, size int64) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := tar.NewWriter(&buffer).WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, ModTime: time.Unix(0, 0)})
+	return buffer.Bytes(), err
+}
+
+func tarPadding(size int64) []byte {
+	return make([]byte, tarEntrySize(size)-tarBlockSize-size)
+}
+
+// hfBundleSegments раскладывает архив модели на части. Раскладка зависит только от манифеста,
+// поэтому архив можно отдавать с любого смещения
+func hfBundleSegments(manifest HfModelManifest, manifestContent []byte) ([]hfBundleSegment, error) {
+	header, err := tarHeaderBytes(HfBundleManifestName, int64(len(manifestContent)))
+	if err != nil {
+		return nil, err
+	}
+	segments := []hfBundleSegment{{data: header}, {data: manifestContent}, {data: tarPadding(int64(len(manifestContent)))}}
+	for i := range manifest.Files {
+		file := &manifest.Files[i]
+		header, err := tarHeaderBytes(file.Path, file.Size)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, hfBundleSegment{data: header}, hfBundleSegment{file: file}, hfBundleSegment{data: tarPadding(file.Size)})
+	}
+	return append(segments, hfBundleSegment{data: make([]byte, 2*tarBlockSize)}), nil
+}
+
+// openHfBundle отдаёт все файлы модели одним tar архивом, начиная с offset, если манифест не изменился
+func (a HfArtifact) openHfBundle(ctx context.Context, offset int64, validator string) (ArtifactNameAndStream, error) {
+	manifest, err := getHfModelManifest(ctx, a)
+	if err != nil {
+		return ArtifactNameAndStream{}, err
+	}
+	if len(manifest.Files) == 0 {
+		msg := fmt.Sprintf("Model '%s' not found in Nexus huggingface-hosted", a.GetOriginalResourceName())
+		log.Println(msg)
+		return ArtifactNameAndStream{}, &ArtifactNotFoundError{Message: msg}
+	}
+	manifestContent, err := json.Marshal(manifest)
+	if err != nil {
+		return ArtifactNameAndStream{}, err
+	}
+	manifestHash := sha256.Sum256(manifestContent)
+	bundleValidator := hfBundleValidatorPrefix + hex.EncodeToString(manifestHash[:])
+	segments, err := hfBundleSegments(manifest, manifestContent)
+	if err != nil {
+		return ArtifactNameAndStream{}, err
+	}
+	var size int64
+	for _, segment := range segments {
+		size += segment.size()
+	}
+	if validator != bundleValidator || offset >= size {
+		// файлы модели изменились, архив собирается заново
+		offset = 0
+	}
+	log.Printf("model %s: %d files, %d bytes\n", a.GetOriginalResourceName(), len(manifest.Files), size)
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeHfBundle(ctx, writer, segments, offset))
+	}()
+	return ArtifactNameAndStream{
+		Name:      strings.ReplaceAll(manifest.RepoPath(), "/", "--") + HfBundleSuffix,
+		Stream:    reader,
+		Offset:    offset,
+		Size:      size,
+		Validator: bundleValidator,
+	}, nil
+}
+
+// writeHfBundle пишет архив, пропуская первые offset байт. Файлы, целиком попавшие в пропущенную часть, не скачиваются
+func writeHfBundle(ctx context.Context, writer io.Writer, segments []hfBundleSegment, offset int64) error {
+	for _, segment := range segments {
+		size := segment.size()
+		if offset >= size {
+			offset -= size
+			continue
+		}
+		if segment.file == nil {
+			if _, err := writer.Write(segment.data[offset:]); err != nil {
+				return err
+			}
+		} else if err := copyHfModelFile(ctx, writer, segment.file, offset); err != nil {
+			return err
+		}
+		offset = 0
+	}
+	return nil
+}
+
+// copyHfModelFile скачивает файл модели и пишет его, начиная со смещения skip.
+// sha256 проверяется, только если файл передаётся целиком, RECEIVE проверяет каждый файл сам
+func copyHfModelFile(ctx context.Context, writer io.Writer, file *HfModelFile, skip int64) error {
+	download, err := OpenNexusDownload(ctx, file.url, 0, "")
+	if err != nil {
+		return err
+	}
+	defer download.Stream.Close()
+	var fileHash hash.Hash
+	stream := io.Reader(download.Stream)
+	if skip > 0 {
+		if _, err := io.CopyN(io.Discard, stream, skip); err != nil {
+			return err
+		}
+	} else {
+		fileHash = sha256.New()
+		stream = io.TeeReader(stream, fileHash)
+	}
+	written, err := io.Copy(writer, io.LimitReader(stream, file.Size-skip))
+	if err != nil {
+		log.Printf("failed to download %s: %v\n", file.Path, err)
+		return err
+	}
+	if written != file.Size-skip {
+		return fmt.Errorf("file %s is truncated: expected %d bytes, got %d", file.Path, file.Size, written+skip)
+	}
+	if fileHash == nil || file.Sha256 == "" {
+		return nil
+	}
+	if actual := hex.EncodeToString(fileHash.Sum(nil)); actual != file.Sha256 {
+		return fmt.Errorf("%w: %s expected %s, got %s", ErrChecksumMismatch, file.Path, file.Sha256, actual)
+	}
+	return nil
+}
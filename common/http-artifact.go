@@ -1,45 +1,80 @@
 package common
 
 import (
-	"io"
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"strings"
 )
 
+// HttpArtifact - произвольный файл (тип RAW).
+// DownloadFilePath - url файла или путь внутри raw-репозитория Nexus (`send_nexus_raw_repository`).
+// Directory - каталог в raw-hosted репозитории на стороне RECEIVE, по умолчанию `receive_nexus_raw_directory`
 type HttpArtifact struct {
 	DownloadFilePath string
+	Directory        string
+}
+
+func (a HttpArtifact) GetType() ArtifactType {
+	return RAW
 }
 
 func (a HttpArtifact) GetOriginalResourceName() string {
 	return a.DownloadFilePath
 }
+
+// GetDownloadFileName - имя файла из url или <jobId>.file
 func (a HttpArtifact) GetDownloadFileName(jobId string) string {
-	downloadUrl, err := url.Parse(a.DownloadFilePath)
-	if err != nil {
-		log.Println(a.DownloadFilePath, "is not a valid url")
+	fileName, err := GetDownloadFileNameFromUrl(a.GetDownloadUrl())
+	if err != nil || fileName == "" {
 		return jobId + ".file"
 	}
-	pathParts := strings.Split(downloadUrl.Path, "/")
-	fileName := pathParts[len(pathParts)-1]
 	return fileName
 }
 
-func (a HttpArtifact) GetStream() (io.ReadCloser, error) {
-	req, err := http.NewRequest("GET", a.DownloadFilePath, nil)
-	if err != nil {
-		log.Println("failed to create request", err)
-		return nil, err
+// GetDownloadUrl возвращает url файла. Путь без схемы считается путём в raw-репозитории Nexus
+func (a HttpArtifact) GetDownloadUrl() string {
+	if a.IsUrl() {
+		return a.DownloadFilePath
 	}
-	resp, err := HttpClient.Do(req)
-	if err != nil {
-		log.Println("failed to download remote file", err)
-		return nil, err
+	return fmt.Sprintf("%s/repository/%s/%s", StartupConfig.SendNexusUrl, strings.Trim(StartupConfig.SendNexusRawRepository, "/"),
+		strings.TrimPrefix(a.DownloadFilePath, "/"))
+}
+
+func (a HttpArtifact) IsUrl() bool {
+	lowerPath := strings.ToLower(a.DownloadFilePath)
+	return strings.HasPrefix(lowerPath, "http://") || strings.HasPrefix(lowerPath, "https://")
+}
+
+func (a HttpArtifact) GetArtifactNameAndStream(ctx context.Context) (ArtifactNameAndStream, error) {
+	return a.GetArtifactNameAndStreamFrom(ctx, 0, "")
+}
+
+func (a HttpArtifact) GetArtifactNameAndStreamFrom(ctx context.Context, offset int64, validator string) (ArtifactNameAndStream, error) {
+	downloadUrl := a.GetDownloadUrl()
+	if _, err := url.ParseRequestURI(downloadUrl); err != nil {
+		log.Println(downloadUrl, "is not a valid url")
+		return ArtifactNameAndStream{}, err
+	}
+	// учётные данные Nexus нужны только для файлов из Nexus
+	nexusAuth := StartupConfig.SendNexusUrl != "" && strings.HasPrefix(downloadUrl, StartupConfig.SendNexusUrl+"/")
+	log.Printf("downloading raw file %s\n", downloadUrl)
+	artifactNameAndStream, err := OpenHttpDownload(ctx, downloadUrl, offset, validator, nexusAuth)
+	var statusErr *HttpStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return ArtifactNameAndStream{}, &ArtifactNotFoundError{Message: fmt.Sprintf("raw file %s not found", downloadUrl)}
 	}
-	return resp.Body, nil
+	// без имени из Content-Disposition и url имя файла строится по jobId (GetDownloadFileName)
+	return artifactNameAndStream, err
 }
 
 func (a HttpArtifact) DeliverCleanup() error {
 	return nil
 }
+
+func (a HttpArtifact) DeployCleanup() error {
+	return nil
+}
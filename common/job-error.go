@@ -0,0 +1,107 @@
+package common
+
+import (
+	"errors"
+	"github.com/docker/docker/errdefs"
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+type JobErrorCode string
+
+// JobStage - этап задания, на котором произошла ошибка
+type JobStage string
+
+const (
+	ARTIFACT_NOT_FOUND JobErrorCode = "ARTIFACT_NOT_FOUND"
+	HTTP_ERROR         JobErrorCode = "HTTP_ERROR"
+	NETWORK_ERROR      JobErrorCode = "NETWORK_ERROR"
+	NO_SPACE           JobErrorCode = "NO_SPACE"
+	CHECKSUM_MISMATCH  JobErrorCode = "CHECKSUM_MISMATCH"
+	FILE_SYSTEM_ERROR  JobErrorCode = "FILE_SYSTEM_ERROR"
+	INTERNAL_ERROR     JobErrorCode = "INTERNAL_ERROR"
+	// DEPENDENCY_CONFLICT - зависимости python-пакета не удалось разрешить без перебора версий
+	DEPENDENCY_CONFLICT JobErrorCode = "DEPENDENCY_CONFLICT"
+	// DOCKER_LAYER_MISSING - RECEIVE не смог подключить слой по устаревшему списку блобов, SEND отправляет образ заново со всеми слоями
+	DOCKER_LAYER_MISSING JobErrorCode = "DOCKER_LAYER_MISSING"
+
+	STAGE_PREPARE  JobStage = "PREPARE"
+	STAGE_DOWNLOAD JobStage = "DOWNLOAD"
+	STAGE_RENAME   JobStage = "RENAME"
+	STAGE_CHUNKING JobStage = "CHUNKING"
+	STAGE_MANIFEST JobStage = "MANIFEST"
+	STAGE_META     JobStage = "META_WRITING"
+	STAGE_DEPLOY   JobStage = "DEPLOY"
+)
+
+// JobError описывает причину неудачи задания
+type JobError struct {
+	Code    JobErrorCode `json:"code"`
+	Message string       `json:"message"`
+	Stage   JobStage     `json:"stage"`
+	Dttm    time.Time    `json:"dttm"`
+}
+
+// StatusTransition - запись истории статусов задания
+type StatusTransition struct {
+	Status     CdStatus  `json:"status"`
+	StatusDttm time.Time `json:"statusDttm"`
+}
+
+// ArtifactNotFoundError - артефакт не найден в Nexus или registry
+type ArtifactNotFoundError struct {
+	Message string
+}
+
+func (e *ArtifactNotFoundError) Error() string {
+	return e.Message
+}
+
+// DependencyConflictError - требования к версиям пакета противоречат уже выбранной версии
+type DependencyConflictError struct {
+	Message string
+}
+
+func (e *DependencyConflictError) Error() string {
+	return e.Message
+}
+
+func NewJobError(stage JobStage, err error) *JobError {
+	return &JobError{Code: GetErrorCode(err), Message: err.Error(), Stage: stage, Dttm: time.Now()}
+}
+
+// GetErrorCode относит ошибку к одной из категорий JobErrorCode
+func GetErrorCode(err error) JobErrorCode {
+	var notFoundErr *ArtifactNotFoundError
+	var conflictErr *DependencyConflictError
+	var statusErr *HttpStatusError
+	var pathErr *fs.PathError
+	switch {
+	case errors.Is(err, ErrDockerLayerMissing):
+		return DOCKER_LAYER_MISSING
+	case errors.As(err, &notFoundErr) || errdefs.IsNotFound(err):
+		return ARTIFACT_NOT_FOUND
+	case errors.As(err, &conflictErr):
+		return DEPENDENCY_CONFLICT
+	case errors.Is(err, ErrChecksumMismatch):
+		return CHECKSUM_MISMATCH
+	case errors.As(err, &statusErr):
+		return HTTP_ERROR
+	case errors.Is(err, syscall.ENOSPC):
+		return NO_SPACE
+	case errors.As(err, &pathErr):
+		return FILE_SYSTEM_ERROR
+	case IsRetryable(err):
+		return NETWORK_ERROR
+	}
+	return INTERNAL_ERROR
+}
+
+// AppendStatusHistory добавляет в историю переход в статус, если он отличается от последнего
+func AppendStatusHistory(history []StatusTransition, status CdStatus, statusDttm time.Time) []StatusTransition {
+	if len(history) > 0 && history[len(history)-1].Status == status {
+		return history
+	}
+	return append(history, StatusTransition{Status: status, StatusDttm: statusDttm})
+}
@@ -0,0 +1,31 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAppendStatusHistory(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var history []StatusTransition
+	statuses := []CdStatus{QUEUED, DOWNLOADING, DOWNLOADING, INTERRUPTED, DOWNLOADING, DOWNLOADING_DONE, DOWNLOADING_DONE, DEPLOYED}
+	for i, status := range statuses {
+		history = AppendStatusHistory(history, status, start.Add(time.Duration(i)*time.Minute))
+	}
+	want := []StatusTransition{
+		{QUEUED, start},
+		{DOWNLOADING, start.Add(time.Minute)},
+		{INTERRUPTED, start.Add(3 * time.Minute)},
+		{DOWNLOADING, start.Add(4 * time.Minute)},
+		{DOWNLOADING_DONE, start.Add(5 * time.Minute)},
+		{DEPLOYED, start.Add(7 * time.Minute)},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("history = %v, want %v", history, want)
+	}
+	for i := range want {
+		if history[i].Status != want[i].Status || !history[i].StatusDttm.Equal(want[i].StatusDttm) {
+			t.Errorf("history[%d] = %v, want %v", i, history[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package common
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	DEFAULT_MAVEN_EXTENSION = "jar"
+	// Суффикс архива, в котором артефакт, его POM и контрольные суммы передаются через шару
+	MavenBundleSuffix = ".maven.tar"
+)
+
+// Контрольные суммы, которые Nexus хранит рядом с файлами maven2 репозитория
+var MavenChecksumExtensions = []string{".sha1", ".md5", ".sha256", ".sha512"}
+
+// MavenArtifact - артефакт из maven2 репозитория Nexus.
+// Основной файл, POM и их контрольные суммы передаются одним tar архивом
+type MavenArtifact struct {
+	GroupId    string
+	ArtifactId string
+	Version    string
+	Classifier string
+	// По умолчанию jar
+	Extension string
+}
+
+func (a MavenArtifact) GetType() ArtifactType {
+	return MAVEN
+}
+
+// GetOriginalResourceName возвращает координаты вида groupId:artifactId:version[:classifier]@extension
+func (a MavenArtifact) GetOriginalResourceName() string {
+	name := a.GroupId + ":" + a.ArtifactId + ":" + a.Version
+	if a.Classifier != "" {
+		name += ":" + a.Classifier
+	}
+	return name + "@" + a.GetExtension()
+}
+
+func (a MavenArtifact) GetExtension() string {
+	if a.Extension == "" {
+		return DEFAULT_MAVEN_EXTENSION
+	}
+	return a.Extension
+}
+
+// GetMainFileName возвращает имя основного файла для версии version
+func (a MavenArtifact) GetMainFileName(version string) string {
+	name := a.ArtifactId + "-" + version
+	if a.Classifier != "" {
+		name += "-" + a.Classifier
+	}
+	return name + "." + a.GetExtension()
+}
+
+func (a MavenArtifact) GetPomFileName(version string) string {
+	return a.ArtifactId + "-" + version + ".pom"
+}
+
+func (a MavenArtifact) GetArtifactNameAndStream(ctx context.Context) (ArtifactNameAndStream, error) {
+	params := url.Values{}
+	params.Set("repository", StartupConfig.SendNexusMavenRepository)
+	params.Set("maven.groupId", a.GroupId)
+	params.Set("maven.artifactId", a.ArtifactId)
+	params.Set("maven.baseVersion", a.Version)
+	params.Set("sort", "version")
+	params.Set("direction", "desc")
+	searchResponse, err := SearchNexus(ctx, params)
+	if err != nil {
+		return ArtifactNameAndStream{}, err
+	}
+	if len(searchResponse.Items) == 0 {
+		msg := fmt.Sprintf("maven artifact %s not found in Nexus", a.GetOriginalResourceName())
+		log.Println(msg)
+		return ArtifactNameAndStream{}, &ArtifactNotFoundError{Message: msg}
+	}
+	// для SNAPSHOT версий имена файлов содержат timestamp, он есть в версии компонента.
+	// Первым идёт последний snapshot
+	item := searchResponse.Items[0]
+	assets, err := a.selectAssets(item)
+	if err != nil {
+		return ArtifactNameAndStream{}, err
+	}
+
+	var size int64
+	for _, asset := range assets {
+		size += tarEntrySize(asset.FileSize)
+	}
+	size += 2 * tarBlockSize
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeMavenBundle(ctx, writer, assets))
+	}()
+	return ArtifactNameAndStream{
+		Name:   a.ArtifactId + "-" + item.Version + MavenBundleSuffix,
+		Stream: reader,
+		Size:   size,
+	}, nil
+}
+
+// selectAssets выбирает из ассетов компонента основной файл, POM и их контрольные суммы
+func (a MavenArtifact) selectAssets(item NexusItem) ([]NexusItemAsset, error) {
+	wanted := map[string]bool{}
+	for _, fileName := range []string{a.GetMainFileName(item.Version), a.GetPomFileName(item.Version)} {
+		wanted[fileName] = true
+		for _, checksumExtension := range MavenChecksumExtensions {
+			wanted[fileName+checksumExtension] = true
+		}
+	}
+	var assets []NexusItemAsset
+	var mainFound bool
+	for _, asset := range item.Assets {
+		fileName := path.Base(asset.Path)
+		if !wanted[fileName] {
+			continue
+		}
+		assets = append(assets, asset)
+		if fileName == a.GetMainFileName(item.Version) {
+			mainFound = true
+		}
+	}
+	if !mainFound {
+		msg := fmt.Sprintf("file %s not found in maven artifact %s", a.GetMainFileName(item.Version), a.GetOriginalResourceName())
+		log.Println(msg)
+		return nil, &ArtifactNotFoundError{Message: msg}
+	}
+	return assets, nil
+}
+
+// writeMavenBundle скачивает ассеты по очереди и пишет их в tar архив
+func writeMavenBundle(ctx context.Context, writer io.Writer, assets []NexusItemAsset) error {
+	tarWriter := tar.NewWriter(writer)
+	for _, asset := range assets {
+		download, err := OpenNexusDownload(ctx, asset.DownloadUrl, 0, "")
+		if err != nil {
+			return err
+		}
+		if download.Size == 0 {
+			// без Content-Length размер записи tar неизвестен, а fileSize из поиска Nexus может быть устаревшим
+			download, err = stageDownload(download)
+			if err != nil {
+				log.Printf("failed to stage %s for maven bundle: %v\n", asset.Path, err)
+				return err
+			}
+		}
+		err = tarWriter.WriteHeader(&tar.Header{Name: path.Base(asset.Path), Mode: 0644, Size: download.Size})
+		if err == nil {
+			_, err = io.Copy(tarWriter, download.Stream)
+		}
+		download.Stream.Close()
+		if err != nil {
+			log.Printf("failed to add %s to maven bundle: %v\n", asset.Path, err)
+			return err
+		}
+	}
+	return tarWriter.Close()
+}
+
+// stageDownload сохраняет скачиваемый файл во временный файл, чтобы узнать его размер.
+// Временный файл удаляется при закрытии возвращаемого потока
+func stageDownload(download ArtifactNameAndStream) (ArtifactNameAndStream, error) {
+	defer download.Stream.Close()
+	tempFile, err := os.CreateTemp("", "maven_")
+	if err != nil {
+		return download, err
+	}
+	staged := &tempFileReader{File: tempFile}
+	size, err := io.Copy(tempFile, download.Stream)
+	if err == nil {
+		_, err = tempFile.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		staged.Close()
+		return download, err
+	}
+	download.Stream, download.Size = staged, size
+	return download, nil
+}
+
+// tempFileReader удаляет временный файл после закрытия
+type tempFileReader struct {
+	*os.File
+}
+
+func (r *tempFileReader) Close() error {
+	err := r.File.Close()
+	os.Remove(r.Name())
+	return err
+}
+
+// IsMavenChecksumFile - файл с контрольной суммой (.sha1, .md5 и т.д.)
+func IsMavenChecksumFile(fileName string) bool {
+	for _, checksumExtension := range MavenChecksumExtensions {
+		if strings.HasSuffix(fileName, checksumExtension) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a MavenArtifact) DeliverCleanup() error {
+	return nil
+}
+
+func (a MavenArtifact) DeployCleanup() error {
+	return nil
+}
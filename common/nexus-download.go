@@ -0,0 +1,114 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ResumableArtifact - артефакт, скачивание которого можно продолжить с места обрыва
+type ResumableArtifact interface {
+	Artifact
+
+	// GetArtifactNameAndStreamFrom возвращает поток, начиная с offset.
+	// validator - ETag или Last-Modified частично скачанного файла, передаётся в If-Range.
+	// Если продолжить скачивание нельзя, поток начинается с начала файла и ArtifactNameAndStream.Offset = 0
+	GetArtifactNameAndStreamFrom(ctx context.Context, offset int64, validator string) (ArtifactNameAndStream, error)
+}
+
+// OpenNexusDownload скачивает файл из Nexus, начиная с offset, с помощью заголовков Range и If-Range
+func OpenNexusDownload(ctx context.Context, downloadUrl string, offset int64, validator string) (ArtifactNameAndStream, error) {
+	return OpenHttpDownload(ctx, downloadUrl, offset, validator, true)
+}
+
+// OpenHttpDownload работает как OpenNexusDownload, но учётные данные Nexus передаются только при nexusAuth = true,
+// чтобы не отправлять их на сторонние сервера
+func OpenHttpDownload(ctx context.Context, downloadUrl string, offset int64, validator string, nexusAuth bool) (ArtifactNameAndStream, error) {
+	downloadFileName, err := GetDownloadFileNameFromUrl(downloadUrl)
+	if err != nil {
+		return ArtifactNameAndStream{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", downloadUrl, nil)
+	if err != nil {
+		log.Println("failed to create request", err)
+		return ArtifactNameAndStream{}, err
+	}
+	if nexusAuth {
+		req.SetBasicAuth(StartupConfig.SendNexusLogin, StartupConfig.SendNexusPassword)
+	}
+	// без валидатора нельзя убедиться, что файл не изменился, поэтому скачиваем заново
+	resume := offset > 0 && validator != ""
+	if resume {
+		log.Printf("resuming download of %s from byte %d\n", downloadUrl, offset)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		log.Println("failed to download remote file", err)
+		return ArtifactNameAndStream{}, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && resume:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			resp.Body.Close()
+			log.Printf("unexpected Content-Range '%s' for %s, downloading from scratch\n", resp.Header.Get("Content-Range"), downloadUrl)
+			return OpenHttpDownload(ctx, downloadUrl, 0, "", nexusAuth)
+		}
+		return ArtifactNameAndStream{Name: downloadFileName, Stream: resp.Body, Offset: offset, Size: total, Validator: validator}, nil
+	case resp.StatusCode == http.StatusOK:
+		if resume {
+			log.Printf("server didn't resume download of %s, downloading from scratch\n", downloadUrl)
+		}
+		var size int64
+		if resp.ContentLength > 0 {
+			size = resp.ContentLength
+		}
+		return ArtifactNameAndStream{Name: downloadFileName, Stream: resp.Body, Size: size, Validator: getResumeValidator(resp)}, nil
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && resume:
+		resp.Body.Close()
+		log.Printf("range is not satisfiable for %s, downloading from scratch\n", downloadUrl)
+		return OpenHttpDownload(ctx, downloadUrl, 0, "", nexusAuth)
+	}
+	resp.Body.Close()
+	log.Printf("download of %s failed with status %d\n", downloadUrl, resp.StatusCode)
+	return ArtifactNameAndStream{}, &HttpStatusError{Url: downloadUrl, StatusCode: resp.StatusCode}
+}
+
+// getResumeValidator возвращает строгий ETag или Last-Modified, пригодные для If-Range
+func getResumeValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// parseContentRange разбирает заголовок вида "bytes 100-999/1000"
+func parseContentRange(contentRange string) (start int64, total int64, ok bool) {
+	rangeAndTotal, found := strings.CutPrefix(contentRange, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	rangePart, totalPart, found := strings.Cut(rangeAndTotal, "/")
+	if !found {
+		return 0, 0, false
+	}
+	startPart, _, found := strings.Cut(rangePart, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(startPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if totalPart != "*" {
+		total, _ = strconv.ParseInt(totalPart, 10, 64)
+	}
+	return start, total, true
+}
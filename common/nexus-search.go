@@ -0,0 +1,48 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// SearchNexus ищет компоненты в Nexus на стороне SEND через /service/rest/v1/search.
+// params - параметры поиска, например repository, group, name, version
+func SearchNexus(ctx context.Context, params url.Values) (NexusSearchResponse, error) {
+	var searchResponse NexusSearchResponse
+	searchUrl := StartupConfig.SendNexusUrl + "/service/rest/v1/search?" + params.Encode()
+	log.Println("searching nexus with searchUrl", searchUrl)
+	req, err := http.NewRequestWithContext(ctx, "GET", searchUrl, nil)
+	if err != nil {
+		log.Printf("failed to create request; err: %v\n", err)
+		return searchResponse, err
+	}
+	req.SetBasicAuth(StartupConfig.SendNexusLogin, StartupConfig.SendNexusPassword)
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		log.Printf("failed to make search request %s; err: %v\n", searchUrl, err)
+		return searchResponse, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("search request %s failed with status %d\n", searchUrl, resp.StatusCode)
+		return searchResponse, &HttpStatusError{Url: searchUrl, StatusCode: resp.StatusCode}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&searchResponse); err != nil {
+		log.Println("failed to decode nexus search response", err)
+		return searchResponse, err
+	}
+	return searchResponse, nil
+}
+
+// OpenNexusAsset скачивает найденный ассет. Если Nexus не вернул размер файла, он берётся из результата поиска
+func OpenNexusAsset(ctx context.Context, asset NexusItemAsset, offset int64, validator string) (ArtifactNameAndStream, error) {
+	log.Println("downloadUrl =", asset.DownloadUrl)
+	artifactNameAndStream, err := OpenNexusDownload(ctx, asset.DownloadUrl, offset, validator)
+	if err == nil && artifactNameAndStream.Size == 0 {
+		artifactNameAndStream.Size = asset.FileSize
+	}
+	return artifactNameAndStream, err
+}
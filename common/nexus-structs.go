@@ -2,11 +2,16 @@ package common
 
 type NexusSearchResponse struct {
 	Items []NexusItem `json:"items,omitempty"`
+	// Токен следующей страницы результатов, пустой на последней странице
+	ContinuationToken string `json:"continuationToken,omitempty"`
 }
 
 type NexusItemAsset struct {
 	DownloadUrl string `json:"downloadUrl,omitempty"`
+	Path        string `json:"path,omitempty"`
 	FileSize    int64  `json:"fileSize,omitempty"`
+	// Хеш-суммы файла: sha1, sha256 и т.д.
+	Checksum map[string]string `json:"checksum,omitempty"`
 }
 
 type NexusItem struct {
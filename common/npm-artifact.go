@@ -0,0 +1,146 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const NpmLatestTag = "latest"
+
+// NpmArtifact - npm пакет из Nexus.
+// Version - версия (1.2.3) или dist-tag (latest, next), Scope - scope пакета с '@' или без.
+// Scope можно также указать в имени пакета: "@scope/name"
+type NpmArtifact struct {
+	PackageName string
+	Version     string
+	Scope       string
+}
+
+func (a NpmArtifact) GetType() ArtifactType {
+	return NPM
+}
+
+// GetOriginalResourceName возвращает полное имя пакета вида "@scope/name"
+func (a NpmArtifact) GetOriginalResourceName() string {
+	if scope := a.GetScope(); scope != "" {
+		return "@" + scope + "/" + a.GetName()
+	}
+	return a.GetName()
+}
+
+// GetScope возвращает scope без '@'
+func (a NpmArtifact) GetScope() string {
+	if a.Scope != "" {
+		return strings.TrimPrefix(a.Scope, "@")
+	}
+	if scope, _, found := strings.Cut(a.PackageName, "/"); found && strings.HasPrefix(scope, "@") {
+		return strings.TrimPrefix(scope, "@")
+	}
+	return ""
+}
+
+// GetName возвращает имя пакета без scope
+func (a NpmArtifact) GetName() string {
+	if _, name, found := strings.Cut(a.PackageName, "/"); found && strings.HasPrefix(a.PackageName, "@") {
+		return name
+	}
+	return a.PackageName
+}
+
+func (a NpmArtifact) GetArtifactNameAndStream(ctx context.Context) (ArtifactNameAndStream, error) {
+	return a.GetArtifactNameAndStreamFrom(ctx, 0, "")
+}
+
+func (a NpmArtifact) GetArtifactNameAndStreamFrom(ctx context.Context, offset int64, validator string) (ArtifactNameAndStream, error) {
+	version, err := a.resolveVersion(ctx)
+	if err != nil {
+		return ArtifactNameAndStream{}, err
+	}
+	params := url.Values{}
+	params.Set("repository", StartupConfig.SendNexusNpmRepository)
+	params.Set("name", a.GetName())
+	params.Set("version", version)
+	if scope := a.GetScope(); scope != "" {
+		params.Set("group", scope)
+	}
+	searchResponse, err := SearchNexus(ctx, params)
+	if err != nil {
+		return ArtifactNameAndStream{}, err
+	}
+	if len(searchResponse.Items) == 0 {
+		msg := fmt.Sprintf("npm package %s@%s not found in Nexus", a.GetOriginalResourceName(), version)
+		log.Println(msg)
+		return ArtifactNameAndStream{}, &ArtifactNotFoundError{Message: msg}
+	}
+	for _, asset := range searchResponse.Items[0].Assets {
+		if strings.HasSuffix(asset.DownloadUrl, ".tgz") {
+			return OpenNexusAsset(ctx, asset, offset, validator)
+		}
+	}
+	msg := fmt.Sprintf("no tarball found for npm package %s@%s", a.GetOriginalResourceName(), version)
+	log.Println(msg)
+	return ArtifactNameAndStream{}, &ArtifactNotFoundError{Message: msg}
+}
+
+// resolveVersion превращает dist-tag в версию по метаданным пакета из npm-репозитория Nexus.
+// Поиск Nexus не знает о dist-tag, поэтому без этого шага найти пакет по тегу нельзя
+func (a NpmArtifact) resolveVersion(ctx context.Context) (string, error) {
+	tag := a.Version
+	if tag == "" {
+		tag = NpmLatestTag
+	}
+	if tag[0] >= '0' && tag[0] <= '9' {
+		return tag, nil
+	}
+	packageName := a.GetName()
+	if scope := a.GetScope(); scope != "" {
+		packageName = "@" + scope + "%2f" + packageName
+	}
+	metadataUrl := fmt.Sprintf("%s/repository/%s/%s", StartupConfig.SendNexusUrl, StartupConfig.SendNexusNpmRepository, packageName)
+	log.Printf("resolving dist-tag %s of npm package %s with url %s\n", tag, a.GetOriginalResourceName(), metadataUrl)
+	req, err := http.NewRequestWithContext(ctx, "GET", metadataUrl, nil)
+	if err != nil {
+		log.Printf("failed to create request; err: %v\n", err)
+		return "", err
+	}
+	req.SetBasicAuth(StartupConfig.SendNexusLogin, StartupConfig.SendNexusPassword)
+	req.Header.Set("Accept", "application/json")
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		log.Printf("failed to get metadata of npm package %s; err: %v\n", a.GetOriginalResourceName(), err)
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", &ArtifactNotFoundError{Message: fmt.Sprintf("npm package %s not found in Nexus", a.GetOriginalResourceName())}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", &HttpStatusError{Url: metadataUrl, StatusCode: resp.StatusCode}
+	}
+	var metadata struct {
+		DistTags map[string]string `json:"dist-tags"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		log.Println("failed to decode npm package metadata", err)
+		return "", err
+	}
+	version, found := metadata.DistTags[tag]
+	if !found {
+		return "", &ArtifactNotFoundError{Message: fmt.Sprintf("dist-tag %s not found for npm package %s", tag, a.GetOriginalResourceName())}
+	}
+	log.Printf("dist-tag %s of npm package %s resolved to version %s\n", tag, a.GetOriginalResourceName(), version)
+	return version, nil
+}
+
+func (a NpmArtifact) DeliverCleanup() error {
+	return nil
+}
+
+func (a NpmArtifact) DeployCleanup() error {
+	return nil
+}
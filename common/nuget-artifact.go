@@ -0,0 +1,84 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// NugetArtifact - .nupkg пакет из nuget-репозитория Nexus. Version - по умолчанию последняя
+type NugetArtifact struct {
+	PackageName string
+	Version     string
+}
+
+func (a NugetArtifact) GetType() ArtifactType {
+	return NUGET
+}
+
+func (a NugetArtifact) GetOriginalResourceName() string {
+	if a.Version != "" {
+		return a.PackageName + " " + a.Version
+	}
+	return a.PackageName
+}
+
+func (a NugetArtifact) GetArtifactNameAndStream(ctx context.Context) (ArtifactNameAndStream, error) {
+	return a.GetArtifactNameAndStreamFrom(ctx, 0, "")
+}
+
+func (a NugetArtifact) GetArtifactNameAndStreamFrom(ctx context.Context, offset int64, validator string) (ArtifactNameAndStream, error) {
+	params := url.Values{}
+	params.Set("repository", StartupConfig.SendNexusNugetRepository)
+	params.Set("name", a.PackageName)
+	if a.Version != "" {
+		params.Set("version", a.Version)
+	}
+	params.Set("sort", "version")
+	params.Set("direction", "desc")
+	searchResponse, err := SearchNexus(ctx, params)
+	if err != nil {
+		return ArtifactNameAndStream{}, err
+	}
+	for _, item := range searchResponse.Items {
+		for _, asset := range item.Assets {
+			// в nuget-hosted путь ассета - <id>/<version> без расширения, пакеты символов (.snupkg) не нужны
+			if strings.HasSuffix(asset.Path, ".snupkg") {
+				continue
+			}
+			artifactNameAndStream, err := OpenNexusAsset(ctx, asset, offset, validator)
+			if err != nil {
+				return ArtifactNameAndStream{}, err
+			}
+			artifactNameAndStream.Name = GetNupkgFileName(item.Name, item.Version)
+			artifactNameAndStream.Metadata = map[string]string{
+				PackageMetaName:    item.Name,
+				PackageMetaVersion: item.Version,
+				PackageMetaPath:    asset.Path,
+			}
+			if sha256, found := asset.Checksum["sha256"]; found {
+				artifactNameAndStream.Metadata[PackageMetaSha256] = sha256
+			}
+			return artifactNameAndStream, nil
+		}
+	}
+	msg := fmt.Sprintf("nuget package %s not found in Nexus", a.GetOriginalResourceName())
+	log.Println(msg)
+	return ArtifactNameAndStream{}, &ArtifactNotFoundError{Message: msg}
+}
+
+// GetNupkgFileName возвращает имя файла пакета в нормальной форме NuGet: <id>.<version>.nupkg в нижнем регистре
+func GetNupkgFileName(id, version string) string {
+	return path.Base(strings.ToLower(id + "." + version + ".nupkg"))
+}
+
+func (a NugetArtifact) DeliverCleanup() error {
+	return nil
+}
+
+func (a NugetArtifact) DeployCleanup() error {
+	return nil
+}
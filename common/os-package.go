@@ -0,0 +1,87 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+)
+
+// Ключи метаданных системных пакетов в .job файле
+const (
+	PackageMetaName         = "name"
+	PackageMetaVersion      = "version"
+	PackageMetaArchitecture = "architecture"
+	PackageMetaPath         = "path"
+	PackageMetaSha256       = "sha256"
+)
+
+// osPackageQuery - поиск .deb/.rpm в Nexus по имени, версии и архитектуре
+type osPackageQuery struct {
+	kind         string
+	repository   string
+	name         string
+	version      string
+	architecture string
+	// assetArchitecture возвращает архитектуру по имени файла или "", если файл не пакет
+	assetArchitecture func(fileName string) string
+	// независимые от архитектуры пакеты подходят для любой архитектуры
+	anyArchitecture string
+}
+
+// openOsPackage находит пакет и начинает его скачивание. Без версии берётся последняя.
+// В Metadata возвращаются имя, версия, архитектура, путь в репозитории и sha256 из Nexus
+func openOsPackage(ctx context.Context, query osPackageQuery, offset int64, validator string) (ArtifactNameAndStream, error) {
+	params := url.Values{}
+	params.Set("repository", query.repository)
+	params.Set("name", query.name)
+	if query.version != "" {
+		params.Set("version", query.version)
+	}
+	params.Set("sort", "version")
+	params.Set("direction", "desc")
+	searchResponse, err := SearchNexus(ctx, params)
+	if err != nil {
+		return ArtifactNameAndStream{}, err
+	}
+	for _, item := range searchResponse.Items {
+		for _, asset := range item.Assets {
+			architecture := query.assetArchitecture(path.Base(asset.Path))
+			if architecture == "" {
+				continue
+			}
+			if query.architecture != "" && architecture != query.architecture && architecture != query.anyArchitecture {
+				continue
+			}
+			artifactNameAndStream, err := OpenNexusAsset(ctx, asset, offset, validator)
+			if err != nil {
+				return ArtifactNameAndStream{}, err
+			}
+			artifactNameAndStream.Metadata = map[string]string{
+				PackageMetaName:         item.Name,
+				PackageMetaVersion:      item.Version,
+				PackageMetaArchitecture: architecture,
+				PackageMetaPath:         asset.Path,
+			}
+			if sha256, found := asset.Checksum["sha256"]; found {
+				artifactNameAndStream.Metadata[PackageMetaSha256] = sha256
+			}
+			return artifactNameAndStream, nil
+		}
+	}
+	msg := fmt.Sprintf("%s package %s not found in Nexus", query.kind, query.resourceName())
+	log.Println(msg)
+	return ArtifactNameAndStream{}, &ArtifactNotFoundError{Message: msg}
+}
+
+func (q osPackageQuery) resourceName() string {
+	name := q.name
+	if q.version != "" {
+		name += " " + q.version
+	}
+	if q.architecture != "" {
+		name += " (" + q.architecture + ")"
+	}
+	return name
+}
@@ -1,14 +1,17 @@
 package common
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"fts-cd-file-utility/cfg"
 	_ "github.com/docker/docker/api/types/container"
 	"log"
 	"net/http"
+	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
 	"strings"
 )
 
@@ -17,6 +20,10 @@ import (
 type PypiArtifact struct {
 	PackageName string
 	Version     string
+	// WithDependencies - передать пакет вместе с зависимостями из Requires-Dist одним архивом
+	WithDependencies bool
+	// Filter - какие файлы пакета передавать
+	Filter PypiDistributionFilter
 }
 
 func (a PypiArtifact) GetType() ArtifactType {
@@ -30,7 +37,15 @@ func buildNexusSearchPackageVersionUrl(cfg *cfg.StartupConfig, artifact *PypiArt
 	return fmt.Sprintf("%s/service/rest/v1/search?sort=version&repository=%s&name=%s&version=%s", cfg.SendNexusUrl, cfg.SendNexusPypiRepository, artifact.PackageName, artifact.Version)
 }
 
-func (a PypiArtifact) GetArtifactNameAndStream() (ArtifactNameAndStream, error) {
+func (a PypiArtifact) GetArtifactNameAndStream(ctx context.Context) (ArtifactNameAndStream, error) {
+	return a.GetArtifactNameAndStreamFrom(ctx, 0, "")
+}
+
+func (a PypiArtifact) GetArtifactNameAndStreamFrom(ctx context.Context, offset int64, validator string) (ArtifactNameAndStream, error) {
+	if a.WithDependencies {
+		// архив с зависимостями собирается заново, докачка не поддерживается
+		return a.openPypiBundle(ctx)
+	}
 	// search for artifact with specified version
 	// if found - download it
 	// if not found - search for artifact without version
@@ -38,18 +53,23 @@ func (a PypiArtifact) GetArtifactNameAndStream() (ArtifactNameAndStream, error)
 	// curl -u raisa:Qwerty123 'http://10.7.86.10:8081/service/rest/v1/search?repository=pypi-hosted&name=hello-world-package&version=0.1.3'
 	searchUrl := buildNexusSearchPackageVersionUrl(&StartupConfig, &a)
 	log.Println("searching for package with searchUrl ", searchUrl)
-	req, err := http.NewRequest("GET", searchUrl, nil)
-	req.SetBasicAuth(StartupConfig.SendNexusLogin, StartupConfig.SendNexusPassword)
+	req, err := http.NewRequestWithContext(ctx, "GET", searchUrl, nil)
 	if err != nil {
 		log.Printf("failed to create request; err: %v\n", err)
 		return ArtifactNameAndStream{}, err
 	}
+	req.SetBasicAuth(StartupConfig.SendNexusLogin, StartupConfig.SendNexusPassword)
 
 	resp, err := HttpClient.Do(req)
 	if err != nil {
 		log.Printf("failed to make search request package %s:%s; err: %v\n", a.PackageName, a.Version, err)
 		return ArtifactNameAndStream{}, err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("search request for package %s:%s failed with status %d\n", a.PackageName, a.Version, resp.StatusCode)
+		return ArtifactNameAndStream{}, &HttpStatusError{Url: searchUrl, StatusCode: resp.StatusCode}
+	}
 
 	parsedSearchResponse := new(NexusSearchResponse)
 	err = json.NewDecoder(resp.Body).Decode(&parsedSearchResponse)
@@ -60,33 +80,70 @@ func (a PypiArtifact) GetArtifactNameAndStream() (ArtifactNameAndStream, error)
 	if len(parsedSearchResponse.Items) == 0 {
 		msg := fmt.Sprintf("package %s:%s not found in Nexus", a.PackageName, a.Version)
 		log.Println(msg)
-		return ArtifactNameAndStream{}, errors.New(msg)
+		return ArtifactNameAndStream{}, &ArtifactNotFoundError{Message: msg}
 	}
 
-	packageItem := parsedSearchResponse.Items[0]
-	if len(packageItem.Assets) == 0 {
-		msg := fmt.Sprintf("no asset found for package %s:%s", a.PackageName, a.Version)
+	// в ответе поиска может быть несколько версий и у каждой - wheel под разные платформы и sdist
+	var distributions []PypiDistribution
+	fileSizes := map[string]int64{}
+	for _, item := range parsedSearchResponse.Items {
+		for _, asset := range item.Assets {
+			distributions = append(distributions, PypiDistribution{
+				FileName: path.Base(asset.Path),
+				Url:      asset.DownloadUrl,
+				Sha256:   asset.Checksum["sha256"],
+			})
+			fileSizes[asset.DownloadUrl] = asset.FileSize
+		}
+	}
+	requirement := PypiRequirement{Name: a.PackageName}
+	if _, err := ParsePypiVersion(a.Version); err == nil {
+		requirement.Specifier = PypiSpecifier("==" + a.Version)
+	} else if a.Version != "" {
+		requirement.Specifier = PypiSpecifier("===" + a.Version)
+	}
+	version, selected, found := selectPypiDistribution(requirement, distributions, a.Filter, GetPypiEnvironment())
+	if !found {
+		msg := fmt.Sprintf("no suitable distribution found for package %s:%s", a.PackageName, a.Version)
 		log.Println(msg)
-		return ArtifactNameAndStream{}, errors.New(msg)
+		return ArtifactNameAndStream{}, &ArtifactNotFoundError{Message: msg}
+	}
+	if len(selected) > 1 {
+		// несколько файлов передаются одним архивом, как пакет с зависимостями
+		return a.openPypiDistributions(ctx, version, selected)
 	}
-	downloadUrl := packageItem.Assets[0].DownloadUrl
+	downloadUrl := selected[0].Url
 	log.Println("downloadUrl =", downloadUrl)
-	downloadFileName, err := GetDownloadFileNameFromUrl(downloadUrl)
-	if err != nil {
-		return ArtifactNameAndStream{}, err
+	artifactNameAndStream, err := OpenNexusDownload(ctx, downloadUrl, offset, validator)
+	if err == nil && artifactNameAndStream.Size == 0 {
+		artifactNameAndStream.Size = fileSizes[downloadUrl]
 	}
+	return artifactNameAndStream, err
+}
 
-	downloadReq, err := http.NewRequest("GET", downloadUrl, nil)
+// openPypiDistributions скачивает несколько файлов одной версии пакета и передаёт их tar архивом
+func (a PypiArtifact) openPypiDistributions(ctx context.Context, version PypiVersion, distributions []PypiDistribution) (ArtifactNameAndStream, error) {
+	tempDir, err := os.MkdirTemp("", "pypi_")
 	if err != nil {
-		log.Println("failed to create request", err)
+		log.Println("failed to create temp dir", err)
 		return ArtifactNameAndStream{}, err
 	}
-	downloadResp, err := HttpClient.Do(downloadReq)
-	if err != nil {
-		log.Println("failed to download remote file", err)
-		return ArtifactNameAndStream{}, err
+	name := NormalizePypiName(a.PackageName)
+	var manifest PypiBundleManifest
+	for _, distribution := range distributions {
+		log.Println("downloadUrl =", distribution.Url)
+		if err := downloadPypiDistribution(ctx, distribution, filepath.Join(tempDir, distribution.FileName)); err != nil {
+			os.RemoveAll(tempDir)
+			return ArtifactNameAndStream{}, err
+		}
+		manifest.Packages = append(manifest.Packages, PypiBundlePackage{
+			Name:    name,
+			Version: version.Raw,
+			File:    distribution.FileName,
+			Sha256:  distribution.Sha256,
+		})
 	}
-	return ArtifactNameAndStream{Name: downloadFileName, Stream: downloadResp.Body}, nil
+	return openPypiBundleDir(tempDir, name+"-"+version.Raw+PypiBundleSuffix, manifest)
 }
 
 func (a PypiArtifact) DeliverCleanup() error {
@@ -0,0 +1,458 @@
+package common
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// Суффикс архива, в котором пакет и его зависимости передаются через шару
+	PypiBundleSuffix = ".pypi.tar"
+	// Описание содержимого архива
+	PypiBundleManifestName      = "pypi-bundle.json"
+	DEFAULT_PYPI_PYTHON_VERSION = "3.11"
+	// Защита от бесконечного разрешения зависимостей
+	pypiMaxDependencies = 500
+	// Ключ метаданных задания со списком пакетов, зависимости которых не удалось определить
+	PypiMetaUnresolved = "unresolvedDependencies"
+)
+
+var (
+	pypiLinkRegexp = regexp.MustCompile(`(?is)<a\s+([^>]*)>\s*([^<]*?)\s*</a>`)
+	pypiAttrRegexp = regexp.MustCompile(`(?is)([a-z-]+)\s*=\s*"([^"]*)"`)
+)
+
+// PypiBundleManifest - содержимое pypi-bundle.json
+type PypiBundleManifest struct {
+	Packages []PypiBundlePackage `json:"packages"`
+	// Unresolved - пакеты (<name>==<version>), метаданные которых не удалось прочитать, их зависимости не переданы
+	Unresolved []string `json:"unresolved,omitempty"`
+}
+
+type PypiBundlePackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	File    string `json:"file"`
+	Sha256  string `json:"sha256,omitempty"`
+}
+
+// PypiDistribution - файл пакета из simple index (PEP 503)
+type PypiDistribution struct {
+	FileName       string
+	Url            string
+	Sha256         string
+	RequiresPython string
+	Yanked         bool
+}
+
+// FetchPypiSimpleIndex возвращает файлы пакета из simple index репозитория. Если пакета нет, возвращается пустой список
+func FetchPypiSimpleIndex(ctx context.Context, indexUrl, login, password string) ([]PypiDistribution, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", indexUrl, nil)
+	if err != nil {
+		log.Printf("failed to create request; err: %v\n", err)
+		return nil, err
+	}
+	req.SetBasicAuth(login, password)
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		log.Printf("failed to get simple index %s; err: %v\n", indexUrl, err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HttpStatusError{Url: indexUrl, StatusCode: resp.StatusCode}
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	baseUrl, err := url.Parse(indexUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	var distributions []PypiDistribution
+	for _, link := range pypiLinkRegexp.FindAllStringSubmatch(string(body), -1) {
+		attrs := map[string]string{}
+		for _, attr := range pypiAttrRegexp.FindAllStringSubmatch(link[1], -1) {
+			attrs[strings.ToLower(attr[1])] = html.UnescapeString(attr[2])
+		}
+		href, err := baseUrl.Parse(attrs["href"])
+		if err != nil || attrs["href"] == "" {
+			continue
+		}
+		distribution := PypiDistribution{
+			FileName:       path.Base(href.Path),
+			RequiresPython: attrs["data-requires-python"],
+			Yanked:         strings.Contains(strings.ToLower(link[1]), "data-yanked"),
+		}
+		if algorithm, digest, found := strings.Cut(href.Fragment, "="); found && algorithm == "sha256" {
+			distribution.Sha256 = digest
+		}
+		href.Fragment = ""
+		distribution.Url = href.String()
+		distributions = append(distributions, distribution)
+	}
+	return distributions, nil
+}
+
+// GetPypiDistributionVersion возвращает версию из имени файла wheel или sdist пакета packageName
+func GetPypiDistributionVersion(packageName, fileName string) (PypiVersion, error) {
+	normalizedName := NormalizePypiName(packageName)
+	baseName := fileName
+	for _, extension := range []string{".whl", ".tar.gz", ".tar.bz2", ".tgz", ".zip"} {
+		baseName = strings.TrimSuffix(baseName, extension)
+	}
+	if strings.HasSuffix(fileName, ".whl") {
+		parts := strings.Split(baseName, "-")
+		if len(parts) >= 5 && NormalizePypiName(parts[0]) == normalizedName {
+			return ParsePypiVersion(parts[1])
+		}
+		return PypiVersion{}, fmt.Errorf("invalid wheel file name %s", fileName)
+	}
+	// в имени sdist пакета могут быть '-', поэтому версию ищем после имени пакета
+	for i := strings.Index(baseName, "-"); i >= 0; {
+		if NormalizePypiName(baseName[:i]) == normalizedName {
+			return ParsePypiVersion(baseName[i+1:])
+		}
+		next := strings.Index(baseName[i+1:], "-")
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return PypiVersion{}, fmt.Errorf("invalid sdist file name %s", fileName)
+}
+
+// GetPypiEnvironment возвращает значения маркеров окружения (PEP 508) для целевого окружения на стороне RECEIVE
+func GetPypiEnvironment() map[string]string {
+	pythonVersion := StartupConfig.SendPypiPythonVersion
+	if pythonVersion == "" {
+		pythonVersion = DEFAULT_PYPI_PYTHON_VERSION
+	}
+	fullVersion := pythonVersion
+	if strings.Count(fullVersion, ".") < 2 {
+		fullVersion += ".0"
+	}
+	return map[string]string{
+		"python_version":                 pythonVersion,
+		"python_full_version":            fullVersion,
+		"implementation_version":         fullVersion,
+		"os_name":                        "posix",
+		"sys_platform":                   "linux",
+		"platform_system":                "Linux",
+		"platform_machine":               "x86_64",
+		"platform_release":               "",
+		"platform_version":               "",
+		"platform_python_implementation": "CPython",
+		"implementation_name":            "cpython",
+	}
+}
+
+// pypiResolver разрешает дерево зависимостей пакета по Requires-Dist и скачивает выбранные файлы в dir.
+// Разрешение жадное: для каждого пакета сразу выбирается наибольшая подходящая версия, и выбор не пересматривается.
+// Если требование, найденное позже, противоречит выбранной версии, возвращается DependencyConflictError
+type pypiResolver struct {
+	ctx      context.Context
+	dir      string
+	env      map[string]string
+	filter   PypiDistributionFilter
+	resolved map[string]*pypiResolvedPackage
+	order    []string
+	// unresolved - пакеты без читаемых метаданных
+	unresolved []string
+}
+
+type pypiResolvedPackage struct {
+	name    string
+	version PypiVersion
+	// distributions - скачанные файлы, метаданные читаются из первого
+	distributions []PypiDistribution
+	metadata      PypiMetadata
+	extras        map[string]bool
+}
+
+type pypiPendingRequirement struct {
+	requirement PypiRequirement
+	parent      string
+}
+
+func (r *pypiResolver) resolve(root PypiRequirement) error {
+	queue := []pypiPendingRequirement{{requirement: root}}
+	for len(queue) > 0 {
+		pending := queue[0]
+		queue = queue[1:]
+		requirement := pending.requirement
+		name := NormalizePypiName(requirement.Name)
+
+		if resolvedPackage, found := r.resolved[name]; found {
+			if !requirement.Specifier.Contains(resolvedPackage.version) {
+				return &DependencyConflictError{Message: fmt.Sprintf("conflicting requirements: %s%s required by %s, but %s %s is already selected",
+					requirement.Name, requirement.Specifier, pending.parent, name, resolvedPackage.version.Raw)}
+			}
+			var newExtras []string
+			for _, extra := range requirement.Extras {
+				if !resolvedPackage.extras[extra] {
+					resolvedPackage.extras[extra] = true
+					newExtras = append(newExtras, extra)
+				}
+			}
+			if len(newExtras) > 0 {
+				dependencies, err := r.dependencies(resolvedPackage)
+				if err != nil {
+					return err
+				}
+				queue = append(queue, dependencies...)
+			}
+			continue
+		}
+
+		if len(r.resolved) >= pypiMaxDependencies {
+			return fmt.Errorf("too many dependencies, limit is %d", pypiMaxDependencies)
+		}
+		resolvedPackage, err := r.download(requirement, pending.parent)
+		if err != nil {
+			return err
+		}
+		r.resolved[name] = resolvedPackage
+		r.order = append(r.order, name)
+		dependencies, err := r.dependencies(resolvedPackage)
+		if err != nil {
+			return err
+		}
+		queue = append(queue, dependencies...)
+	}
+	return nil
+}
+
+// dependencies возвращает зависимости пакета, нужные в целевом окружении с учётом запрошенных extras
+func (r *pypiResolver) dependencies(resolvedPackage *pypiResolvedPackage) ([]pypiPendingRequirement, error) {
+	var extras []string
+	for extra := range resolvedPackage.extras {
+		extras = append(extras, extra)
+	}
+	var dependencies []pypiPendingRequirement
+	for _, line := range resolvedPackage.metadata.RequiresDist {
+		requirement, err := ParsePypiRequirement(line)
+		if err != nil {
+			return nil, fmt.Errorf("package %s: %w", resolvedPackage.name, err)
+		}
+		required, err := requirement.IsRequired(r.env, extras)
+		if err != nil {
+			return nil, fmt.Errorf("package %s: %w", resolvedPackage.name, err)
+		}
+		if required {
+			dependencies = append(dependencies, pypiPendingRequirement{requirement: requirement, parent: resolvedPackage.name})
+		}
+	}
+	return dependencies, nil
+}
+
+// download выбирает подходящую версию и файлы пакета, скачивает их и читает метаданные
+func (r *pypiResolver) download(requirement PypiRequirement, parent string) (*pypiResolvedPackage, error) {
+	name := NormalizePypiName(requirement.Name)
+	indexUrl := fmt.Sprintf("%s/repository/%s/simple/%s/", StartupConfig.SendNexusUrl, strings.Trim(StartupConfig.SendNexusPypiRepository, "/"), name)
+	distributions, err := FetchPypiSimpleIndex(r.ctx, indexUrl, StartupConfig.SendNexusLogin, StartupConfig.SendNexusPassword)
+	if err != nil {
+		return nil, err
+	}
+	version, selected, found := selectPypiDistribution(requirement, distributions, r.filter, r.env)
+	if !found {
+		msg := fmt.Sprintf("no suitable distribution of %s%s found in Nexus", requirement.Name, requirement.Specifier)
+		if parent != "" {
+			msg += ", required by " + parent
+		}
+		log.Println(msg)
+		return nil, &ArtifactNotFoundError{Message: msg}
+	}
+	log.Printf("python package %s%s resolved to %s\n", requirement.Name, requirement.Specifier, selected[0].FileName)
+
+	for _, distribution := range selected {
+		if err := downloadPypiDistribution(r.ctx, distribution, filepath.Join(r.dir, distribution.FileName)); err != nil {
+			return nil, err
+		}
+	}
+	metadata, err := ReadPypiMetadata(filepath.Join(r.dir, selected[0].FileName))
+	if err != nil {
+		// у старых sdist пакетов может не быть METADATA или PKG-INFO, зависимости такого пакета не переносятся
+		log.Printf("failed to read metadata of %s, dependencies are skipped: %v\n", selected[0].FileName, err)
+		r.unresolved = append(r.unresolved, name+"=="+version.Raw)
+	}
+	extras := map[string]bool{}
+	for _, extra := range requirement.Extras {
+		extras[extra] = true
+	}
+	return &pypiResolvedPackage{name: name, version: version, distributions: selected, metadata: metadata, extras: extras}, nil
+}
+
+// selectPypiDistribution выбирает наибольшую версию, у которой есть подходящие файлы, и возвращает
+// файлы этой версии от лучшего к худшему: все подходящие, если filter.All, иначе только лучший.
+// Pre-release версии выбираются, только если их явно запросили или других нет
+func selectPypiDistribution(requirement PypiRequirement, distributions []PypiDistribution, filter PypiDistributionFilter, env map[string]string) (PypiVersion, []PypiDistribution, bool) {
+	pythonVersion, _ := ParsePypiVersion(env["python_full_version"])
+	type candidate struct {
+		version      PypiVersion
+		distribution PypiDistribution
+	}
+	var candidates []candidate
+	for _, distribution := range distributions {
+		version, err := GetPypiDistributionVersion(requirement.Name, distribution.FileName)
+		if err != nil || !requirement.Specifier.Contains(version) {
+			continue
+		}
+		if distribution.Yanked && !strings.Contains(string(requirement.Specifier), "==") {
+			continue
+		}
+		if distribution.RequiresPython != "" && !filter.acceptsAll() && !PypiSpecifier(distribution.RequiresPython).Contains(pythonVersion) {
+			continue
+		}
+		if !filter.isSuitable(distribution.FileName, env) {
+			continue
+		}
+		candidates = append(candidates, candidate{version: version, distribution: distribution})
+	}
+	allowPrereleases := requirement.Specifier.AllowsPrereleases()
+	if !allowPrereleases {
+		allowPrereleases = true
+		for _, c := range candidates {
+			if !c.version.IsPrerelease() {
+				allowPrereleases = false
+				break
+			}
+		}
+	}
+	var best *candidate
+	for i, c := range candidates {
+		if c.version.IsPrerelease() && !allowPrereleases {
+			continue
+		}
+		if best == nil || c.version.Compare(best.version) > 0 {
+			best = &candidates[i]
+		}
+	}
+	if best == nil {
+		return PypiVersion{}, nil, false
+	}
+	var selected []PypiDistribution
+	for _, c := range candidates {
+		if c.version.Compare(best.version) == 0 {
+			selected = append(selected, c.distribution)
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return filter.isBetter(selected[i].FileName, selected[j].FileName, env)
+	})
+	if !filter.All {
+		selected = selected[:1]
+	}
+	return best.version, selected, true
+}
+
+func downloadPypiDistribution(ctx context.Context, distribution PypiDistribution, filePath string) error {
+	download, err := OpenNexusDownload(ctx, distribution.Url, 0, "")
+	if err != nil {
+		return err
+	}
+	defer download.Stream.Close()
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, hash), download.Stream); err != nil {
+		log.Printf("failed to download %s: %v\n", distribution.FileName, err)
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); distribution.Sha256 != "" && actual != distribution.Sha256 {
+		return fmt.Errorf("%w: %s expected %s, got %s", ErrChecksumMismatch, distribution.FileName, distribution.Sha256, actual)
+	}
+	return nil
+}
+
+// openPypiBundle разрешает зависимости пакета и передаёт его вместе с зависимостями одним tar архивом
+func (a PypiArtifact) openPypiBundle(ctx context.Context) (ArtifactNameAndStream, error) {
+	rootLine := a.PackageName
+	if a.Version != "" {
+		rootLine += "==" + a.Version
+	}
+	root, err := ParsePypiRequirement(rootLine)
+	if err != nil {
+		return ArtifactNameAndStream{}, err
+	}
+	tempDir, err := os.MkdirTemp("", "pypi_")
+	if err != nil {
+		log.Println("failed to create temp dir", err)
+		return ArtifactNameAndStream{}, err
+	}
+	resolver := pypiResolver{ctx: ctx, dir: tempDir, env: GetPypiEnvironment(), filter: a.Filter, resolved: map[string]*pypiResolvedPackage{}}
+	if err := resolver.resolve(root); err != nil {
+		os.RemoveAll(tempDir)
+		var notFoundErr *ArtifactNotFoundError
+		var conflictErr *DependencyConflictError
+		if errors.As(err, &notFoundErr) || errors.As(err, &conflictErr) {
+			return ArtifactNameAndStream{}, err
+		}
+		return ArtifactNameAndStream{}, fmt.Errorf("failed to resolve dependencies of %s: %w", a.PackageName, err)
+	}
+
+	var manifest PypiBundleManifest
+	for _, name := range resolver.order {
+		resolvedPackage := resolver.resolved[name]
+		for _, distribution := range resolvedPackage.distributions {
+			manifest.Packages = append(manifest.Packages, PypiBundlePackage{
+				Name:    name,
+				Version: resolvedPackage.version.Raw,
+				File:    distribution.FileName,
+				Sha256:  distribution.Sha256,
+			})
+		}
+	}
+	manifest.Unresolved = resolver.unresolved
+	log.Printf("package %s resolved with %d dependencies\n", a.PackageName, len(resolver.order)-1)
+	rootPackage := resolver.resolved[resolver.order[0]]
+	artifactNameAndStream, err := openPypiBundleDir(tempDir, rootPackage.name+"-"+rootPackage.version.Raw+PypiBundleSuffix, manifest)
+	if err == nil && len(manifest.Unresolved) > 0 {
+		log.Printf("dependencies of %s are not transferred since their metadata is unreadable\n", strings.Join(manifest.Unresolved, ", "))
+		artifactNameAndStream.Metadata = map[string]string{PypiMetaUnresolved: strings.Join(manifest.Unresolved, ",")}
+	}
+	return artifactNameAndStream, err
+}
+
+// openPypiBundleDir пишет pypi-bundle.json в dir с уже скачанными файлами пакетов и отдаёт их tar архивом.
+// dir удаляется после передачи архива или при ошибке
+func openPypiBundleDir(dir, bundleName string, manifest PypiBundleManifest) (ArtifactNameAndStream, error) {
+	var fileNames []string
+	for _, pkg := range manifest.Packages {
+		fileNames = append(fileNames, pkg.File)
+	}
+	sort.Strings(fileNames)
+	fileNames = append([]string{PypiBundleManifestName}, fileNames...)
+	content, err := json.Marshal(manifest)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, PypiBundleManifestName), content, 0644)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return ArtifactNameAndStream{}, err
+	}
+	return openTarBundle(dir, bundleName, fileNames)
+}
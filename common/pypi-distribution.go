@@ -0,0 +1,198 @@
+package common
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Выбор файлов python пакета: wheel или sdist, теги python, ABI и платформы (PEP 425)
+
+const (
+	PYPI_FILE_TYPE_WHEEL = "wheel"
+	PYPI_FILE_TYPE_SDIST = "sdist"
+)
+
+// PypiDistributionFilter - предпочтения по файлам пакета из задания. Порядок значений в списках задаёт приоритет,
+// пустой список - любое значение. Если фильтр пустой, файл выбирается под окружение GetPypiEnvironment
+type PypiDistributionFilter struct {
+	FileTypes    []string `json:"fileTypes,omitempty"`
+	PythonTags   []string `json:"pythonTags,omitempty"`
+	AbiTags      []string `json:"abiTags,omitempty"`
+	PlatformTags []string `json:"platformTags,omitempty"`
+	// All - передать все подходящие файлы выбранной версии, а не один лучший
+	All bool `json:"allDistributions,omitempty"`
+}
+
+func (f PypiDistributionFilter) IsEmpty() bool {
+	return len(f.FileTypes) == 0 && len(f.PythonTags) == 0 && len(f.AbiTags) == 0 && len(f.PlatformTags) == 0
+}
+
+func (f PypiDistributionFilter) hasTags() bool {
+	return len(f.PythonTags) > 0 || len(f.AbiTags) > 0 || len(f.PlatformTags) > 0
+}
+
+// Matches проверяет, подходит ли файл под фильтр. Теги проверяются только у wheel,
+// sdist при заданных тегах подходит, только если он явно указан в FileTypes
+func (f PypiDistributionFilter) Matches(fileName string) bool {
+	fileType := GetPypiFileType(fileName)
+	if fileType == "" || (len(f.FileTypes) > 0 && !slices.Contains(f.FileTypes, fileType)) {
+		return false
+	}
+	if fileType != PYPI_FILE_TYPE_WHEEL {
+		return len(f.FileTypes) > 0 || !f.hasTags()
+	}
+	pythonTags, abiTags, platformTags, _ := parsePypiWheelTags(fileName)
+	return pypiTagIndex(f.PythonTags, pythonTags) >= 0 &&
+		pypiTagIndex(f.AbiTags, abiTags) >= 0 &&
+		pypiTagIndex(f.PlatformTags, platformTags) >= 0
+}
+
+// rank возвращает приоритет файла по фильтру, меньше - лучше
+func (f PypiDistributionFilter) rank(fileName string) [4]int {
+	rank := [4]int{pypiTagIndex(f.FileTypes, []string{GetPypiFileType(fileName)})}
+	if pythonTags, abiTags, platformTags, ok := parsePypiWheelTags(fileName); ok {
+		rank[1] = pypiTagIndex(f.PythonTags, pythonTags)
+		rank[2] = pypiTagIndex(f.AbiTags, abiTags)
+		rank[3] = pypiTagIndex(f.PlatformTags, platformTags)
+	}
+	return rank
+}
+
+// acceptsAll - запрошены все файлы версии без фильтра, окружение RECEIVE при выборе не учитывается
+func (f PypiDistributionFilter) acceptsAll() bool {
+	return f.All && f.IsEmpty()
+}
+
+// isSuitable - файл подходит под фильтр, а при пустом фильтре - под окружение.
+// Если запрошены все файлы без фильтра, подходит любой wheel или sdist
+func (f PypiDistributionFilter) isSuitable(fileName string, env map[string]string) bool {
+	if f.acceptsAll() {
+		return GetPypiFileType(fileName) != ""
+	}
+	if f.IsEmpty() {
+		return pypiDistributionScore(fileName, env) >= 0
+	}
+	return f.Matches(fileName)
+}
+
+// isBetter - файл a предпочтительнее файла b той же версии
+func (f PypiDistributionFilter) isBetter(a, b string, env map[string]string) bool {
+	if f.IsEmpty() {
+		return pypiDistributionScore(a, env) > pypiDistributionScore(b, env)
+	}
+	rankA, rankB := f.rank(a), f.rank(b)
+	for i := range rankA {
+		if rankA[i] != rankB[i] {
+			return rankA[i] < rankB[i]
+		}
+	}
+	// при равном приоритете предпочитается файл под окружение
+	return pypiDistributionScore(a, env) > pypiDistributionScore(b, env)
+}
+
+// pypiTagIndex возвращает наименьший индекс тега из tags в списке preferred, 0 для пустого списка и -1, если тега нет
+func pypiTagIndex(preferred, tags []string) int {
+	if len(preferred) == 0 {
+		return 0
+	}
+	best := -1
+	for _, tag := range tags {
+		if i := slices.Index(preferred, tag); i >= 0 && (best < 0 || i < best) {
+			best = i
+		}
+	}
+	return best
+}
+
+// GetPypiFileType возвращает wheel, sdist или пустую строку для прочих файлов (egg, exe)
+func GetPypiFileType(fileName string) string {
+	if strings.HasSuffix(fileName, ".whl") {
+		return PYPI_FILE_TYPE_WHEEL
+	}
+	for _, extension := range []string{".tar.gz", ".zip", ".tar.bz2", ".tgz"} {
+		if strings.HasSuffix(fileName, extension) {
+			return PYPI_FILE_TYPE_SDIST
+		}
+	}
+	return ""
+}
+
+// parsePypiWheelTags разбирает теги из имени wheel: name-version(-build)?-python-abi-platform.whl.
+// Тег может быть составным, например py2.py3
+func parsePypiWheelTags(fileName string) (pythonTags, abiTags, platformTags []string, ok bool) {
+	if !strings.HasSuffix(fileName, ".whl") {
+		return nil, nil, nil, false
+	}
+	parts := strings.Split(strings.TrimSuffix(fileName, ".whl"), "-")
+	if len(parts) < 5 {
+		return nil, nil, nil, false
+	}
+	return strings.Split(parts[len(parts)-3], "."), strings.Split(parts[len(parts)-2], "."), strings.Split(parts[len(parts)-1], "."), true
+}
+
+// pypiDistributionScore оценивает, насколько файл подходит для окружения: бинарный wheel под платформу лучше
+// универсального, универсальный лучше sdist. -1 - файл не подходит
+func pypiDistributionScore(fileName string, env map[string]string) int {
+	switch GetPypiFileType(fileName) {
+	case PYPI_FILE_TYPE_SDIST:
+		return 0
+	case "":
+		return -1
+	}
+	pythonTags, abiTags, platformTags, ok := parsePypiWheelTags(fileName)
+	if !ok {
+		return -1
+	}
+	major, minor, _ := strings.Cut(env["python_version"], ".")
+	cpython := "cp" + major + minor
+
+	best := -1
+	for _, pythonTag := range pythonTags {
+		for _, abiTag := range abiTags {
+			for _, platformTag := range platformTags {
+				if !isPypiPlatformSupported(platformTag, env["platform_machine"]) {
+					continue
+				}
+				score := -1
+				switch {
+				case abiTag == "none" && (pythonTag == "py"+major || pythonTag == "py"+major+minor || pythonTag == cpython):
+					score = 1
+				case abiTag == "abi3" && isPypiAbi3Compatible(pythonTag, major, minor):
+					score = 2
+				case (abiTag == cpython || abiTag == cpython+"m") && pythonTag == cpython:
+					score = 3
+				}
+				if score > 0 && platformTag != "any" {
+					score += 3
+				}
+				if score > best {
+					best = score
+				}
+			}
+		}
+	}
+	return best
+}
+
+// isPypiAbi3Compatible - wheel со stable ABI для cp3X подходит для CPython той же major версии не ниже 3.X
+func isPypiAbi3Compatible(pythonTag, major, minor string) bool {
+	tagMinor, found := strings.CutPrefix(pythonTag, "cp"+major)
+	if !found {
+		return false
+	}
+	tagMinorNumber, err := strconv.Atoi(tagMinor)
+	if err != nil {
+		return false
+	}
+	minorNumber, err := strconv.Atoi(minor)
+	return err == nil && tagMinorNumber <= minorNumber
+}
+
+func isPypiPlatformSupported(platformTag, machine string) bool {
+	if platformTag == "any" {
+		return true
+	}
+	return strings.HasSuffix(platformTag, "_"+machine) &&
+		(strings.HasPrefix(platformTag, "manylinux") || strings.HasPrefix(platformTag, "linux_"))
+}
@@ -0,0 +1,86 @@
+package common
+
+import "testing"
+
+func TestPypiDistributionScore(t *testing.T) {
+	env := map[string]string{"python_version": "3.11", "platform_machine": "x86_64"}
+	tests := []struct {
+		fileName string
+		want     int
+	}{
+		{"pkg-1.0.tar.gz", 0},
+		{"pkg-1.0.zip", 0},
+		{"pkg-1.0-py3-none-any.whl", 1},
+		{"pkg-1.0-py2.py3-none-any.whl", 1},
+		{"pkg-1.0-py311-none-any.whl", 1},
+		{"pkg-1.0-cp311-none-any.whl", 1},
+		{"pkg-1.0-py2-none-any.whl", -1},
+		{"pkg-1.0-cp311-abi3-any.whl", 2},
+		{"pkg-1.0-cp311-cp311-any.whl", 3},
+		{"pkg-1.0-py3-none-manylinux1_x86_64.whl", 4},
+		{"pkg-1.0-cp38-abi3-manylinux2014_x86_64.whl", 5},
+		{"pkg-1.0-cp39-abi3-manylinux_2_17_x86_64.whl", 5},
+		{"pkg-1.0-cp310-abi3-manylinux_2_17_x86_64.whl", 5},
+		{"pkg-1.0-cp312-abi3-manylinux_2_17_x86_64.whl", -1},
+		{"pkg-1.0-cp27-abi3-manylinux_2_17_x86_64.whl", -1},
+		{"pkg-1.0-cp311-cp311-manylinux_2_17_x86_64.manylinux2014_x86_64.whl", 6},
+		{"pkg-1.0-1-cp311-cp311-linux_x86_64.whl", 6},
+		{"pkg-1.0-cp311-cp311m-manylinux1_x86_64.whl", 6},
+		{"pkg-1.0-cp312-cp312-manylinux_2_17_x86_64.whl", -1},
+		{"pkg-1.0-cp311-cp311-manylinux_2_17_aarch64.whl", -1},
+		{"pkg-1.0-cp311-cp311-win_amd64.whl", -1},
+		{"pkg-1.0-cp311-cp311-macosx_11_0_x86_64.whl", -1},
+		{"pkg-1.0-pp310-pypy310_pp73-manylinux_2_17_x86_64.whl", -1},
+		{"pkg-1.0-py3-any.whl", -1},
+		{"pkg-1.0.egg", -1},
+	}
+	for _, tt := range tests {
+		if got := pypiDistributionScore(tt.fileName, env); got != tt.want {
+			t.Errorf("pypiDistributionScore(%s) = %d, want %d", tt.fileName, got, tt.want)
+		}
+	}
+}
+
+func TestPypiDistributionScoreOrder(t *testing.T) {
+	env := map[string]string{"python_version": "3.11", "platform_machine": "x86_64"}
+	// от лучшего к худшему
+	ordered := []string{
+		"pkg-1.0-cp311-cp311-manylinux_2_17_x86_64.whl",
+		"pkg-1.0-cp38-abi3-manylinux_2_17_x86_64.whl",
+		"pkg-1.0-py3-none-manylinux_2_17_x86_64.whl",
+		"pkg-1.0-py3-none-any.whl",
+		"pkg-1.0.tar.gz",
+	}
+	filter := PypiDistributionFilter{}
+	for i := 1; i < len(ordered); i++ {
+		if !filter.isBetter(ordered[i-1], ordered[i], env) {
+			t.Errorf("%s should be better than %s", ordered[i-1], ordered[i])
+		}
+	}
+}
+
+func TestPypiDistributionFilterAll(t *testing.T) {
+	distributions := []PypiDistribution{
+		{FileName: "pkg-1.0-cp311-cp311-manylinux_2_17_x86_64.whl"},
+		{FileName: "pkg-1.0-cp312-cp312-win_amd64.whl"},
+		{FileName: "pkg-1.0-cp38-cp38-macosx_11_0_arm64.whl", RequiresPython: "<3.9"},
+		{FileName: "pkg-1.0.tar.gz"},
+		{FileName: "pkg-1.0-py2.7.egg"},
+		{FileName: "pkg-0.9-py3-none-any.whl"},
+	}
+	env := map[string]string{"python_version": "3.11", "python_full_version": "3.11.0", "platform_machine": "x86_64"}
+	requirement := PypiRequirement{Name: "pkg"}
+
+	_, selected, found := selectPypiDistribution(requirement, distributions, PypiDistributionFilter{All: true}, env)
+	if !found || len(selected) != 4 {
+		t.Fatalf("all wheels and sdist of 1.0 should be selected, got %+v", selected)
+	}
+	if selected[0].FileName != distributions[0].FileName {
+		t.Errorf("wheel for environment should go first, got %s", selected[0].FileName)
+	}
+
+	_, selected, found = selectPypiDistribution(requirement, distributions, PypiDistributionFilter{}, env)
+	if !found || len(selected) != 1 || selected[0].FileName != distributions[0].FileName {
+		t.Errorf("only wheel for environment should be selected, got %+v", selected)
+	}
+}
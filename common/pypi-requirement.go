@@ -0,0 +1,345 @@
+package common
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Зависимости python пакетов: строки Requires-Dist из METADATA и маркеры окружения (PEP 508)
+
+var pypiRequirementRegexp = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)\s*(?:\[([^\]]*)\])?\s*(.*)$`)
+
+// PypiRequirement - требование к пакету, например `requests[socks] (>=2.0) ; python_version >= "3.7"`
+type PypiRequirement struct {
+	Name      string
+	Extras    []string
+	Specifier PypiSpecifier
+	Marker    string
+}
+
+func ParsePypiRequirement(line string) (PypiRequirement, error) {
+	requirementPart, marker, _ := strings.Cut(line, ";")
+	matches := pypiRequirementRegexp.FindStringSubmatch(strings.TrimSpace(requirementPart))
+	if matches == nil {
+		return PypiRequirement{}, fmt.Errorf("invalid requirement '%s'", line)
+	}
+	specifier := strings.TrimSpace(matches[3])
+	if strings.HasPrefix(specifier, "@") {
+		return PypiRequirement{}, fmt.Errorf("url requirement '%s' is not supported", line)
+	}
+	specifier = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(specifier, "("), ")"))
+	requirement := PypiRequirement{
+		Name:      matches[1],
+		Specifier: PypiSpecifier(specifier),
+		Marker:    strings.TrimSpace(marker),
+	}
+	for _, extra := range strings.Split(matches[2], ",") {
+		if extra = strings.TrimSpace(extra); extra != "" {
+			requirement.Extras = append(requirement.Extras, NormalizePypiName(extra))
+		}
+	}
+	return requirement, nil
+}
+
+// IsRequired проверяет маркер требования для окружения env и запрошенных extras пакета-владельца
+func (r PypiRequirement) IsRequired(env map[string]string, extras []string) (bool, error) {
+	if r.Marker == "" {
+		return true, nil
+	}
+	for _, extra := range append([]string{""}, extras...) {
+		markerEnv := map[string]string{"extra": extra}
+		for key, value := range env {
+			markerEnv[key] = value
+		}
+		matched, err := EvaluatePypiMarker(r.Marker, markerEnv)
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+	return false, nil
+}
+
+// EvaluatePypiMarker вычисляет маркер окружения, например `python_version < "3.8" and extra == "test"`
+func EvaluatePypiMarker(marker string, env map[string]string) (bool, error) {
+	tokens, err := tokenizePypiMarker(marker)
+	if err != nil {
+		return false, err
+	}
+	parser := pypiMarkerParser{tokens: tokens, env: env}
+	result, err := parser.parseOr()
+	if err != nil {
+		return false, err
+	}
+	if parser.pos != len(tokens) {
+		return false, fmt.Errorf("unexpected '%s' in marker '%s'", tokens[parser.pos].text, marker)
+	}
+	return result, nil
+}
+
+type pypiMarkerToken struct {
+	text   string
+	quoted bool
+}
+
+func tokenizePypiMarker(marker string) ([]pypiMarkerToken, error) {
+	var tokens []pypiMarkerToken
+	for i := 0; i < len(marker); {
+		c := marker[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, pypiMarkerToken{text: string(c)})
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(marker[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string in marker '%s'", marker)
+			}
+			tokens = append(tokens, pypiMarkerToken{text: marker[i+1 : i+1+end], quoted: true})
+			i += end + 2
+		case strings.ContainsRune("=!<>~", rune(c)):
+			j := i
+			for j < len(marker) && strings.ContainsRune("=!<>~", rune(marker[j])) {
+				j++
+			}
+			tokens = append(tokens, pypiMarkerToken{text: marker[i:j]})
+			i = j
+		default:
+			j := i
+			for j < len(marker) && !strings.ContainsRune(" \t()\"'=!<>~", rune(marker[j])) {
+				j++
+			}
+			tokens = append(tokens, pypiMarkerToken{text: marker[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type pypiMarkerParser struct {
+	tokens []pypiMarkerToken
+	pos    int
+	env    map[string]string
+}
+
+func (p *pypiMarkerParser) peek() (pypiMarkerToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return pypiMarkerToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *pypiMarkerParser) next() (pypiMarkerToken, error) {
+	token, ok := p.peek()
+	if !ok {
+		return token, fmt.Errorf("unexpected end of marker")
+	}
+	p.pos++
+	return token, nil
+}
+
+func (p *pypiMarkerParser) parseOr() (bool, error) {
+	result, err := p.parseAnd()
+	for err == nil {
+		token, ok := p.peek()
+		if !ok || token.quoted || token.text != "or" {
+			break
+		}
+		p.pos++
+		var right bool
+		right, err = p.parseAnd()
+		result = result || right
+	}
+	return result, err
+}
+
+func (p *pypiMarkerParser) parseAnd() (bool, error) {
+	result, err := p.parseAtom()
+	for err == nil {
+		token, ok := p.peek()
+		if !ok || token.quoted || token.text != "and" {
+			break
+		}
+		p.pos++
+		var right bool
+		right, err = p.parseAtom()
+		result = result && right
+	}
+	return result, err
+}
+
+func (p *pypiMarkerParser) parseAtom() (bool, error) {
+	token, ok := p.peek()
+	if ok && !token.quoted && token.text == "(" {
+		p.pos++
+		result, err := p.parseOr()
+		if err != nil {
+			return false, err
+		}
+		if closing, err := p.next(); err != nil || closing.text != ")" {
+			return false, fmt.Errorf("missing ')' in marker")
+		}
+		return result, nil
+	}
+	left, err := p.parseValue()
+	if err != nil {
+		return false, err
+	}
+	operator, err := p.next()
+	if err != nil {
+		return false, err
+	}
+	op := operator.text
+	if op == "not" {
+		if in, err := p.next(); err != nil || in.text != "in" {
+			return false, fmt.Errorf("expected 'in' after 'not' in marker")
+		}
+		op = "not in"
+	}
+	right, err := p.parseValue()
+	if err != nil {
+		return false, err
+	}
+	return comparePypiMarker(left, op, right)
+}
+
+func (p *pypiMarkerParser) parseValue() (string, error) {
+	token, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if token.quoted {
+		return token.text, nil
+	}
+	value, found := p.env[token.text]
+	if !found {
+		return "", fmt.Errorf("unknown marker variable '%s'", token.text)
+	}
+	return value, nil
+}
+
+func comparePypiMarker(left, op, right string) (bool, error) {
+	switch op {
+	case "in":
+		return strings.Contains(right, left), nil
+	case "not in":
+		return !strings.Contains(right, left), nil
+	case "==", "!=", "<", "<=", ">", ">=", "~=", "===":
+	default:
+		return false, fmt.Errorf("unknown marker operator '%s'", op)
+	}
+	// версии сравниваются по PEP 440, остальное - как строки
+	if version, err := ParsePypiVersion(left); err == nil {
+		if _, err := ParsePypiVersion(strings.TrimSuffix(right, ".*")); err == nil {
+			return PypiSpecifier(op + right).Contains(version), nil
+		}
+	}
+	// extra сравнивается в нормальной форме
+	left, right = NormalizePypiName(left), NormalizePypiName(right)
+	switch op {
+	case "==", "===":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	case "<":
+		return left < right, nil
+	case "<=":
+		return left <= right, nil
+	case ">":
+		return left > right, nil
+	case ">=":
+		return left >= right, nil
+	}
+	// ~= применим только к версиям
+	return false, fmt.Errorf("operator '%s' is not applicable to '%s' and '%s' in marker", op, left, right)
+}
+
+// PypiMetadata - поля METADATA (PKG-INFO), нужные для разрешения зависимостей
+type PypiMetadata struct {
+	RequiresDist   []string
+	RequiresPython string
+}
+
+// ReadPypiMetadata читает METADATA из wheel или PKG-INFO из sdist
+func ReadPypiMetadata(filePath string) (PypiMetadata, error) {
+	fileName := path.Base(filePath)
+	switch {
+	case strings.HasSuffix(fileName, ".whl") || strings.HasSuffix(fileName, ".zip"):
+		zipReader, err := zip.OpenReader(filePath)
+		if err != nil {
+			return PypiMetadata{}, err
+		}
+		defer zipReader.Close()
+		for _, file := range zipReader.File {
+			dir, name := path.Split(file.Name)
+			isMetadata := name == "METADATA" && strings.HasSuffix(strings.TrimSuffix(dir, "/"), ".dist-info") && strings.Count(dir, "/") == 1
+			isPkgInfo := name == "PKG-INFO" && strings.Count(dir, "/") == 1
+			if !isMetadata && !isPkgInfo {
+				continue
+			}
+			reader, err := file.Open()
+			if err != nil {
+				return PypiMetadata{}, err
+			}
+			defer reader.Close()
+			return parsePypiMetadata(reader)
+		}
+	case strings.HasSuffix(fileName, ".tar.gz") || strings.HasSuffix(fileName, ".tgz"):
+		file, err := os.Open(filePath)
+		if err != nil {
+			return PypiMetadata{}, err
+		}
+		defer file.Close()
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return PypiMetadata{}, err
+		}
+		tarReader := tar.NewReader(gzipReader)
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return PypiMetadata{}, err
+			}
+			if path.Base(header.Name) == "PKG-INFO" && strings.Count(strings.Trim(header.Name, "/"), "/") == 1 {
+				return parsePypiMetadata(tarReader)
+			}
+		}
+	}
+	return PypiMetadata{}, fmt.Errorf("no metadata found in %s", fileName)
+}
+
+func parsePypiMetadata(reader io.Reader) (PypiMetadata, error) {
+	var metadata PypiMetadata
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// заголовки заканчиваются пустой строкой, дальше идёт описание пакета
+		if line == "" {
+			break
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "requires-dist":
+			metadata.RequiresDist = append(metadata.RequiresDist, strings.TrimSpace(value))
+		case "requires-python":
+			metadata.RequiresPython = strings.TrimSpace(value)
+		}
+	}
+	return metadata, scanner.Err()
+}
@@ -0,0 +1,78 @@
+package common
+
+import "testing"
+
+func TestEvaluatePypiMarker(t *testing.T) {
+	env := map[string]string{
+		"python_version":      "3.11",
+		"python_full_version": "3.11.4",
+		"sys_platform":        "linux",
+		"platform_machine":    "x86_64",
+		"implementation_name": "cpython",
+		"extra":               "",
+	}
+	withExtra := func(extra string) map[string]string {
+		result := map[string]string{}
+		for key, value := range env {
+			result[key] = value
+		}
+		result["extra"] = extra
+		return result
+	}
+	tests := []struct {
+		marker string
+		env    map[string]string
+		want   bool
+	}{
+		{`python_version >= "3.8"`, env, true},
+		{`python_version < "3.8"`, env, false},
+		{`python_version < "3.12"`, env, true},
+		{`python_full_version == "3.11.*"`, env, true},
+		{`python_version != "3.11"`, env, false},
+		{`"3.8" <= python_version`, env, true},
+		{`sys_platform == 'linux'`, env, true},
+		{`sys_platform == "win32"`, env, false},
+		{`extra == "test"`, env, false},
+		{`extra == "test"`, withExtra("test"), true},
+		{`extra == "Test_Extra"`, withExtra("test-extra"), true},
+		{`extra != "test"`, withExtra("docs"), true},
+		{`"linux" in sys_platform`, env, true},
+		{`platform_machine in "arm64 aarch64"`, env, false},
+		{`platform_machine not in "arm64 aarch64"`, env, true},
+		{`platform_machine not in "x86_64 amd64"`, env, false},
+		{`python_version < "3.8" or sys_platform == "linux"`, env, true},
+		{`python_version < "3.8" and sys_platform == "linux"`, env, false},
+		{`sys_platform == "win32" or sys_platform == "linux" and python_version < "3.8"`, env, false},
+		{`(sys_platform == "win32" or sys_platform == "linux") and python_version >= "3.8"`, env, true},
+		{`(python_version < "3.8" or implementation_name == "pypy") and extra == "dev"`, withExtra("dev"), false},
+		{`((sys_platform == "linux")) and (extra == "dev" or extra == "test")`, withExtra("test"), true},
+	}
+	for _, tt := range tests {
+		got, err := EvaluatePypiMarker(tt.marker, tt.env)
+		if err != nil {
+			t.Errorf("EvaluatePypiMarker(%s): %v", tt.marker, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("EvaluatePypiMarker(%s) = %v, want %v", tt.marker, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluatePypiMarkerInvalid(t *testing.T) {
+	env := map[string]string{"python_version": "3.11", "extra": ""}
+	for _, marker := range []string{
+		`python_version`,
+		`python_version <`,
+		`unknown_variable == "1"`,
+		`python_version == "3.11`,
+		`(python_version == "3.11"`,
+		`python_version == "3.11")`,
+		`python_version not "3.11"`,
+		`python_version ~ "3.11"`,
+	} {
+		if _, err := EvaluatePypiMarker(marker, env); err == nil {
+			t.Errorf("EvaluatePypiMarker(%s) should fail", marker)
+		}
+	}
+}
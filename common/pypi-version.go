@@ -0,0 +1,250 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Версии и спецификаторы версий python пакетов (PEP 440)
+
+var pypiVersionRegexp = regexp.MustCompile(`^v?(?:(\d+)!)?(\d+(?:\.\d+)*)` +
+	`(?:[-_.]?(a|alpha|b|beta|c|rc|pre|preview)[-_.]?(\d+)?)?` +
+	`(?:-(\d+)|[-_.]?(post|rev|r)[-_.]?(\d+)?)?` +
+	`(?:[-_.]?(dev)[-_.]?(\d+)?)?` +
+	`(?:\+([a-z0-9]+(?:[-_.][a-z0-9]+)*))?$`)
+
+var pypiNameRegexp = regexp.MustCompile(`[-_.]+`)
+
+type PypiVersion struct {
+	Raw     string
+	Epoch   int
+	Release []int
+	// PreKind: 0 - a, 1 - b, 2 - rc, -1 - нет
+	PreKind int
+	PreNum  int
+	// -1, если нет
+	Post int
+	Dev  int
+	// Local - локальная часть версии после '+'
+	Local string
+}
+
+// NormalizePypiName приводит имя пакета к нормальной форме (PEP 503)
+func NormalizePypiName(name string) string {
+	return strings.ToLower(pypiNameRegexp.ReplaceAllString(strings.TrimSpace(name), "-"))
+}
+
+func ParsePypiVersion(raw string) (PypiVersion, error) {
+	matches := pypiVersionRegexp.FindStringSubmatch(strings.ToLower(strings.TrimSpace(raw)))
+	if matches == nil {
+		return PypiVersion{}, fmt.Errorf("invalid python package version '%s'", raw)
+	}
+	version := PypiVersion{Raw: raw, PreKind: -1, Post: -1, Dev: -1, Local: matches[10]}
+	version.Epoch, _ = strconv.Atoi(matches[1])
+	for _, part := range strings.Split(matches[2], ".") {
+		number, _ := strconv.Atoi(part)
+		version.Release = append(version.Release, number)
+	}
+	if matches[3] != "" {
+		switch matches[3] {
+		case "a", "alpha":
+			version.PreKind = 0
+		case "b", "beta":
+			version.PreKind = 1
+		default:
+			version.PreKind = 2
+		}
+		version.PreNum, _ = strconv.Atoi(matches[4])
+	}
+	if matches[5] != "" {
+		version.Post, _ = strconv.Atoi(matches[5])
+	} else if matches[6] != "" {
+		version.Post, _ = strconv.Atoi(matches[7])
+	}
+	if matches[8] != "" {
+		version.Dev, _ = strconv.Atoi(matches[9])
+	}
+	return version, nil
+}
+
+// IsPrerelease - альфа, бета, rc или dev версия
+func (v PypiVersion) IsPrerelease() bool {
+	return v.PreKind >= 0 || v.Dev >= 0
+}
+
+// Compare возвращает -1, 0 или 1. Локальная часть версии не учитывается
+func (v PypiVersion) Compare(other PypiVersion) int {
+	if c := compareInt(v.Epoch, other.Epoch); c != 0 {
+		return c
+	}
+	for i := 0; i < len(v.Release) || i < len(other.Release); i++ {
+		if c := compareInt(releasePart(v.Release, i), releasePart(other.Release, i)); c != 0 {
+			return c
+		}
+	}
+	for i, key := range v.orderKey() {
+		if c := compareInt(key, other.orderKey()[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// orderKey - порядок pre, post и dev частей: 1.0.dev0 < 1.0a1 < 1.0 < 1.0.post1
+func (v PypiVersion) orderKey() [4]int {
+	preKind, preNum := v.PreKind, v.PreNum
+	if v.PreKind < 0 {
+		preKind = math.MaxInt32
+		if v.Post < 0 && v.Dev >= 0 {
+			preKind = math.MinInt32
+		}
+	}
+	dev := v.Dev
+	if dev < 0 {
+		dev = math.MaxInt32
+	}
+	return [4]int{preKind, preNum, v.Post, dev}
+}
+
+func releasePart(release []int, i int) int {
+	if i < len(release) {
+		return release[i]
+	}
+	return 0
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// PypiSpecifier - набор ограничений версии через запятую, например ">=1.2,<2,!=1.5.*"
+type PypiSpecifier string
+
+// AllowsPrereleases - спецификатор явно ссылается на pre-release версию
+func (s PypiSpecifier) AllowsPrereleases() bool {
+	for _, clause := range s.clauses() {
+		if version, err := ParsePypiVersion(strings.TrimSuffix(clause[1], ".*")); err == nil && version.IsPrerelease() {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains проверяет, удовлетворяет ли версия всем ограничениям
+func (s PypiSpecifier) Contains(version PypiVersion) bool {
+	for _, clause := range s.clauses() {
+		if !matchPypiClause(clause[0], clause[1], version) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s PypiSpecifier) clauses() [][2]string {
+	var clauses [][2]string
+	for _, clause := range strings.Split(string(s), ",") {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			continue
+		}
+		operator := ""
+		for _, candidate := range []string{"===", "~=", "==", "!=", "<=", ">=", "<", ">"} {
+			if strings.HasPrefix(clause, candidate) {
+				operator = candidate
+				break
+			}
+		}
+		clauses = append(clauses, [2]string{operator, strings.TrimSpace(strings.TrimPrefix(clause, operator))})
+	}
+	return clauses
+}
+
+func matchPypiClause(operator, specVersion string, version PypiVersion) bool {
+	if operator == "===" {
+		return strings.EqualFold(version.Raw, specVersion)
+	}
+	if operator == "==" || operator == "!=" {
+		matched := matchPypiEqual(specVersion, version)
+		return matched == (operator == "==")
+	}
+	spec, err := ParsePypiVersion(specVersion)
+	if err != nil {
+		return false
+	}
+	switch operator {
+	case "~=":
+		if len(spec.Release) < 2 {
+			return false
+		}
+		prefix := PypiVersion{Epoch: spec.Epoch, Release: spec.Release[:len(spec.Release)-1]}
+		return version.Compare(spec) >= 0 && hasReleasePrefix(version, prefix)
+	case "<=":
+		return version.Compare(spec) <= 0
+	case ">=":
+		return version.Compare(spec) >= 0
+	case "<":
+		// <V не включает pre-release версии самой V
+		if version.IsPrerelease() && !spec.IsPrerelease() && hasSamePypiRelease(version, spec) {
+			return false
+		}
+		return version.Compare(spec) < 0
+	case ">":
+		// >V не включает post-release версии самой V
+		if version.Post >= 0 && spec.Post < 0 && hasSamePypiRelease(version, spec) &&
+			version.PreKind == spec.PreKind && version.PreNum == spec.PreNum {
+			return false
+		}
+		return version.Compare(spec) > 0
+	}
+	return false
+}
+
+// hasSamePypiRelease - у версий совпадают epoch и номер релиза без pre, post и dev частей
+func hasSamePypiRelease(a, b PypiVersion) bool {
+	if a.Epoch != b.Epoch {
+		return false
+	}
+	for i := 0; i < len(a.Release) || i < len(b.Release); i++ {
+		if releasePart(a.Release, i) != releasePart(b.Release, i) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPypiEqual - сравнение для == с поддержкой шаблона "1.2.*"
+func matchPypiEqual(specVersion string, version PypiVersion) bool {
+	if strings.HasSuffix(specVersion, ".*") {
+		prefix, err := ParsePypiVersion(strings.TrimSuffix(specVersion, ".*"))
+		return err == nil && hasReleasePrefix(version, prefix)
+	}
+	spec, err := ParsePypiVersion(specVersion)
+	if err != nil {
+		return false
+	}
+	if spec.Local != "" && spec.Local != version.Local {
+		return false
+	}
+	return version.Compare(spec) == 0
+}
+
+func hasReleasePrefix(version, prefix PypiVersion) bool {
+	if version.Epoch != prefix.Epoch {
+		return false
+	}
+	for i, part := range prefix.Release {
+		if releasePart(version.Release, i) != part {
+			return false
+		}
+	}
+	return true
+}
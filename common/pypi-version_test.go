@@ -0,0 +1,168 @@
+package common
+
+import "testing"
+
+func TestParsePypiVersionCompare(t *testing.T) {
+	// версии в порядке возрастания по PEP 440
+	ordered := []string{
+		"1.0.dev0",
+		"1.0a1.dev1",
+		"1.0a1",
+		"1.0a2",
+		"1.0b1",
+		"1.0rc1",
+		"1.0",
+		"1.0.post1.dev0",
+		"1.0.post1",
+		"1.0.1",
+		"1.1.dev1",
+		"1.1",
+		"1!0.1",
+	}
+	versions := make([]PypiVersion, len(ordered))
+	for i, raw := range ordered {
+		version, err := ParsePypiVersion(raw)
+		if err != nil {
+			t.Fatalf("ParsePypiVersion(%q): %v", raw, err)
+		}
+		versions[i] = version
+	}
+	for i := range versions {
+		for j := range versions {
+			want := compareInt(i, j)
+			if got := versions[i].Compare(versions[j]); got != want {
+				t.Errorf("%s.Compare(%s) = %d, want %d", ordered[i], ordered[j], got, want)
+			}
+		}
+	}
+}
+
+func TestParsePypiVersionNormalization(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"1.0", "1.0.0"},
+		{"1.0RC1", "1.0rc1"},
+		{"1.0c1", "1.0rc1"},
+		{"1.0-alpha.1", "1.0a1"},
+		{"1.0-1", "1.0.post1"},
+		{"1.0.rev2", "1.0.post2"},
+		{"v1.0", "1.0"},
+		{"1.0+local.1", "1.0"},
+	}
+	for _, tt := range tests {
+		a, err := ParsePypiVersion(tt.a)
+		if err != nil {
+			t.Fatalf("ParsePypiVersion(%q): %v", tt.a, err)
+		}
+		b, err := ParsePypiVersion(tt.b)
+		if err != nil {
+			t.Fatalf("ParsePypiVersion(%q): %v", tt.b, err)
+		}
+		if a.Compare(b) != 0 {
+			t.Errorf("%s and %s should be equal", tt.a, tt.b)
+		}
+	}
+}
+
+func TestParsePypiVersionInvalid(t *testing.T) {
+	for _, raw := range []string{"", "abc", "1.0-", "1..0", "1.0+"} {
+		if _, err := ParsePypiVersion(raw); err == nil {
+			t.Errorf("ParsePypiVersion(%q) should fail", raw)
+		}
+	}
+}
+
+func TestPypiVersionIsPrerelease(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want bool
+	}{
+		{"1.0", false},
+		{"1.0.post1", false},
+		{"1.0a1", true},
+		{"1.0rc1", true},
+		{"1.0.dev0", true},
+		{"1.0.post1.dev0", true},
+	}
+	for _, tt := range tests {
+		version, err := ParsePypiVersion(tt.raw)
+		if err != nil {
+			t.Fatalf("ParsePypiVersion(%q): %v", tt.raw, err)
+		}
+		if got := version.IsPrerelease(); got != tt.want {
+			t.Errorf("%s.IsPrerelease() = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestPypiSpecifierContains(t *testing.T) {
+	tests := []struct {
+		specifier PypiSpecifier
+		version   string
+		want      bool
+	}{
+		{"", "1.0", true},
+		{"~=1.4.5", "1.4.5", true},
+		{"~=1.4.5", "1.4.9", true},
+		{"~=1.4.5", "1.5.0", false},
+		{"~=1.4.5", "1.4.4", false},
+		{"~=2.2", "2.9", true},
+		{"~=2.2", "3.0", false},
+		{"~=2", "2.0", false},
+		{"==1.2.*", "1.2", true},
+		{"==1.2.*", "1.2.7", true},
+		{"==1.2.*", "1.2.0rc1", true},
+		{"==1.2.*", "1.3", false},
+		{"==1.2.*", "1.20", false},
+		{"!=1.2.*", "1.3", true},
+		{"!=1.2.*", "1.2.1", false},
+		{"==1.2", "1.2.0", true},
+		{"==1.2", "1.2+local", true},
+		{"==1.2+local", "1.2+local", true},
+		{"==1.2+local", "1.2", false},
+		{"==1.2+local", "1.2+other", false},
+		{">1.2", "1.2+local", false},
+		{"<=1.2", "1.2+local", true},
+		{"===1.2+Local", "1.2+local", true},
+		{"===1.2", "1.2.0", false},
+		{">=1.0,<2,!=1.5", "1.4", true},
+		{">=1.0,<2,!=1.5", "1.5", false},
+		{">=1.0,<2,!=1.5", "2.0", false},
+		{"<2", "2.0.dev1", false},
+		{"<2", "1.9rc1", true},
+		{"<2rc2", "2.0rc1", true},
+		{">1.0", "1.0.post1", false},
+		{">1.0", "1.0.1", true},
+		{">1.0.post1", "1.0.post2", true},
+		{">=1.0", "1.0rc1", false},
+		{">=invalid", "1.0", false},
+	}
+	for _, tt := range tests {
+		version, err := ParsePypiVersion(tt.version)
+		if err != nil {
+			t.Fatalf("ParsePypiVersion(%q): %v", tt.version, err)
+		}
+		if got := tt.specifier.Contains(version); got != tt.want {
+			t.Errorf("%q.Contains(%s) = %v, want %v", tt.specifier, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestPypiSpecifierAllowsPrereleases(t *testing.T) {
+	tests := []struct {
+		specifier PypiSpecifier
+		want      bool
+	}{
+		{"", false},
+		{">=1.0", false},
+		{">=1.0rc1", true},
+		{"==2.0.dev0", true},
+		{"==1.2.*", false},
+	}
+	for _, tt := range tests {
+		if got := tt.specifier.AllowsPrereleases(); got != tt.want {
+			t.Errorf("%q.AllowsPrereleases() = %v, want %v", tt.specifier, got, tt.want)
+		}
+	}
+}
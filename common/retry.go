@@ -0,0 +1,126 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/errdefs"
+	"github.com/hirochachacha/go-smb2"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy описывает повтор операций при временных ошибках
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func GetRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    StartupConfig.GetRetryMaxAttempts(),
+		InitialBackoff: StartupConfig.GetRetryInitialBackoff(),
+		MaxBackoff:     StartupConfig.GetRetryMaxBackoff(),
+	}
+}
+
+// Backoff возвращает задержку перед следующей попыткой: InitialBackoff * 2^(attempt-1), но не больше MaxBackoff
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return backoff
+}
+
+// HttpStatusError - ответ сервера с неуспешным http-кодом
+type HttpStatusError struct {
+	Url        string
+	StatusCode int
+}
+
+func (e *HttpStatusError) Error() string {
+	return fmt.Sprintf("request %s failed with status %d", e.Url, e.StatusCode)
+}
+
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+// Transient помечает ошибку как временную, после неё операцию можно повторить
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &transientError{err: err}
+}
+
+// IsRetryable определяет, имеет ли смысл повторить операцию после ошибки.
+// Повторяются сетевые ошибки, обрывы соединения, ответы 408, 429 и 5xx
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var transient *transientError
+	if errors.As(err, &transient) {
+		return true
+	}
+	var statusErr *HttpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusRequestTimeout ||
+			statusErr.StatusCode == http.StatusTooManyRequests ||
+			statusErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	var smbErr *smb2.TransportError
+	if errors.As(err, &netErr) || errors.As(err, &smbErr) {
+		return true
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ETIMEDOUT) ||
+		errors.Is(err, syscall.EAGAIN) ||
+		errors.Is(err, syscall.EIO) {
+		return true
+	}
+	return errdefs.IsUnavailable(err) || errdefs.IsSystem(err) || errdefs.IsDeadline(err)
+}
+
+// Retry выполняет op, пока она не завершится успешно, не вернёт постоянную ошибку
+// или не закончатся попытки. onFailure вызывается после каждой неудачной попытки
+func Retry(ctx context.Context, policy RetryPolicy, name string, op func(attempt int) error, onFailure func(attempt int, err error)) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = op(attempt)
+		if err == nil {
+			return nil
+		}
+		if onFailure != nil {
+			onFailure(attempt, err)
+		}
+		if attempt >= policy.MaxAttempts || !IsRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+		backoff := policy.Backoff(attempt)
+		log.Printf("%s: attempt %d/%d failed: %v. Retrying in %s\n", name, attempt, policy.MaxAttempts, err, backoff)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+	}
+}
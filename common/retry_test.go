@@ -0,0 +1,110 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, test := range tests {
+		if got := policy.Backoff(test.attempt); got != test.want {
+			t.Errorf("Backoff(%d) = %s, want %s", test.attempt, got, test.want)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain error", errors.New("bad request"), false},
+		{"cancelled", context.Canceled, false},
+		{"cancelled transient", Transient(context.Canceled), false},
+		{"transient", Transient(errors.New("checksum mismatch")), true},
+		{"wrapped transient", fmt.Errorf("download: %w", Transient(errors.New("short read"))), true},
+		{"http 404", &HttpStatusError{StatusCode: http.StatusNotFound}, false},
+		{"http 408", &HttpStatusError{StatusCode: http.StatusRequestTimeout}, true},
+		{"http 429", &HttpStatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"http 503", &HttpStatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"unexpected eof", fmt.Errorf("read body: %w", io.ErrUnexpectedEOF), true},
+		{"connection reset", &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}, true},
+		{"file not found", os.ErrNotExist, false},
+	}
+	for _, test := range tests {
+		if got := IsRetryable(test.err); got != test.want {
+			t.Errorf("%s: IsRetryable() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	errTemporary := Transient(errors.New("connection reset"))
+	errPermanent := errors.New("not found")
+	tests := []struct {
+		name         string
+		errs         []error
+		wantErr      error
+		wantAttempts int
+		wantFailures int
+	}{
+		{"success", []error{nil}, nil, 1, 0},
+		{"success after retries", []error{errTemporary, errTemporary, nil}, nil, 3, 2},
+		{"attempts exhausted", []error{errTemporary, errTemporary, errTemporary, nil}, errTemporary, 3, 3},
+		{"permanent error", []error{errPermanent, nil}, errPermanent, 1, 1},
+	}
+	for _, test := range tests {
+		attempts, failures := 0, 0
+		err := Retry(context.Background(), policy, test.name, func(attempt int) error {
+			attempts = attempt
+			return test.errs[attempt-1]
+		}, func(attempt int, err error) {
+			failures++
+		})
+		if err != test.wantErr {
+			t.Errorf("%s: Retry() error = %v, want %v", test.name, err, test.wantErr)
+		}
+		if attempts != test.wantAttempts {
+			t.Errorf("%s: %d attempts, want %d", test.name, attempts, test.wantAttempts)
+		}
+		if failures != test.wantFailures {
+			t.Errorf("%s: onFailure called %d times, want %d", test.name, failures, test.wantFailures)
+		}
+	}
+}
+
+func TestRetryStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	attempts := 0
+	err := Retry(ctx, policy, "cancelled", func(attempt int) error {
+		attempts = attempt
+		cancel()
+		return Transient(errors.New("connection reset"))
+	}, nil)
+	if err == nil || attempts != 1 {
+		t.Errorf("Retry() error = %v after %d attempts, want error after 1 attempt", err, attempts)
+	}
+}
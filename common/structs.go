@@ -1,6 +1,10 @@
 package common
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"fts-cd-file-utility/cfg"
 	"io"
 	"time"
 )
@@ -8,7 +12,8 @@ import (
 type Artifact interface {
 	GetOriginalResourceName() string
 
-	GetArtifactNameAndStream() (ArtifactNameAndStream, error)
+	// ctx отменяется при отмене задания и прерывает скачивание
+	GetArtifactNameAndStream(ctx context.Context) (ArtifactNameAndStream, error)
 
 	/*
 	 * performs cleanup on send-server
@@ -25,22 +30,253 @@ type Artifact interface {
 	GetType() ArtifactType
 }
 
+// JobFileNameArtifact - артефакт, имя файла которого на шаре строится по jobId, если источник не сообщил имя.
+// Так файлы параллельных заданий не перезаписывают друг друга
+type JobFileNameArtifact interface {
+	Artifact
+	GetDownloadFileName(jobId string) string
+}
+
 type ArtifactNameAndStream struct {
 	Name   string
 	Stream io.ReadCloser
+	// Смещение, с которого начинается Stream, если скачивание продолжено
+	Offset int64
+	// Полный размер файла, если известен
+	Size int64
+	// ETag или Last-Modified для продолжения скачивания через If-Range
+	Validator string
+	// Метаданные, найденные при скачивании (версия, архитектура и т.д.), попадают в .job файл
+	Metadata map[string]string
 }
 
+// Job - задание на перенос docker образа
 type Job struct {
-	Artifact string `json:"artifact"`
+	Artifact  string   `json:"artifact"`
+	Platforms []string `json:"platforms"`
+}
+
+func (j *Job) ToArtifact() (Artifact, error) {
+	if len(j.Platforms) > 0 && StartupConfig.SendDockerTransport != cfg.RegistryDockerTransport {
+		return nil, &JobRequestError{Message: fmt.Sprintf("field 'platforms' requires `send_docker_transport` set to '%s'", cfg.RegistryDockerTransport)}
+	}
+	for _, platform := range j.Platforms {
+		if platform == AllPlatforms {
+			if len(j.Platforms) > 1 {
+				return nil, &JobRequestError{Message: fmt.Sprintf("platform '%s' can't be combined with other platforms", AllPlatforms)}
+			}
+			continue
+		}
+		if _, err := ParseOciPlatform(platform); err != nil {
+			return nil, &JobRequestError{Message: err.Error()}
+		}
+	}
+	return DockerArtifact{ImageName: j.Artifact, Platforms: j.Platforms}, nil
 }
 
 type PypiJob struct {
-	Artifact string `json:"package"`
-	Version  string `json:"version"`
+	Artifact         string `json:"package"`
+	Version          string `json:"version"`
+	WithDependencies bool   `json:"withDependencies"`
+	PypiDistributionFilter
+}
+
+func (j *PypiJob) ToArtifact() (Artifact, error) {
+	for _, fileType := range j.FileTypes {
+		if fileType != PYPI_FILE_TYPE_WHEEL && fileType != PYPI_FILE_TYPE_SDIST {
+			return nil, &JobRequestError{Message: fmt.Sprintf("unknown file type '%s', expected '%s' or '%s'", fileType, PYPI_FILE_TYPE_WHEEL, PYPI_FILE_TYPE_SDIST)}
+		}
+	}
+	return PypiArtifact{
+		PackageName:      j.Artifact,
+		Version:          j.Version,
+		WithDependencies: j.WithDependencies,
+		Filter:           j.PypiDistributionFilter,
+	}, nil
 }
 
 type HfJob struct {
-	Artifact string `json:"model"`
+	Artifact string   `json:"model"`
+	RepoType string   `json:"repoType"`
+	Revision string   `json:"revision"`
+	Include  []string `json:"include"`
+	Exclude  []string `json:"exclude"`
+}
+
+func (j *HfJob) ToArtifact() (Artifact, error) {
+	if j.Artifact == "" {
+		return nil, &JobRequestError{Message: "field 'model' must be set"}
+	}
+	if _, ok := GetHfRepoPrefix(j.RepoType); !ok {
+		return nil, &JobRequestError{Message: fmt.Sprintf("unknown repo type '%s', expected 'model', 'dataset' or 'space'", j.RepoType)}
+	}
+	return HfArtifact{
+		ModelName: j.Artifact,
+		RepoType:  j.RepoType,
+		Revision:  j.Revision,
+		Include:   j.Include,
+		Exclude:   j.Exclude,
+	}, nil
+}
+
+type MavenJob struct {
+	GroupId    string `json:"groupId"`
+	ArtifactId string `json:"artifactId"`
+	Version    string `json:"version"`
+	Classifier string `json:"classifier"`
+	Extension  string `json:"extension"`
+}
+
+func (j *MavenJob) ToArtifact() (Artifact, error) {
+	return MavenArtifact{
+		GroupId:    j.GroupId,
+		ArtifactId: j.ArtifactId,
+		Version:    j.Version,
+		Classifier: j.Classifier,
+		Extension:  j.Extension,
+	}, nil
+}
+
+type RawJob struct {
+	// url файла или путь в raw-репозитории Nexus
+	Artifact string `json:"artifact"`
+	// Каталог в raw-hosted репозитории на стороне RECEIVE
+	Directory string `json:"directory"`
+}
+
+func (j *RawJob) ToArtifact() (Artifact, error) {
+	if j.Artifact == "" {
+		return nil, &JobRequestError{Message: "field 'artifact' must be set"}
+	}
+	return HttpArtifact{
+		DownloadFilePath: j.Artifact,
+		Directory:        j.Directory,
+	}, nil
+}
+
+type HelmJob struct {
+	Artifact string `json:"chart"`
+	// По умолчанию последняя версия
+	Version string   `json:"version"`
+	Images  []string `json:"images"`
+	// Найти образы в манифестах, отрендеренных `helm template`
+	RenderImages bool `json:"renderImages"`
+}
+
+func (j *HelmJob) ToArtifact() (Artifact, error) {
+	return HelmArtifact{
+		ChartName:    j.Artifact,
+		Version:      j.Version,
+		Images:       j.Images,
+		RenderImages: j.RenderImages,
+	}, nil
+}
+
+type GoModuleJob struct {
+	Artifact string `json:"module"`
+	// Версия или latest, по умолчанию latest
+	Version string `json:"version"`
+	// h1: хеш из go.sum
+	Sum string `json:"sum"`
+}
+
+func (j *GoModuleJob) ToArtifact() (Artifact, error) {
+	return GoModuleArtifact{
+		ModulePath: j.Artifact,
+		Version:    j.Version,
+		Sum:        j.Sum,
+	}, nil
+}
+
+// OsPackageJob - задание на скачивание .deb или .rpm пакета
+type OsPackageJob struct {
+	Artifact     string `json:"package"`
+	Version      string `json:"version"`
+	Architecture string `json:"architecture"`
+}
+
+type AptJob struct {
+	OsPackageJob
+}
+
+func (j *AptJob) ToArtifact() (Artifact, error) {
+	return AptArtifact{
+		PackageName:  j.Artifact,
+		Version:      j.Version,
+		Architecture: j.Architecture,
+	}, nil
+}
+
+type YumJob struct {
+	OsPackageJob
+}
+
+func (j *YumJob) ToArtifact() (Artifact, error) {
+	return YumArtifact{
+		PackageName:  j.Artifact,
+		Version:      j.Version,
+		Architecture: j.Architecture,
+	}, nil
+}
+
+type NpmJob struct {
+	Artifact string `json:"package"`
+	// Версия или dist-tag, по умолчанию latest
+	Version string `json:"version"`
+	Scope   string `json:"scope"`
+}
+
+func (j *NpmJob) ToArtifact() (Artifact, error) {
+	return NpmArtifact{
+		PackageName: j.Artifact,
+		Version:     j.Version,
+		Scope:       j.Scope,
+	}, nil
+}
+
+type NugetJob struct {
+	Artifact string `json:"package"`
+	// По умолчанию последняя версия
+	Version string `json:"version"`
+}
+
+func (j *NugetJob) ToArtifact() (Artifact, error) {
+	return NugetArtifact{
+		PackageName: j.Artifact,
+		Version:     j.Version,
+	}, nil
+}
+
+type CondaJob struct {
+	Artifact string `json:"package"`
+	// По умолчанию последняя версия
+	Version string `json:"version"`
+	// Строка сборки, например py311h64a7726_0
+	Build string `json:"build"`
+	// Платформа канала, например linux-64 или noarch
+	Subdir string `json:"subdir"`
+}
+
+func (j *CondaJob) ToArtifact() (Artifact, error) {
+	return CondaArtifact{
+		PackageName: j.Artifact,
+		Version:     j.Version,
+		Build:       j.Build,
+		Subdir:      j.Subdir,
+	}, nil
+}
+
+type CargoJob struct {
+	Artifact string `json:"crate"`
+	// По умолчанию последняя версия
+	Version string `json:"version"`
+}
+
+func (j *CargoJob) ToArtifact() (Artifact, error) {
+	return CargoArtifact{
+		CrateName: j.Artifact,
+		Version:   j.Version,
+	}, nil
 }
 
 type JobStatus struct {
@@ -49,32 +285,109 @@ type JobStatus struct {
 	ArtifactPath string       `json:"path"`
 	Status       CdStatus     `json:"status"`
 	StatusDttm   time.Time    `json:"statusDttm"`
+	// Позиция в очереди для заданий в статусе QUEUED
+	QueuePosition int `json:"queuePosition,omitempty"`
+	// Число попыток и последняя ошибка при повторах скачивания/загрузки
+	Attempts  int    `json:"attempts,omitempty"`
+	LastError string `json:"lastError,omitempty"`
+	// Причина неудачи задания
+	Error *JobError `json:"error,omitempty"`
+	// История статусов задания
+	History []StatusTransition `json:"history,omitempty"`
+	// Ход скачивания артефакта
+	Progress *JobProgress `json:"progress,omitempty"`
+	// Подтверждение загрузки от RECEIVE
+	Deploy *DeployAck `json:"deploy,omitempty"`
+	// Метаданные артефакта, найденные при скачивании
+	Metadata map[string]string `json:"metadata,omitempty"`
 	// Данные о фрагментации файла
-	IsChunked    bool         `json:"isChunked,omitempty"`
-	ChunkCount   int          `json:"chunkCount,omitempty"`
-	TotalSize    int64        `json:"totalSize,omitempty"`
-	Chunks       []FileChunk  `json:"chunks,omitempty"`
+	IsChunked  bool        `json:"isChunked,omitempty"`
+	ChunkCount int         `json:"chunkCount,omitempty"`
+	TotalSize  int64       `json:"totalSize,omitempty"`
+	Chunks     []FileChunk `json:"chunks,omitempty"`
 	// Хеш-суммы файла
-	MD5Hash      string       `json:"md5Hash,omitempty"`
-	SHA256Hash   string       `json:"sha256Hash,omitempty"`
-	Hash         string       `json:"hash,omitempty"`
+	MD5Hash    string `json:"md5Hash,omitempty"`
+	SHA256Hash string `json:"sha256Hash,omitempty"`
+	Hash       string `json:"hash,omitempty"`
+}
+
+// JobProgress - ход скачивания: скачано байт, полный размер, скорость и оставшееся время
+type JobProgress struct {
+	BytesDone int64 `json:"bytesDone"`
+	// 0, если размер неизвестен (например, для docker образов)
+	TotalBytes     int64     `json:"totalBytes,omitempty"`
+	BytesPerSecond int64     `json:"bytesPerSecond"`
+	EtaSeconds     int64     `json:"etaSeconds,omitempty"`
+	UpdatedDttm    time.Time `json:"updatedDttm"`
 }
 
 type CdStatus string
 type ArtifactType string
 
 const (
-	DOWNLOADING           CdStatus     = "DOWNLOADING"
-	DOWNLOADING_FAILED    CdStatus     = "DOWNLOADING_FAILED"
-	META_WRITING_FAILED   CdStatus     = "META_WRITING_FAILED"
-	DOWNLOADING_DONE      CdStatus     = "DOWNLOADING_DONE"
-	CHUNKED              CdStatus     = "CHUNKED"
-	CHUNK_DOWNLOADING    CdStatus     = "CHUNK_DOWNLOADING"
-	CHUNK_DONE           CdStatus     = "CHUNK_DONE"
-	CHUNKS_MERGING       CdStatus     = "CHUNKS_MERGING"
-	CHUNKS_MERGE_FAILED  CdStatus     = "CHUNKS_MERGE_FAILED"
-	SUCCESS               CdStatus     = "SUCCESS"
-	DOCKER                ArtifactType = "DOCKER"
-	PYPI                  ArtifactType = "PYPI"
-	HF                    ArtifactType = "HF"
+	QUEUED              CdStatus     = "QUEUED"
+	DOWNLOADING         CdStatus     = "DOWNLOADING"
+	DOWNLOADING_FAILED  CdStatus     = "DOWNLOADING_FAILED"
+	META_WRITING_FAILED CdStatus     = "META_WRITING_FAILED"
+	DOWNLOADING_DONE    CdStatus     = "DOWNLOADING_DONE"
+	CHUNKED             CdStatus     = "CHUNKED"
+	CHUNK_DOWNLOADING   CdStatus     = "CHUNK_DOWNLOADING"
+	CHUNK_DONE          CdStatus     = "CHUNK_DONE"
+	CHUNKS_MERGING      CdStatus     = "CHUNKS_MERGING"
+	CHUNKS_MERGE_FAILED CdStatus     = "CHUNKS_MERGE_FAILED"
+	SUCCESS             CdStatus     = "SUCCESS"
+	INTERRUPTED         CdStatus     = "INTERRUPTED"
+	CANCELLED           CdStatus     = "CANCELLED"
+	DEPLOYED            CdStatus     = "DEPLOYED"
+	DEPLOY_FAILED       CdStatus     = "DEPLOY_FAILED"
+	DOCKER              ArtifactType = "DOCKER"
+	PYPI                ArtifactType = "PYPI"
+	HF                  ArtifactType = "HF"
+	NPM                 ArtifactType = "NPM"
+	MAVEN               ArtifactType = "MAVEN"
+	RAW                 ArtifactType = "RAW"
+	HELM                ArtifactType = "HELM"
+	GO                  ArtifactType = "GO"
+	APT                 ArtifactType = "APT"
+	YUM                 ArtifactType = "YUM"
+	NUGET               ArtifactType = "NUGET"
+	CONDA               ArtifactType = "CONDA"
+	CARGO               ArtifactType = "CARGO"
 )
+
+// IsFinalStatus - задание на стороне SEND больше не изменит статус
+func IsFinalStatus(status CdStatus) bool {
+	switch status {
+	case SUCCESS, DOWNLOADING_FAILED, META_WRITING_FAILED, CANCELLED, DEPLOYED, DEPLOY_FAILED:
+		return true
+	}
+	return false
+}
+
+// NewArtifactByType возвращает пустой артефакт нужного типа,
+// в который можно десериализовать поле `artifact` из JobStatus
+func NewArtifactByType(artifactType ArtifactType) (Artifact, error) {
+	if definition, found := GetArtifactTypeDefinition(artifactType); found {
+		return definition.NewArtifact(), nil
+	}
+	return nil, fmt.Errorf("unknown artifact type '%s'", artifactType)
+}
+
+// UnmarshalJobStatus восстанавливает JobStatus вместе с артефактом конкретного типа
+func UnmarshalJobStatus(data []byte) (JobStatus, error) {
+	var header struct {
+		ArtifactType ArtifactType `json:"artifactType"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return JobStatus{}, err
+	}
+	artifact, err := NewArtifactByType(header.ArtifactType)
+	if err != nil {
+		return JobStatus{}, err
+	}
+	jobStatus := JobStatus{Artifact: artifact}
+	if err := json.Unmarshal(data, &jobStatus); err != nil {
+		return JobStatus{}, err
+	}
+	return jobStatus, nil
+}
@@ -0,0 +1,26 @@
+package common
+
+import "testing"
+
+func TestIsFinalStatus(t *testing.T) {
+	tests := map[CdStatus]bool{
+		QUEUED:              false,
+		DOWNLOADING:         false,
+		DOWNLOADING_DONE:    false,
+		CHUNKED:             false,
+		CHUNK_DOWNLOADING:   false,
+		CHUNK_DONE:          false,
+		INTERRUPTED:         false,
+		SUCCESS:             true,
+		DOWNLOADING_FAILED:  true,
+		META_WRITING_FAILED: true,
+		CANCELLED:           true,
+		DEPLOYED:            true,
+		DEPLOY_FAILED:       true,
+	}
+	for status, want := range tests {
+		if got := IsFinalStatus(status); got != want {
+			t.Errorf("IsFinalStatus(%s) = %v, want %v", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package common
+
+import (
+	"archive/tar"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const tarBlockSize = 512
+
+// tarEntrySize - размер записи в tar архиве: заголовок и данные, выровненные по блоку
+func tarEntrySize(size int64) int64 {
+	return tarBlockSize + (size+tarBlockSize-1)/tarBlockSize*tarBlockSize
+}
+
+// openTarBundle отдаёт файлы fileNames из dir одним tar архивом name.
+// dir удаляется после передачи архива или при ошибке
+func openTarBundle(dir, name string, fileNames []string) (ArtifactNameAndStream, error) {
+	size := int64(2 * tarBlockSize)
+	for _, fileName := range fileNames {
+		info, err := os.Stat(filepath.Join(dir, fileName))
+		if err != nil {
+			os.RemoveAll(dir)
+			return ArtifactNameAndStream{}, err
+		}
+		size += tarEntrySize(info.Size())
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeTarFiles(writer, dir, fileNames))
+		os.RemoveAll(dir)
+	}()
+	return ArtifactNameAndStream{
+		Name:   name,
+		Stream: reader,
+		Size:   size,
+	}, nil
+}
+
+// writeTarFiles пишет файлы из dir в tar архив
+func writeTarFiles(writer io.Writer, dir string, fileNames []string) error {
+	tarWriter := tar.NewWriter(writer)
+	for _, fileName := range fileNames {
+		file, err := os.Open(filepath.Join(dir, fileName))
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err == nil {
+			err = tarWriter.WriteHeader(&tar.Header{Name: fileName, Mode: 0644, Size: info.Size()})
+		}
+		if err == nil {
+			_, err = io.Copy(tarWriter, file)
+		}
+		file.Close()
+		if err != nil {
+			log.Printf("failed to add %s to archive: %v\n", fileName, err)
+			return err
+		}
+	}
+	return tarWriter.Close()
+}
@@ -0,0 +1,66 @@
+package common
+
+import (
+	"context"
+	"strings"
+)
+
+const YumAnyArchitecture = "noarch"
+
+// YumArtifact - .rpm пакет из yum-репозитория Nexus.
+// Version - версия с релизом, например 1.20.1-1.el8 (по умолчанию последняя), Architecture - например x86_64 (по умолчанию любая)
+type YumArtifact struct {
+	PackageName  string
+	Version      string
+	Architecture string
+}
+
+func (a YumArtifact) GetType() ArtifactType {
+	return YUM
+}
+
+func (a YumArtifact) GetOriginalResourceName() string {
+	return a.query().resourceName()
+}
+
+func (a YumArtifact) GetArtifactNameAndStream(ctx context.Context) (ArtifactNameAndStream, error) {
+	return a.GetArtifactNameAndStreamFrom(ctx, 0, "")
+}
+
+func (a YumArtifact) GetArtifactNameAndStreamFrom(ctx context.Context, offset int64, validator string) (ArtifactNameAndStream, error) {
+	return openOsPackage(ctx, a.query(), offset, validator)
+}
+
+func (a YumArtifact) query() osPackageQuery {
+	return osPackageQuery{
+		kind:              "yum",
+		repository:        StartupConfig.SendNexusYumRepository,
+		name:              a.PackageName,
+		version:           a.Version,
+		architecture:      a.Architecture,
+		assetArchitecture: GetRpmArchitecture,
+		anyArchitecture:   YumAnyArchitecture,
+	}
+}
+
+// GetRpmArchitecture возвращает архитектуру из имени файла вида <name>-<version>-<release>.<arch>.rpm.
+// Пакеты с исходниками (.src.rpm) не подходят
+func GetRpmArchitecture(fileName string) string {
+	if !strings.HasSuffix(fileName, ".rpm") || strings.HasSuffix(fileName, ".src.rpm") {
+		return ""
+	}
+	name := strings.TrimSuffix(fileName, ".rpm")
+	dot := strings.LastIndex(name, ".")
+	if dot < 0 {
+		return ""
+	}
+	return name[dot+1:]
+}
+
+func (a YumArtifact) DeliverCleanup() error {
+	return nil
+}
+
+func (a YumArtifact) DeployCleanup() error {
+	return nil
+}
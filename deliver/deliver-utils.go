@@ -1,6 +1,7 @@
 package deliver
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -14,77 +15,158 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 )
 
-var jobStatusMap = JobStatusMap{
-	JobStatusMap: make(map[string]common.JobStatus),
-	Lock:         sync.RWMutex{},
-}
-
-var latestJob string
+// latestJob - идентификатор последнего созданного задания, защищён latestJobLock
+var (
+	latestJob     string
+	latestJobLock sync.RWMutex
+)
 
-func StartDockerCdHandlerWithJobId(c echo.Context) error {
-	jobId := c.Param("jobId")
-	return startDockerJob(jobId, c)
+// NewStartCdHandler возвращает обработчик POST /cd-<name>-start и /cd-<name>-start/:jobId для типа артефакта.
+// Если jobId не передан в пути, он формируется автоматически
+func NewStartCdHandler(definition common.ArtifactTypeDefinition) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return startJob(getOrGenerateJobId(c), definition, c)
+	}
 }
 
-func StartPypiCdHandler(c echo.Context) error {
-	jobId := generateJobId()
-	return startPypiJob(jobId, c)
+// StartCdHandler запускает задание по типу артефакта из пути: POST /cd-start/:type и /cd-start/:type/:jobId.
+// Для совместимости POST /cd-start/:jobId, где вместо типа указан jobId, запускает скачивание произвольного файла
+func StartCdHandler(c echo.Context) error {
+	definition, found := common.FindArtifactTypeByName(c.Param("type"))
+	if found {
+		return startJob(getOrGenerateJobId(c), definition, c)
+	}
+	if c.Param("jobId") != "" {
+		return c.JSONPretty(http.StatusNotFound, map[string]interface{}{
+			"success":      false,
+			"errorMessage": fmt.Sprintf("unknown artifact type '%s'", c.Param("type")),
+		}, "  ")
+	}
+	definition, _ = common.GetArtifactTypeDefinition(common.RAW)
+	return startJob(c.Param("type"), definition, c)
 }
 
-func StartHfCdHandler(c echo.Context) error {
-	jobId := generateJobId()
-	return startHfJob(jobId, c)
+// StartFileCdHandler запускает задание по скачиванию произвольного файла с автоматически сформированным jobId
+func StartFileCdHandler(c echo.Context) error {
+	definition, _ := common.GetArtifactTypeDefinition(common.RAW)
+	return startJob(generateJobId(), definition, c)
 }
 
-func StartDockerCdHandler(c echo.Context) error {
-	jobId := generateJobId()
-	return startDockerJob(jobId, c)
+func getOrGenerateJobId(c echo.Context) string {
+	if jobId := c.Param("jobId"); jobId != "" {
+		return jobId
+	}
+	return generateJobId()
 }
 
+// generateJobIdLock защищает выдачу jobId: за одну секунду может прийти несколько запросов
+var (
+	generateJobIdLock sync.Mutex
+	lastJobIdBase     string
+	lastJobIdSuffix   int
+)
+
+// generateJobId формирует jobId в формате YYYYMMDDHHmmss. Следующие за ту же секунду jobId и jobId,
+// которые уже есть, получают суффикс -2, -3 и т.д.
 func generateJobId() string {
-	return time.Now().Format("20060102150405")
+	generateJobIdLock.Lock()
+	defer generateJobIdLock.Unlock()
+	base := time.Now().Format("20060102150405")
+	if base != lastJobIdBase {
+		lastJobIdBase, lastJobIdSuffix = base, 1
+	} else {
+		lastJobIdSuffix++
+	}
+	for {
+		jobId := base
+		if lastJobIdSuffix > 1 {
+			jobId = fmt.Sprintf("%s-%d", base, lastJobIdSuffix)
+		}
+		if !jobExists(jobId) {
+			return jobId
+		}
+		lastJobIdSuffix++
+	}
 }
 
-func startDockerJob(jobId string, c echo.Context) error {
-	job := new(common.Job)
-	if err := c.Bind(job); err != nil {
-		return err
-	}
-	latestJob = jobId
-	go startCd(jobId, common.DockerArtifact{
-		ImageName: job.Artifact,
-	})
-	return c.JSON(http.StatusCreated, job)
+// jobExists - задание в очереди, выполняется или есть в хранилище заданий
+func jobExists(jobId string) bool {
+	return jobQueue.Contains(jobId) || jobStore.GetJobStatus(jobId).Status != ""
 }
 
-func startPypiJob(jobId string, c echo.Context) error {
-	job := new(common.PypiJob)
-	if err := c.Bind(job); err != nil {
-		return err
+// jobIdPattern - допустимые символы jobId: он используется в именах файлов на шаре
+var jobIdPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// validateJobId проверяет jobId, переданный клиентом в пути запроса
+func validateJobId(jobId string) error {
+	if !jobIdPattern.MatchString(jobId) || jobId == "." || jobId == ".." {
+		return fmt.Errorf("invalid jobId '%s': only letters, digits, '.', '_' and '-' are allowed", jobId)
 	}
-	latestJob = jobId
-	go startCd(jobId, common.PypiArtifact{
-		PackageName: job.Artifact,
-		Version:     job.Version,
-	})
-	return c.JSON(http.StatusCreated, job)
+	return nil
 }
 
-func startHfJob(jobId string, c echo.Context) error {
-	job := new(common.HfJob)
+// startJob разбирает тело запроса по описанию типа артефакта и ставит задание в очередь
+func startJob(jobId string, definition common.ArtifactTypeDefinition, c echo.Context) error {
+	if err := validateJobId(jobId); err != nil {
+		return c.JSONPretty(http.StatusBadRequest, map[string]interface{}{
+			"success":      false,
+			"errorMessage": err.Error(),
+		}, "  ")
+	}
+	if jobExists(jobId) {
+		return c.JSONPretty(http.StatusConflict, map[string]interface{}{
+			"success":      false,
+			"errorMessage": fmt.Sprintf("job %s already exists", jobId),
+		}, "  ")
+	}
+	if !definition.IsSendEnabled() {
+		return c.JSONPretty(http.StatusBadRequest, map[string]interface{}{
+			"success":      false,
+			"errorMessage": fmt.Sprintf("artifact type '%s' is disabled", definition.Name),
+		}, "  ")
+	}
+	job := definition.NewJob()
 	if err := c.Bind(job); err != nil {
 		return err
 	}
+	artifact, err := job.ToArtifact()
+	var requestErr *common.JobRequestError
+	if errors.As(err, &requestErr) {
+		return c.JSONPretty(http.StatusBadRequest, map[string]interface{}{
+			"success":      false,
+			"errorMessage": requestErr.Message,
+		}, "  ")
+	}
+	if err != nil {
+		return err
+	}
+	return submitJob(jobId, artifact, job, c)
+}
+
+func submitJob(jobId string, artifact common.Artifact, job interface{}, c echo.Context) error {
+	err := jobQueue.Submit(jobId, artifact)
+	if errors.Is(err, ErrJobExists) {
+		return c.JSONPretty(http.StatusConflict, map[string]interface{}{
+			"success":      false,
+			"errorMessage": fmt.Sprintf("job %s is already queued or running", jobId),
+		}, "  ")
+	}
+	if errors.Is(err, ErrQueueFull) {
+		return c.JSONPretty(http.StatusTooManyRequests, map[string]interface{}{
+			"success":      false,
+			"errorMessage": fmt.Sprintf("queue is full, try again later. Max queue size is %d", common.StartupConfig.SendQueueSize),
+		}, "  ")
+	}
+	latestJobLock.Lock()
 	latestJob = jobId
-	go startCd(jobId, common.HfArtifact{
-		ModelName: job.Artifact,
-	})
+	latestJobLock.Unlock()
 	return c.JSON(http.StatusCreated, job)
 }
 
@@ -104,25 +186,16 @@ func getBaseFilePath(path string) (string, error) {
 	}
 }
 
-func startCd(jobId string, artifact common.Artifact) {
+func startCd(ctx context.Context, jobId string, artifact common.Artifact) {
 	fsPath, err := getBaseFilePath(common.StartupConfig.NFSPath)
 	if err != nil {
 		log.Printf("failed to get path to store artifacts since %v", err)
+		failJob(jobId, artifact, common.DOWNLOADING_FAILED, "", common.STAGE_PREPARE, err)
 		return
 	}
-	jobStatusMap.SetJobStatus(jobId, common.JobStatus{Artifact: artifact, ArtifactType: artifact.GetType(), Status: common.DOWNLOADING, StatusDttm: time.Now()})
+	setJobStatus(jobId, common.JobStatus{Artifact: artifact, ArtifactType: artifact.GetType(), Status: common.DOWNLOADING, StatusDttm: time.Now()})
 	tempFilename := jobId + ".tmp"
-
-	artifactNameAndStream, err := artifact.GetArtifactNameAndStream()
-	if err != nil {
-		log.Println("failed to get artifact", artifact, "stream", err)
-		jobStatusMap.SetJobStatus(jobId, common.JobStatus{Artifact: artifact, Status: common.DOWNLOADING_FAILED, ArtifactPath: artifactNameAndStream.Name, StatusDttm: time.Now()})
-		return
-	}
-	defer artifactNameAndStream.Stream.Close()
-
 	tmpFilePath := filepath.Join(fsPath, tempFilename)
-	tgtFilePath := filepath.Join(fsPath, artifactNameAndStream.Name)
 
 	// Определим, нужна ли фрагментация
 	useChunking := common.StartupConfig.EnableChunking
@@ -143,85 +216,245 @@ func startCd(jobId string, artifact common.Artifact) {
 
 		// Если включена фрагментация и свободного места меньше порога, используем фрагментацию
 		if useChunking && freeSpace < uint64(chunkingThreshold) {
-			downloadWithChunking(jobId, artifact, artifactNameAndStream, fsPath)
+			startChunkedDownload(ctx, jobId, artifact, fsPath)
 			return
 		}
 	} else {
 		log.Printf("Warning: Could not check free space: %v\n", err)
 	}
 
-	// Стандартная загрузка без фрагментации
-	tmpFile, err := os.Create(tmpFilePath)
+	// Стандартная загрузка без фрагментации.
+	// Временный файл не удаляется между попытками, чтобы продолжить скачивание с места обрыва
+	var artifactName string
+	var artifactMetadata map[string]string
+	err = common.Retry(ctx, common.GetRetryPolicy(), "Job - "+jobId, func(attempt int) error {
+		if attempt > 1 {
+			recordAttempt(jobId, attempt, nil)
+		}
+		artifactNameAndStream, err := downloadToTmpFile(ctx, jobId, artifact, tmpFilePath)
+		artifactName, artifactMetadata = artifactNameAndStream.Name, artifactNameAndStream.Metadata
+		return err
+	}, func(attempt int, err error) {
+		recordAttempt(jobId, attempt, err)
+	})
 	if err != nil {
-		log.Printf("failed to create tmp file %s. Error: %v\n", tmpFilePath, err)
-		jobStatusMap.SetJobStatus(jobId, common.JobStatus{Artifact: artifact, Status: common.DOWNLOADING_FAILED, ArtifactPath: artifactNameAndStream.Name, StatusDttm: time.Now()})
+		if ctx.Err() != nil {
+			finishCancelledJob(jobId, artifact, artifactName, fsPath)
+			return
+		}
+		// Если ошибка связана с нехваткой места и фрагментация разрешена, пробуем фрагментацию
+		if useChunking && (errors.Is(err, syscall.ENOSPC) || strings.Contains(err.Error(), "no space")) {
+			log.Printf("Not enough space for full download, switching to chunking mode\n")
+			removeTmpFile(tmpFilePath)
+			startChunkedDownload(ctx, jobId, artifact, fsPath)
+			return
+		}
+		log.Println("failed to download artifact", artifact, err)
+		if _, resumable := artifact.(common.ResumableArtifact); !resumable {
+			removeTmpFile(tmpFilePath) // Удаляем неполный временный файл
+		}
+		failJob(jobId, artifact, common.DOWNLOADING_FAILED, artifactName, common.STAGE_DOWNLOAD, err)
+		return
+	}
+
+	// RECEIVE сверяет хеш-сумму перед загрузкой в целевой репозиторий
+	sha256Hash := calculateSHA256(tmpFilePath)
+	if err := verifyNexusChecksum(artifactMetadata, sha256Hash); err != nil {
+		log.Printf("Job - %s: downloaded artifact is corrupted: %v\n", jobId, err)
+		removeTmpFile(tmpFilePath)
+		failJob(jobId, artifact, common.DOWNLOADING_FAILED, artifactName, common.STAGE_DOWNLOAD, err)
+		return
+	}
+
+	tgtFilePath := filepath.Join(fsPath, artifactName)
+	err = os.Rename(tmpFilePath, tgtFilePath)
+	if err != nil {
+		log.Printf("Error while renaming tmp file: %v\n", err)
+		failJob(jobId, artifact, common.DOWNLOADING_FAILED, artifactName, common.STAGE_RENAME, err)
 		return
 	}
+	removeTmpFile(tmpFilePath)
+	successJobStatus := common.JobStatus{Status: common.DOWNLOADING_DONE, Artifact: artifact, ArtifactType: artifact.GetType(), ArtifactPath: artifactName, Metadata: artifactMetadata, StatusDttm: time.Now()}
+	successJobStatus.SHA256Hash = sha256Hash
+	err = WriteMeta(fsPath, jobId, successJobStatus)
+	if err != nil {
+		log.Printf("failed to write meta file: %v\n", err)
+		failJob(jobId, artifact, common.META_WRITING_FAILED, artifactName, common.STAGE_META, err)
+		return
+	}
+	err = artifact.DeliverCleanup()
+	if err != nil {
+		log.Printf("failed cleanup for artifact %+v. Error: %v\n", artifact, err)
+	}
+	setJobStatus(jobId, successJobStatus)
+}
+
+// verifyNexusChecksum сверяет sha256 скачанного файла с хеш-суммой ассета из поиска Nexus (метаданные sha256).
+// Если Nexus не вернул хеш-сумму или её не удалось посчитать, проверка пропускается
+func verifyNexusChecksum(metadata map[string]string, actual string) error {
+	expected := metadata[common.PackageMetaSha256]
+	if expected == "" || actual == "" {
+		return nil
+	}
+	if !strings.EqualFold(expected, actual) {
+		return fmt.Errorf("%w: Nexus reported %s, downloaded %s", common.ErrChecksumMismatch, expected, actual)
+	}
+	return nil
+}
+
+// failJob проставляет статус неудачи задания с описанием ошибки и этапа, на котором она произошла
+func failJob(jobId string, artifact common.Artifact, status common.CdStatus, artifactPath string, stage common.JobStage, err error) {
+	setJobStatus(jobId, common.JobStatus{
+		Artifact:     artifact,
+		ArtifactType: artifact.GetType(),
+		Status:       status,
+		ArtifactPath: artifactPath,
+		StatusDttm:   time.Now(),
+		Error:        common.NewJobError(stage, err),
+	})
+}
+
+// downloadToTmpFile скачивает артефакт во временный файл и возвращает описание артефакта (имя, метаданные).
+// Для ResumableArtifact скачивание продолжается с конца уже скачанной части временного файла
+func downloadToTmpFile(ctx context.Context, jobId string, artifact common.Artifact, tmpFilePath string) (common.ArtifactNameAndStream, error) {
+	var artifactNameAndStream common.ArtifactNameAndStream
+	var err error
+	resumableArtifact, resumable := artifact.(common.ResumableArtifact)
+	if resumable {
+		var offset int64
+		if info, err := os.Stat(tmpFilePath); err == nil {
+			offset = info.Size()
+		}
+		artifactNameAndStream, err = resumableArtifact.GetArtifactNameAndStreamFrom(ctx, offset, readResumeValidator(tmpFilePath))
+	} else {
+		artifactNameAndStream, err = artifact.GetArtifactNameAndStream(ctx)
+	}
+	if err != nil {
+		log.Println("failed to get artifact", artifact, "stream", err)
+		return artifactNameAndStream, err
+	}
+	defer artifactNameAndStream.Stream.Close()
+	nameArtifactStream(jobId, artifact, &artifactNameAndStream)
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if artifactNameAndStream.Offset > 0 {
+		log.Printf("Job - %s: resuming %s from byte %d\n", jobId, artifactNameAndStream.Name, artifactNameAndStream.Offset)
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+	tmpFile, err := os.OpenFile(tmpFilePath, flags, 0644)
+	if err != nil {
+		log.Printf("failed to create tmp file %s. Error: %v\n", tmpFilePath, err)
+		return artifactNameAndStream, err
+	}
 	defer tmpFile.Close()
+	if resumable {
+		writeResumeValidator(tmpFilePath, artifactNameAndStream.Validator)
+	}
 
 	bufferSize, _ := common.StartupConfig.GetBufferSize()
 	buf := make([]byte, bufferSize)
-	var downloaded int64
+	downloaded := artifactNameAndStream.Offset
+	progress := newProgressTracker(jobId, artifactNameAndStream.Offset, artifactNameAndStream.Size)
+	progress.Flush()
 	for {
+		if ctx.Err() != nil {
+			return artifactNameAndStream, ctx.Err()
+		}
 		n, err := artifactNameAndStream.Stream.Read(buf)
 		if n > 0 {
 			_, err := tmpFile.Write(buf[:n])
 			if err != nil {
 				log.Printf("Error while writing to tmp file: %v\n", err)
-				tmpFile.Close()
-				os.Remove(tmpFilePath) // Удаляем неполный временный файл
-				jobStatusMap.SetJobStatus(jobId, common.JobStatus{Artifact: artifact, Status: common.DOWNLOADING_FAILED, ArtifactPath: artifactNameAndStream.Name, StatusDttm: time.Now()})
-
-				// Если ошибка связана с нехваткой места и фрагментация разрешена, пробуем фрагментацию
-				if strings.Contains(err.Error(), "no space") && useChunking {
-					log.Printf("Not enough space for full download, switching to chunking mode\n")
-					downloadWithChunking(jobId, artifact, artifactNameAndStream, fsPath)
-					return
-				}
-				return
+				return artifactNameAndStream, err
 			}
 			downloaded += int64(n)
+			progress.Add(n)
 		}
 		if err != nil {
+			progress.Flush()
 			if err == io.EOF {
-				log.Printf("Job - %s:Downloading %s 100%\n", jobId, artifactNameAndStream.Name)
-				break
+				log.Printf("Job - %s: Downloading %s 100%%\n", jobId, artifactNameAndStream.Name)
+				return artifactNameAndStream, nil
 			}
-			log.Printf("Error while downloading: %v\n", err)
-			tmpFile.Close()
-			os.Remove(tmpFilePath) // Удаляем неполный временный файл
-			jobStatusMap.SetJobStatus(jobId, common.JobStatus{Artifact: artifact, Status: common.DOWNLOADING_FAILED, ArtifactPath: artifactNameAndStream.Name, StatusDttm: time.Now()})
-			return
+			log.Printf("Error while downloading after %d bytes: %v\n", downloaded, err)
+			return artifactNameAndStream, err
 		}
 	}
-	tmpFile.Close()
-	err = os.Rename(tmpFilePath, tgtFilePath)
+}
+
+// startChunkedDownload скачивает артефакт с начала и записывает его фрагментами
+func startChunkedDownload(ctx context.Context, jobId string, artifact common.Artifact, fsPath string) {
+	var artifactNameAndStream common.ArtifactNameAndStream
+	err := common.Retry(ctx, common.GetRetryPolicy(), "Job - "+jobId, func(attempt int) error {
+		if attempt > 1 {
+			recordAttempt(jobId, attempt, nil)
+		}
+		var err error
+		artifactNameAndStream, err = artifact.GetArtifactNameAndStream(ctx)
+		return err
+	}, func(attempt int, err error) {
+		recordAttempt(jobId, attempt, err)
+	})
 	if err != nil {
-		log.Printf("Error while renaming tmp file: %v\n", err)
-		jobStatusMap.SetJobStatus(jobId, common.JobStatus{Artifact: artifact, Status: common.DOWNLOADING_FAILED, ArtifactPath: artifactNameAndStream.Name, StatusDttm: time.Now()})
+		if ctx.Err() != nil {
+			finishCancelledJob(jobId, artifact, artifactNameAndStream.Name, fsPath)
+			return
+		}
+		log.Println("failed to get artifact", artifact, "stream", err)
+		failJob(jobId, artifact, common.DOWNLOADING_FAILED, artifactNameAndStream.Name, common.STAGE_DOWNLOAD, err)
 		return
 	}
-	successJobStatus := common.JobStatus{Status: common.DOWNLOADING_DONE, Artifact: artifact, ArtifactType: artifact.GetType(), ArtifactPath: artifactNameAndStream.Name, StatusDttm: time.Now()}
-	err = WriteMeta(fsPath, jobId, successJobStatus)
-	if err != nil {
-		log.Printf("failed to write meta file: %v\n", err)
-		jobStatusMap.SetJobStatus(jobId, common.JobStatus{Artifact: artifact, Status: common.META_WRITING_FAILED, ArtifactPath: artifactNameAndStream.Name, StatusDttm: time.Now()})
+	defer artifactNameAndStream.Stream.Close()
+	nameArtifactStream(jobId, artifact, &artifactNameAndStream)
+	downloadWithChunking(ctx, jobId, artifact, artifactNameAndStream, fsPath)
+}
+
+// nameArtifactStream задаёт имя файла по jobId, если источник артефакта его не сообщил
+func nameArtifactStream(jobId string, artifact common.Artifact, artifactNameAndStream *common.ArtifactNameAndStream) {
+	if artifactNameAndStream.Name != "" {
 		return
 	}
-	err = artifact.DeliverCleanup()
+	if namedArtifact, ok := artifact.(common.JobFileNameArtifact); ok {
+		artifactNameAndStream.Name = namedArtifact.GetDownloadFileName(jobId)
+	}
+}
+
+// Валидатор (ETag/Last-Modified) частично скачанного файла хранится рядом с ним,
+// чтобы продолжить скачивание и после перезапуска приложения
+func getResumeValidatorPath(tmpFilePath string) string {
+	return tmpFilePath + ".validator"
+}
+
+func readResumeValidator(tmpFilePath string) string {
+	validator, err := os.ReadFile(getResumeValidatorPath(tmpFilePath))
 	if err != nil {
-		log.Printf("failed cleanup for artifact %+v. Error: %v\n", artifact, err)
+		return ""
 	}
-	jobStatusMap.SetJobStatus(jobId, successJobStatus)
+	return string(validator)
+}
+
+func writeResumeValidator(tmpFilePath, validator string) {
+	if validator == "" {
+		os.Remove(getResumeValidatorPath(tmpFilePath))
+		return
+	}
+	if err := os.WriteFile(getResumeValidatorPath(tmpFilePath), []byte(validator), 0644); err != nil {
+		log.Printf("Warning: failed to save resume validator for %s: %v\n", tmpFilePath, err)
+	}
+}
+
+func removeTmpFile(tmpFilePath string) {
+	os.Remove(tmpFilePath)
+	os.Remove(getResumeValidatorPath(tmpFilePath))
 }
 
 // downloadWithChunking загружает файл по частям
-func downloadWithChunking(jobId string, artifact common.Artifact, artifactNameAndStream common.ArtifactNameAndStream, fsPath string) {
+func downloadWithChunking(ctx context.Context, jobId string, artifact common.Artifact, artifactNameAndStream common.ArtifactNameAndStream, fsPath string) {
 	chunkSize := common.CheckChunkSize(common.StartupConfig.ChunkSize)
 	log.Printf("Starting chunked download for %s with chunk size %d bytes\n", artifactNameAndStream.Name, chunkSize)
 
 	// Обновляем статус
-	jobStatusMap.SetJobStatus(jobId, common.JobStatus{
+	setJobStatus(jobId, common.JobStatus{
 		Artifact:     artifact,
 		ArtifactType: artifact.GetType(),
 		Status:       common.CHUNKED,
@@ -233,12 +466,7 @@ func downloadWithChunking(jobId string, artifact common.Artifact, artifactNameAn
 	chunkDir := filepath.Join(fsPath, "chunks_"+jobId)
 	if err := os.MkdirAll(chunkDir, 0755); err != nil {
 		log.Printf("Error creating chunk directory: %v\n", err)
-		jobStatusMap.SetJobStatus(jobId, common.JobStatus{
-			Artifact:     artifact,
-			Status:       common.DOWNLOADING_FAILED,
-			ArtifactPath: artifactNameAndStream.Name,
-			StatusDttm:   time.Now(),
-		})
+		failJob(jobId, artifact, common.DOWNLOADING_FAILED, artifactNameAndStream.Name, common.STAGE_CHUNKING, err)
 		return
 	}
 
@@ -265,12 +493,7 @@ func downloadWithChunking(jobId string, artifact common.Artifact, artifactNameAn
 	chunkFile, err := os.Create(chunkPath)
 	if err != nil {
 		log.Printf("Error creating chunk file: %v\n", err)
-		jobStatusMap.SetJobStatus(jobId, common.JobStatus{
-			Artifact:     artifact,
-			Status:       common.DOWNLOADING_FAILED,
-			ArtifactPath: artifactNameAndStream.Name,
-			StatusDttm:   time.Now(),
-		})
+		failJob(jobId, artifact, common.DOWNLOADING_FAILED, artifactNameAndStream.Name, common.STAGE_CHUNKING, err)
 		return
 	}
 
@@ -279,26 +502,29 @@ func downloadWithChunking(jobId string, artifact common.Artifact, artifactNameAn
 	tempFullFile, err := os.Create(tempFullFilePath)
 	if err != nil {
 		log.Printf("Error creating temp file for hash: %v\n", err)
-		jobStatusMap.SetJobStatus(jobId, common.JobStatus{
-			Artifact:     artifact,
-			Status:       common.DOWNLOADING_FAILED,
-			ArtifactPath: artifactNameAndStream.Name,
-			StatusDttm:   time.Now(),
-		})
+		failJob(jobId, artifact, common.DOWNLOADING_FAILED, artifactNameAndStream.Name, common.STAGE_CHUNKING, err)
 		return
 	}
 	defer tempFullFile.Close()
 	defer os.Remove(tempFullFilePath)
 
+	setJobStatus(jobId, common.JobStatus{
+		Artifact:     artifact,
+		ArtifactType: artifact.GetType(),
+		Status:       common.CHUNK_DOWNLOADING,
+		ArtifactPath: artifactNameAndStream.Name,
+		StatusDttm:   time.Now(),
+	})
+	progress := newProgressTracker(jobId, 0, artifactNameAndStream.Size)
+	progress.Flush()
 
 	for {
-		jobStatusMap.SetJobStatus(jobId, common.JobStatus{
-			Artifact:     artifact,
-			ArtifactType: artifact.GetType(),
-			Status:       common.CHUNK_DOWNLOADING,
-			ArtifactPath: artifactNameAndStream.Name,
-			StatusDttm:   time.Now(),
-		})
+		if ctx.Err() != nil {
+			chunkFile.Close()
+			tempFullFile.Close()
+			finishCancelledJob(jobId, artifact, artifactNameAndStream.Name, fsPath)
+			return
+		}
 
 		n, err := artifactNameAndStream.Stream.Read(buf)
 		if n > 0 {
@@ -324,29 +550,31 @@ func downloadWithChunking(jobId string, artifact common.Artifact, artifactNameAn
 				chunkFile, err = os.Create(chunkPath)
 				if err != nil {
 					log.Printf("Error creating next chunk file: %v\n", err)
-					jobStatusMap.SetJobStatus(jobId, common.JobStatus{
-						Artifact:     artifact,
-						Status:       common.DOWNLOADING_FAILED,
-						ArtifactPath: artifactNameAndStream.Name,
-						StatusDttm:   time.Now(),
-					})
+					failJob(jobId, artifact, common.DOWNLOADING_FAILED, artifactNameAndStream.Name, common.STAGE_CHUNKING, err)
 					return
 				}
 
 				currentChunkSize = 0
 			}
 
-			// Записываем данные во фрагмент
-			_, err := chunkFile.Write(buf[:n])
+			// Записываем данные во фрагмент, повторяя запись при временных ошибках файловой системы
+			written := 0
+			err := common.Retry(ctx, common.GetRetryPolicy(), fmt.Sprintf("Job - %s: chunk %d", jobId, chunkIndex), func(attempt int) error {
+				w, err := chunkFile.Write(buf[written:n])
+				written += w
+				return err
+			}, func(attempt int, err error) {
+				recordAttempt(jobId, attempt, err)
+			})
 			if err != nil {
 				chunkFile.Close()
+				if ctx.Err() != nil {
+					tempFullFile.Close()
+					finishCancelledJob(jobId, artifact, artifactNameAndStream.Name, fsPath)
+					return
+				}
 				log.Printf("Error writing to chunk file: %v\n", err)
-				jobStatusMap.SetJobStatus(jobId, common.JobStatus{
-					Artifact:     artifact,
-					Status:       common.DOWNLOADING_FAILED,
-					ArtifactPath: artifactNameAndStream.Name,
-					StatusDttm:   time.Now(),
-				})
+				failJob(jobId, artifact, common.DOWNLOADING_FAILED, artifactNameAndStream.Name, common.STAGE_CHUNKING, err)
 				return
 			}
 
@@ -364,21 +592,23 @@ func downloadWithChunking(jobId string, artifact common.Artifact, artifactNameAn
 
 			currentChunkSize += int64(n)
 			totalDownloaded += int64(n)
+			progress.Add(n)
 		}
 
 		if err != nil {
+			progress.Flush()
 			if err == io.EOF {
 				log.Printf("Job - %s: Downloading %s 100%%\n", jobId, artifactNameAndStream.Name)
 				break
 			}
 			chunkFile.Close()
+			if ctx.Err() != nil {
+				tempFullFile.Close()
+				finishCancelledJob(jobId, artifact, artifactNameAndStream.Name, fsPath)
+				return
+			}
 			log.Printf("Error during download: %v\n", err)
-			jobStatusMap.SetJobStatus(jobId, common.JobStatus{
-				Artifact:     artifact,
-				Status:       common.DOWNLOADING_FAILED,
-				ArtifactPath: artifactNameAndStream.Name,
-				StatusDttm:   time.Now(),
-			})
+			failJob(jobId, artifact, common.DOWNLOADING_FAILED, artifactNameAndStream.Name, common.STAGE_DOWNLOAD, err)
 			return
 		}
 	}
@@ -396,18 +626,22 @@ func downloadWithChunking(jobId string, artifact common.Artifact, artifactNameAn
 	// Обновляем общие данные манифеста
 	manifest.TotalSize = totalDownloaded
 	manifest.ChunkCount = chunkIndex + 1
+	// sha256 всего артефакта: RECEIVE проверяет по ней собранный из фрагментов файл
+	manifest.Hash = calculateSHA256(tempFullFilePath)
+	manifest.SHA256Hash = manifest.Hash
+	if err := verifyNexusChecksum(artifactNameAndStream.Metadata, manifest.SHA256Hash); err != nil {
+		log.Printf("Job - %s: downloaded artifact is corrupted: %v\n", jobId, err)
+		os.RemoveAll(chunkDir)
+		failJob(jobId, artifact, common.DOWNLOADING_FAILED, artifactNameAndStream.Name, common.STAGE_DOWNLOAD, err)
+		return
+	}
 
 	// Сохраняем манифест
 	manifestPath := filepath.Join(chunkDir, artifactNameAndStream.Name+common.ManifestSuffix)
 	manifestFile, err := os.Create(manifestPath)
 	if err != nil {
 		log.Printf("Error creating manifest file: %v\n", err)
-		jobStatusMap.SetJobStatus(jobId, common.JobStatus{
-			Artifact:     artifact,
-			Status:       common.DOWNLOADING_FAILED,
-			ArtifactPath: artifactNameAndStream.Name,
-			StatusDttm:   time.Now(),
-		})
+		failJob(jobId, artifact, common.DOWNLOADING_FAILED, artifactNameAndStream.Name, common.STAGE_MANIFEST, err)
 		return
 	}
 	defer manifestFile.Close()
@@ -416,46 +650,34 @@ func downloadWithChunking(jobId string, artifact common.Artifact, artifactNameAn
 	err = encoder.Encode(manifest)
 	if err != nil {
 		log.Printf("Error writing manifest: %v\n", err)
-		jobStatusMap.SetJobStatus(jobId, common.JobStatus{
-			Artifact:     artifact,
-			Status:       common.DOWNLOADING_FAILED,
-			ArtifactPath: artifactNameAndStream.Name,
-			StatusDttm:   time.Now(),
-		})
+		failJob(jobId, artifact, common.DOWNLOADING_FAILED, artifactNameAndStream.Name, common.STAGE_MANIFEST, err)
 		return
 	}
 
-	//Calculate hash of temporary file
-	hash := calculateSHA256(tempFullFilePath)
-	manifest.Hash = hash
-
 	// Создаем статус задания с информацией о фрагментах
 	successJobStatus := common.JobStatus{
 		Status:       common.CHUNK_DONE,
 		Artifact:     artifact,
 		ArtifactType: artifact.GetType(),
 		ArtifactPath: artifactNameAndStream.Name,
+		Metadata:     artifactNameAndStream.Metadata,
 		StatusDttm:   time.Now(),
 		IsChunked:    true,
 		ChunkCount:   manifest.ChunkCount,
 		TotalSize:    manifest.TotalSize,
 		Chunks:       manifest.Chunks,
 		Hash:         manifest.Hash,
+		SHA256Hash:   manifest.SHA256Hash,
 	}
 
 	// Обновляем статус в памяти
-	jobStatusMap.SetJobStatus(jobId, successJobStatus)
+	setJobStatus(jobId, successJobStatus)
 
 	// Записываем метафайл с информацией о фрагментах
 	err = WriteMeta(fsPath, jobId, successJobStatus)
 	if err != nil {
 		log.Printf("failed to write meta file: %v\n", err)
-		jobStatusMap.SetJobStatus(jobId, common.JobStatus{
-			Artifact:     artifact,
-			Status:       common.META_WRITING_FAILED,
-			ArtifactPath: artifactNameAndStream.Name,
-			StatusDttm:   time.Now(),
-		})
+		failJob(jobId, artifact, common.META_WRITING_FAILED, artifactNameAndStream.Name, common.STAGE_META, err)
 		return
 	}
 
@@ -465,7 +687,7 @@ func downloadWithChunking(jobId string, artifact common.Artifact, artifactNameAn
 		log.Printf("failed cleanup for artifact %+v. Error: %v\n", artifact, err)
 	}
 
-	jobStatusMap.SetJobStatus(jobId, successJobStatus)
+	setJobStatus(jobId, successJobStatus)
 }
 
 func calculateSHA256(filePath string) string {
@@ -490,76 +712,121 @@ func GetJobStatus(c echo.Context) error {
 	return getJobStatusByJob(id, c)
 }
 func GetLatestJobStatus(c echo.Context) error {
-	return getJobStatusByJob(latestJob, c)
+	latestJobLock.RLock()
+	jobId := latestJob
+	latestJobLock.RUnlock()
+	return getJobStatusByJob(jobId, c)
 }
 
 func getJobStatusByJob(jobId string, c echo.Context) error {
-	return c.JSONPretty(http.StatusOK, jobStatusMap.GetJobStatus(jobId), "  ")
-}
-
-type JobStatusMap struct {
-	JobStatusMap map[string]common.JobStatus
-	Lock         sync.RWMutex
-}
-
-func (jsm *JobStatusMap) GetJobStatus(jobId string) common.JobStatus {
-	jsm.Lock.RLock()
-	defer jsm.Lock.RUnlock()
-	return jsm.JobStatusMap[jobId]
+	jobStatus := jobStore.GetJobStatus(jobId)
+	if jobStatus.Status == common.QUEUED {
+		jobStatus.QueuePosition = jobQueue.Position(jobId)
+	}
+	return c.JSONPretty(http.StatusOK, jobStatus, "  ")
 }
 
-func (jsm *JobStatusMap) SetJobStatus(jobId string, jobStatus common.JobStatus) {
-	jsm.Lock.Lock()
-	defer jsm.Lock.Unlock()
-	jsm.JobStatusMap[jobId] = jobStatus
-}
-func (jsm *JobStatusMap) checkDownloadingDoneJobs() {
+// checkDownloadingDoneJobs проставляет статусы заданиям, артефакты которых забрал RECEIVE.
+// По файлу подтверждения <jobId>.ack задание получает статус DEPLOYED, DEPLOY_FAILED или CANCELLED.
+// Пока подтверждения нет, задание остаётся в DOWNLOADING_DONE, даже если .job файл уже удалён с шары
+func checkDownloadingDoneJobs(store JobStore) {
 	fsPath, err := getBaseFilePath(common.StartupConfig.NFSPath)
 	if err != nil {
 		log.Printf("failed to get path to store artifacts since %v", err)
 		return
 	}
-	jsm.Lock.RLock()
-	successJobs := make(map[string]common.JobStatus)
-	for jobId, jobStatus := range jsm.JobStatusMap {
-		if jobStatus.Status == common.DOWNLOADING_DONE {
-			artifact := jobStatus.Artifact
-			dstFilePath := filepath.Join(fsPath, common.GetJobMetaFileName(jobId))
-			// if file exists just skip it
-			if _, err := os.Stat(dstFilePath); errors.Is(err, os.ErrNotExist) {
-				log.Printf("Job - %s: job is successfully finished", jobId)
-				successJobs[jobId] = common.JobStatus{Artifact: artifact, Status: common.SUCCESS, StatusDttm: time.Now()}
-			}
+	for jobId, jobStatus := range store.ListJobs() {
+		switch jobStatus.Status {
+		case common.DOWNLOADING_DONE, common.CHUNK_DONE:
+		default:
+			continue
+		}
+		if ack, found := readDeployAck(fsPath, jobId); found {
+			applyDeployAck(store, jobId, jobStatus, ack)
 		}
 	}
-	jsm.Lock.RUnlock()
+}
 
-	for jobId, jobStatus := range successJobs {
-		jsm.SetJobStatus(jobId, jobStatus)
+// readDeployAck читает и удаляет файл подтверждения загрузки
+func readDeployAck(fsPath, jobId string) (common.DeployAck, bool) {
+	var ack common.DeployAck
+	ackFilePath := filepath.Join(fsPath, common.GetJobAckFileName(jobId))
+	content, err := os.ReadFile(ackFilePath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Println("failed to read deploy ack", ackFilePath, err)
+		}
+		return ack, false
 	}
+	if err := json.Unmarshal(content, &ack); err != nil {
+		log.Println("failed to parse deploy ack", ackFilePath, err)
+		return ack, false
+	}
+	if err := os.Remove(ackFilePath); err != nil {
+		log.Println("failed to remove deploy ack", ackFilePath, err)
+	}
+	return ack, true
+}
+
+func applyDeployAck(store JobStore, jobId string, jobStatus common.JobStatus, ack common.DeployAck) {
+	log.Printf("Job - %s: RECEIVE reported %s", jobId, ack.Result)
+	if ack.ErrorCode == common.DOCKER_LAYER_MISSING && resendWithoutDockerDedup(jobId, jobStatus.Artifact) {
+		return
+	}
+	store.Update(jobId, func(jobStatus *common.JobStatus) bool {
+		jobStatus.Status = ack.Result
+		jobStatus.StatusDttm = ack.Dttm
+		jobStatus.Deploy = &ack
+		jobStatus.Error = nil
+		if ack.Result == common.DEPLOY_FAILED {
+			jobStatus.Error = &common.JobError{Code: ack.ErrorCode, Message: ack.ErrorMessage, Stage: common.STAGE_DEPLOY, Dttm: ack.Dttm}
+		}
+		jobStatus.History = common.AppendStatusHistory(jobStatus.History, jobStatus.Status, jobStatus.StatusDttm)
+		return true
+	})
+}
+
+// resendWithoutDockerDedup заново отправляет образ со всеми слоями, если RECEIVE не смог подключить слой
+// по устаревшему списку блобов. RECEIVE к этому времени уже удалил задание с шары, повторная отправка делается один раз
+func resendWithoutDockerDedup(jobId string, artifact common.Artifact) bool {
+	artifact, ok := common.WithoutDockerDedup(artifact)
+	if !ok {
+		return false
+	}
+	log.Printf("Job - %s: RECEIVE couldn't mount layer by stale blob inventory, sending image with all layers\n", jobId)
+	if err := jobQueue.Submit(jobId, artifact); err != nil {
+		log.Printf("Job - %s: failed to resend image: %v\n", jobId, err)
+		return false
+	}
+	return true
 }
 
-func (jsm *JobStatusMap) deleteStaleJobs() {
-	jsm.Lock.Lock()
-	for jobId, jobStatus := range jsm.JobStatusMap {
+func deleteStaleJobs(store JobStore) {
+	fsPath, err := getBaseFilePath(common.StartupConfig.NFSPath)
+	if err != nil {
+		log.Printf("failed to get path to store artifacts since %v", err)
+		return
+	}
+	for jobId, jobStatus := range store.ListJobs() {
 		if time.Since(jobStatus.StatusDttm) > 7*24*time.Hour {
 			log.Printf("deleting job %s since it is stale", jobId)
-			delete(jsm.JobStatusMap, jobId)
+			// частично скачанные файлы хранятся для продолжения скачивания, удаляем их вместе с заданием
+			removeJobLeftovers(fsPath, jobId)
+			store.DeleteJob(jobId)
 		}
 	}
-	jsm.Lock.Unlock()
 }
 
 func CheckDownloadingDoneJobs() {
 	for {
-		jobStatusMap.checkDownloadingDoneJobs()
+		checkDownloadingDoneJobs(jobStore)
 		time.Sleep(15 * time.Second)
 	}
 }
 
 func DeleteStaleJobs() {
 	for {
-		jobStatusMap.deleteStaleJobs()
+		deleteStaleJobs(jobStore)
 		time.Sleep(1 * time.Hour)
 	}
 }
@@ -567,20 +834,20 @@ func DeleteStaleJobs() {
 func WriteMeta(dirPath, jobId string, status common.JobStatus) error {
 	metaFileName := filepath.Join(dirPath, common.GetJobMetaFileName(jobId))
 	metaFile, err := os.Create(metaFileName)
-	defer metaFile.Close()
 	if err != nil {
 		log.Println("failed to create meta file", metaFileName, err)
-		return err
+		return fmt.Errorf("failed to create meta file %s: %w", metaFileName, err)
 	}
+	defer metaFile.Close()
 	statusBytes, err := json.Marshal(status)
 	if err != nil {
 		log.Printf("failed to serialize jobStatus %+v with error %v\n", status, err)
-		return err
+		return fmt.Errorf("failed to serialize job status: %w", err)
 	}
 
 	if _, err := metaFile.Write(statusBytes); err != nil {
 		log.Println("failed to write meta file", err)
-		return err
+		return fmt.Errorf("failed to write meta file %s: %w", metaFileName, err)
 	}
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,26 @@
+package deliver
+
+import (
+	"fts-cd-file-utility/common"
+	"testing"
+)
+
+func TestNameArtifactStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		artifact common.Artifact
+		stream   string
+		want     string
+	}{
+		{"name from source", &common.HttpArtifact{DownloadFilePath: "https://example.com/files/"}, "report.pdf", "report.pdf"},
+		{"name from url", &common.HttpArtifact{DownloadFilePath: "https://example.com/files/report.pdf?x=1"}, "", "report.pdf"},
+		{"no name", &common.HttpArtifact{DownloadFilePath: "https://example.com/files/"}, "", "job-1.file"},
+	}
+	for _, test := range tests {
+		artifactNameAndStream := common.ArtifactNameAndStream{Name: test.stream}
+		nameArtifactStream("job-1", test.artifact, &artifactNameAndStream)
+		if artifactNameAndStream.Name != test.want {
+			t.Errorf("%s: name = %q, want %q", test.name, artifactNameAndStream.Name, test.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package deliver
+
+import (
+	"fmt"
+	"fts-cd-file-utility/common"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CancelJobHandler отменяет задание: убирает его из очереди, прерывает скачивание
+// или, если артефакт уже лежит на шаре, оставляет для RECEIVE маркер отмены
+func CancelJobHandler(c echo.Context) error {
+	jobId := c.Param("jobId")
+	found, wasQueued := jobQueue.Cancel(jobId)
+	if found && !wasQueued {
+		// выполняющееся задание само удалит промежуточные файлы и проставит статус CANCELLED
+		log.Printf("Job - %s: cancellation requested\n", jobId)
+		return c.JSONPretty(http.StatusAccepted, map[string]interface{}{
+			"success": true,
+			"jobId":   jobId,
+		}, "  ")
+	}
+
+	if found {
+		log.Printf("Job - %s: removed from queue\n", jobId)
+		var cancelledJobStatus common.JobStatus
+		jobStore.Update(jobId, func(jobStatus *common.JobStatus) bool {
+			jobStatus.Status = common.CANCELLED
+			jobStatus.StatusDttm = time.Now()
+			jobStatus.History = common.AppendStatusHistory(jobStatus.History, jobStatus.Status, jobStatus.StatusDttm)
+			cancelledJobStatus = *jobStatus
+			return true
+		})
+		return c.JSONPretty(http.StatusOK, cancelledJobStatus, "  ")
+	}
+
+	jobStatus := jobStore.GetJobStatus(jobId)
+	switch jobStatus.Status {
+	case "":
+		return c.JSONPretty(http.StatusNotFound, map[string]interface{}{
+			"success":      false,
+			"errorMessage": fmt.Sprintf("job %s not found", jobId),
+		}, "  ")
+	case common.DOWNLOADING_DONE, common.CHUNK_DONE:
+		fsPath, err := getBaseFilePath(common.StartupConfig.NFSPath)
+		if err != nil {
+			log.Printf("failed to get path to store artifacts since %v", err)
+			return err
+		}
+		if err := writeCancelMarker(fsPath, jobId); err != nil {
+			return c.JSONPretty(http.StatusInternalServerError, map[string]interface{}{
+				"success":      false,
+				"errorMessage": fmt.Sprintf("failed to write cancel marker for job %s: %v", jobId, err),
+			}, "  ")
+		}
+		// статус CANCELLED проставит checkDownloadingDoneJobs по подтверждению отмены от RECEIVE.
+		// Если RECEIVE успел загрузить артефакт до маркера, задание получит DEPLOYED
+		log.Printf("Job - %s: cancel marker written, RECEIVE will drop the artifact\n", jobId)
+		return c.JSONPretty(http.StatusAccepted, map[string]interface{}{
+			"success": true,
+			"jobId":   jobId,
+		}, "  ")
+	}
+	return c.JSONPretty(http.StatusConflict, map[string]interface{}{
+		"success":      false,
+		"errorMessage": fmt.Sprintf("job %s can't be cancelled in status %s", jobId, jobStatus.Status),
+	}, "  ")
+}
+
+// finishCancelledJob удаляет промежуточные файлы задания и проставляет статус CANCELLED
+func finishCancelledJob(jobId string, artifact common.Artifact, artifactPath, fsPath string) {
+	log.Printf("Job - %s: cancelled, removing leftovers\n", jobId)
+	removeJobLeftovers(fsPath, jobId)
+	if err := artifact.DeliverCleanup(); err != nil {
+		log.Printf("failed cleanup for artifact %+v. Error: %v\n", artifact, err)
+	}
+	setJobStatus(jobId, common.JobStatus{Artifact: artifact, ArtifactType: artifact.GetType(), Status: common.CANCELLED, ArtifactPath: artifactPath, StatusDttm: time.Now()})
+}
+
+// removeJobLeftovers удаляет <jobId>.tmp, temp_<jobId>_* и chunks_<jobId>
+func removeJobLeftovers(fsPath, jobId string) {
+	tmpFilePath := filepath.Join(fsPath, jobId+".tmp")
+	leftovers := []string{tmpFilePath, getResumeValidatorPath(tmpFilePath), filepath.Join(fsPath, "chunks_"+jobId)}
+	tempFiles, err := filepath.Glob(filepath.Join(fsPath, "temp_"+jobId+"_*"))
+	if err != nil {
+		log.Printf("Job - %s: failed to list temp files: %v\n", jobId, err)
+	}
+	leftovers = append(leftovers, tempFiles...)
+	for _, leftover := range leftovers {
+		if err := os.RemoveAll(leftover); err != nil {
+			log.Printf("Job - %s: failed to remove %s: %v\n", jobId, leftover, err)
+		}
+	}
+}
+
+func writeCancelMarker(fsPath, jobId string) error {
+	markerPath := filepath.Join(fsPath, common.GetJobCancelFileName(jobId))
+	if err := os.WriteFile(markerPath, []byte(time.Now().Format(time.RFC3339)), 0644); err != nil {
+		log.Println("failed to write cancel marker", markerPath, err)
+		return err
+	}
+	return nil
+}
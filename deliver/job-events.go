@@ -0,0 +1,152 @@
+package deliver
+
+import (
+	"encoding/json"
+	"fmt"
+	"fts-cd-file-utility/common"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Интервал комментариев keep-alive в потоке событий, чтобы прокси не закрывали соединение
+const eventsKeepAliveInterval = 15 * time.Second
+
+// JobEvents рассылает изменения заданий подписчикам /cd-jobs/:jobId/events
+type JobEvents struct {
+	lock        sync.Mutex
+	subscribers map[string]map[chan common.JobStatus]bool
+}
+
+var jobEvents = &JobEvents{subscribers: map[string]map[chan common.JobStatus]bool{}}
+
+// Subscribe возвращает канал изменений задания и функцию отписки
+func (e *JobEvents) Subscribe(jobId string) (chan common.JobStatus, func()) {
+	ch := make(chan common.JobStatus, 16)
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.subscribers[jobId] == nil {
+		e.subscribers[jobId] = map[chan common.JobStatus]bool{}
+	}
+	e.subscribers[jobId][ch] = true
+	return ch, func() {
+		e.lock.Lock()
+		defer e.lock.Unlock()
+		delete(e.subscribers[jobId], ch)
+		if len(e.subscribers[jobId]) == 0 {
+			delete(e.subscribers, jobId)
+		}
+	}
+}
+
+// Publish отправляет статус подписчикам, не блокируясь на медленных.
+// Если канал подписчика заполнен, самое старое событие отбрасывается
+func (e *JobEvents) Publish(jobId string, jobStatus common.JobStatus) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for ch := range e.subscribers[jobId] {
+		select {
+		case ch <- jobStatus:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- jobStatus
+		}
+	}
+}
+
+// notifyingJobStore публикует каждое сохранение статуса в JobEvents
+type notifyingJobStore struct {
+	JobStore
+	events *JobEvents
+}
+
+func (s *notifyingJobStore) SetJobStatus(jobId string, jobStatus common.JobStatus) {
+	s.JobStore.SetJobStatus(jobId, jobStatus)
+	s.events.Publish(jobId, jobStatus)
+}
+
+func (s *notifyingJobStore) Update(jobId string, update func(jobStatus *common.JobStatus) bool) bool {
+	var updated common.JobStatus
+	if !s.JobStore.Update(jobId, func(jobStatus *common.JobStatus) bool {
+		if !update(jobStatus) {
+			return false
+		}
+		updated = *jobStatus
+		return true
+	}) {
+		return false
+	}
+	s.events.Publish(jobId, updated)
+	return true
+}
+
+// JobEventsHandler отдаёт изменения статуса и хода скачивания задания как server-sent events.
+// Поток закрывается после финального статуса задания
+func JobEventsHandler(c echo.Context) error {
+	jobId := c.Param("jobId")
+	events, unsubscribe := jobEvents.Subscribe(jobId)
+	defer unsubscribe()
+
+	jobStatus := jobStore.GetJobStatus(jobId)
+	if jobStatus.Status == "" {
+		return c.JSONPretty(http.StatusNotFound, map[string]interface{}{
+			"success":      false,
+			"errorMessage": fmt.Sprintf("job %s not found", jobId),
+		}, "  ")
+	}
+
+	resp := c.Response()
+	resp.Header().Set(echo.HeaderContentType, "text/event-stream")
+	resp.Header().Set(echo.HeaderCacheControl, "no-cache")
+	resp.Header().Set(echo.HeaderConnection, "keep-alive")
+	resp.WriteHeader(http.StatusOK)
+
+	lastStatus := jobStatus.Status
+	if err := writeJobEvent(resp, "status", jobStatus); err != nil {
+		return nil
+	}
+	keepAlive := time.NewTicker(eventsKeepAliveInterval)
+	defer keepAlive.Stop()
+	for !common.IsFinalStatus(lastStatus) {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(resp, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			resp.Flush()
+		case jobStatus = <-events:
+			event := "progress"
+			if jobStatus.Status != lastStatus {
+				event = "status"
+				lastStatus = jobStatus.Status
+			}
+			if jobStatus.Status == common.QUEUED {
+				jobStatus.QueuePosition = jobQueue.Position(jobId)
+			}
+			if err := writeJobEvent(resp, event, jobStatus); err != nil {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+func writeJobEvent(resp *echo.Response, event string, jobStatus common.JobStatus) error {
+	data, err := json.Marshal(jobStatus)
+	if err != nil {
+		log.Printf("failed to serialize jobStatus %+v with error %v\n", jobStatus, err)
+		return err
+	}
+	if _, err := fmt.Fprintf(resp, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	resp.Flush()
+	return nil
+}
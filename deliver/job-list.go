@@ -0,0 +1,187 @@
+package deliver
+
+import (
+	"fmt"
+	"fts-cd-file-utility/common"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_JOB_LIST_LIMIT = 50
+	MAX_JOB_LIST_LIMIT     = 1000
+)
+
+// JobListItem - задание в ответе GET /cd-jobs
+type JobListItem struct {
+	JobId string `json:"jobId"`
+	common.JobStatus
+}
+
+// JobFilter - параметры отбора, сортировки и пагинации заданий
+type JobFilter struct {
+	Statuses      map[common.CdStatus]bool
+	ArtifactTypes map[common.ArtifactType]bool
+	// Подстрока имени артефакта, без учёта регистра
+	Artifact string
+	From     time.Time
+	To       time.Time
+	SortBy   string
+	Desc     bool
+	Offset   int
+	Limit    int
+}
+
+// ListJobsHandler возвращает задания, отобранные по статусу, типу и имени артефакта и времени последнего статуса.
+// Параметры: status, artifactType (через запятую), artifact, from, to (RFC3339),
+// sort (statusDttm, jobId, status), order (asc, desc), offset, limit
+func ListJobsHandler(c echo.Context) error {
+	filter, err := parseJobFilter(c)
+	if err != nil {
+		return c.JSONPretty(http.StatusBadRequest, map[string]interface{}{
+			"success":      false,
+			"errorMessage": err.Error(),
+		}, "  ")
+	}
+	jobs := filterJobs(jobStore.ListJobs(), filter)
+	total := len(jobs)
+	start := min(filter.Offset, total)
+	end := min(start+filter.Limit, total)
+	return c.JSONPretty(http.StatusOK, map[string]interface{}{
+		"total":  total,
+		"offset": filter.Offset,
+		"limit":  filter.Limit,
+		"jobs":   jobs[start:end],
+	}, "  ")
+}
+
+func parseJobFilter(c echo.Context) (JobFilter, error) {
+	filter := JobFilter{
+		Statuses:      map[common.CdStatus]bool{},
+		ArtifactTypes: map[common.ArtifactType]bool{},
+		Artifact:      strings.ToLower(c.QueryParam("artifact")),
+		SortBy:        "statusDttm",
+		Desc:          true,
+		Limit:         DEFAULT_JOB_LIST_LIMIT,
+	}
+	for _, status := range splitQueryParam(c.QueryParam("status")) {
+		filter.Statuses[common.CdStatus(strings.ToUpper(status))] = true
+	}
+	for _, artifactType := range splitQueryParam(c.QueryParam("artifactType")) {
+		filter.ArtifactTypes[common.ArtifactType(strings.ToUpper(artifactType))] = true
+	}
+	var err error
+	if filter.From, err = parseTimeParam(c, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTimeParam(c, "to"); err != nil {
+		return filter, err
+	}
+	if sortBy := c.QueryParam("sort"); sortBy != "" {
+		switch sortBy {
+		case "statusDttm", "jobId", "status":
+			filter.SortBy = sortBy
+		default:
+			return filter, fmt.Errorf("unsupported sort field '%s'. Use statusDttm, jobId or status", sortBy)
+		}
+	}
+	switch strings.ToLower(c.QueryParam("order")) {
+	case "", "desc":
+	case "asc":
+		filter.Desc = false
+	default:
+		return filter, fmt.Errorf("unsupported order '%s'. Use asc or desc", c.QueryParam("order"))
+	}
+	if filter.Offset, err = parseIntParam(c, "offset", 0); err != nil {
+		return filter, err
+	}
+	if filter.Limit, err = parseIntParam(c, "limit", DEFAULT_JOB_LIST_LIMIT); err != nil {
+		return filter, err
+	}
+	if filter.Limit == 0 || filter.Limit > MAX_JOB_LIST_LIMIT {
+		filter.Limit = MAX_JOB_LIST_LIMIT
+	}
+	return filter, nil
+}
+
+func filterJobs(jobs map[string]common.JobStatus, filter JobFilter) []JobListItem {
+	result := make([]JobListItem, 0, len(jobs))
+	for jobId, jobStatus := range jobs {
+		if len(filter.Statuses) > 0 && !filter.Statuses[jobStatus.Status] {
+			continue
+		}
+		if len(filter.ArtifactTypes) > 0 && !filter.ArtifactTypes[jobStatus.ArtifactType] {
+			continue
+		}
+		if filter.Artifact != "" && (jobStatus.Artifact == nil ||
+			!strings.Contains(strings.ToLower(jobStatus.Artifact.GetOriginalResourceName()), filter.Artifact)) {
+			continue
+		}
+		if !filter.From.IsZero() && jobStatus.StatusDttm.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && jobStatus.StatusDttm.After(filter.To) {
+			continue
+		}
+		if jobStatus.Status == common.QUEUED {
+			jobStatus.QueuePosition = jobQueue.Position(jobId)
+		}
+		result = append(result, JobListItem{JobId: jobId, JobStatus: jobStatus})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if filter.Desc {
+			a, b = b, a
+		}
+		switch filter.SortBy {
+		case "status":
+			if a.Status != b.Status {
+				return a.Status < b.Status
+			}
+		case "statusDttm":
+			if !a.StatusDttm.Equal(b.StatusDttm) {
+				return a.StatusDttm.Before(b.StatusDttm)
+			}
+		}
+		return a.JobId < b.JobId
+	})
+	return result
+}
+
+func splitQueryParam(value string) []string {
+	var result []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+func parseTimeParam(c echo.Context, name string) (time.Time, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parameter '%s' must be in RFC3339 format, e.g. 2024-01-02T15:04:05Z", name)
+	}
+	return t, nil
+}
+
+func parseIntParam(c echo.Context, name string, defaultValue int) (int, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("parameter '%s' must be a non-negative integer", name)
+	}
+	return n, nil
+}
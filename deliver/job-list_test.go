@@ -0,0 +1,100 @@
+package deliver
+
+import (
+	"encoding/json"
+	"fts-cd-file-utility/common"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFilterJobs(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	jobs := map[string]common.JobStatus{
+		"a": {Artifact: &common.HttpArtifact{DownloadFilePath: "https://example.com/Tool.zip"}, ArtifactType: common.RAW, Status: common.SUCCESS, StatusDttm: now.Add(-3 * time.Hour)},
+		"b": {Artifact: &common.HttpArtifact{DownloadFilePath: "https://example.com/lib.tar.gz"}, ArtifactType: common.RAW, Status: common.DOWNLOADING_FAILED, StatusDttm: now.Add(-2 * time.Hour)},
+		"c": {Artifact: &common.DockerArtifact{ImageName: "alpine"}, ArtifactType: common.DOCKER, Status: common.SUCCESS, StatusDttm: now.Add(-time.Hour)},
+		"d": {ArtifactType: common.DOCKER, Status: common.DOWNLOADING, StatusDttm: now},
+	}
+	tests := []struct {
+		name   string
+		filter JobFilter
+		want   []string
+	}{
+		{"all by statusDttm desc", JobFilter{SortBy: "statusDttm", Desc: true}, []string{"d", "c", "b", "a"}},
+		{"all by statusDttm asc", JobFilter{SortBy: "statusDttm"}, []string{"a", "b", "c", "d"}},
+		{"by status", JobFilter{Statuses: map[common.CdStatus]bool{common.SUCCESS: true}, SortBy: "jobId"}, []string{"a", "c"}},
+		{"by artifact type", JobFilter{ArtifactTypes: map[common.ArtifactType]bool{common.DOCKER: true}, SortBy: "jobId"}, []string{"c", "d"}},
+		{"by artifact name ignoring case", JobFilter{Artifact: "tool", SortBy: "jobId"}, []string{"a"}},
+		{"by time range", JobFilter{From: now.Add(-150 * time.Minute), To: now.Add(-time.Hour), SortBy: "jobId"}, []string{"b", "c"}},
+		{"sort by status then jobId", JobFilter{SortBy: "status"}, []string{"d", "b", "a", "c"}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, item := range filterJobs(jobs, test.filter) {
+			got = append(got, item.JobId)
+		}
+		if !equalStrings(got, test.want) {
+			t.Errorf("%s: jobs = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestListJobsHandler(t *testing.T) {
+	store := NewJobStatusMap()
+	useTestJobStore(t, store)
+	now := time.Now()
+	for i, jobId := range []string{"a", "b", "c", "d", "e"} {
+		store.SetJobStatus(jobId, common.JobStatus{Artifact: testArtifact, ArtifactType: common.RAW, Status: common.SUCCESS, StatusDttm: now.Add(time.Duration(i) * time.Minute)})
+	}
+	tests := []struct {
+		name      string
+		query     string
+		wantCode  int
+		wantTotal int
+		wantJobs  []string
+	}{
+		{"default", "", http.StatusOK, 5, []string{"e", "d", "c", "b", "a"}},
+		{"page", "sort=jobId&order=asc&offset=1&limit=2", http.StatusOK, 5, []string{"b", "c"}},
+		{"offset past end", "offset=10", http.StatusOK, 5, []string{}},
+		{"filtered", "status=success,downloading&artifactType=raw&limit=1", http.StatusOK, 5, []string{"e"}},
+		{"no matches", "status=CANCELLED", http.StatusOK, 0, []string{}},
+		{"bad sort", "sort=size", http.StatusBadRequest, 0, nil},
+		{"bad order", "order=up", http.StatusBadRequest, 0, nil},
+		{"bad time", "from=yesterday", http.StatusBadRequest, 0, nil},
+		{"bad limit", "limit=-1", http.StatusBadRequest, 0, nil},
+	}
+	e := echo.New()
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/cd-jobs?"+test.query, nil), recorder)
+		if err := ListJobsHandler(c); err != nil {
+			t.Fatal(err)
+		}
+		if recorder.Code != test.wantCode {
+			t.Errorf("%s: code = %d, want %d", test.name, recorder.Code, test.wantCode)
+			continue
+		}
+		if test.wantCode != http.StatusOK {
+			continue
+		}
+		var response struct {
+			Total int `json:"total"`
+			Jobs  []struct {
+				JobId string `json:"jobId"`
+			} `json:"jobs"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, item := range response.Jobs {
+			got = append(got, item.JobId)
+		}
+		if response.Total != test.wantTotal || !equalStrings(got, test.wantJobs) {
+			t.Errorf("%s: total = %d, jobs = %v, want %d, %v", test.name, response.Total, got, test.wantTotal, test.wantJobs)
+		}
+	}
+}
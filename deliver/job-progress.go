@@ -0,0 +1,58 @@
+package deliver
+
+import (
+	"fts-cd-file-utility/common"
+	"time"
+)
+
+// Как часто ход скачивания сохраняется в хранилище заданий
+const progressUpdateInterval = time.Second
+
+// progressTracker считает скачанные байты, скорость и оставшееся время
+// и периодически сохраняет их в JobStatus.Progress
+type progressTracker struct {
+	jobId      string
+	bytesDone  int64
+	totalBytes int64
+	// байты, скачанные до продолжения скачивания, не учитываются в скорости
+	startBytes  int64
+	startDttm   time.Time
+	lastUpdated time.Time
+}
+
+func newProgressTracker(jobId string, offset, totalBytes int64) *progressTracker {
+	now := time.Now()
+	return &progressTracker{jobId: jobId, bytesDone: offset, totalBytes: totalBytes, startBytes: offset, startDttm: now, lastUpdated: now}
+}
+
+// Add учитывает n скачанных байт и не чаще раза в секунду сохраняет ход скачивания
+func (t *progressTracker) Add(n int) {
+	t.bytesDone += int64(n)
+	if time.Since(t.lastUpdated) >= progressUpdateInterval {
+		t.Flush()
+	}
+}
+
+// Flush сохраняет текущий ход скачивания. Статус задания, отменённого или завершённого тем временем, не меняется
+func (t *progressTracker) Flush() {
+	now := time.Now()
+	t.lastUpdated = now
+	jobStore.Update(t.jobId, func(jobStatus *common.JobStatus) bool {
+		if jobStatus.Status == "" || common.IsFinalStatus(jobStatus.Status) {
+			return false
+		}
+		jobStatus.Progress = t.progress(now)
+		return true
+	})
+}
+
+func (t *progressTracker) progress(now time.Time) *common.JobProgress {
+	progress := &common.JobProgress{BytesDone: t.bytesDone, TotalBytes: t.totalBytes, UpdatedDttm: now}
+	if elapsed := now.Sub(t.startDttm).Seconds(); elapsed > 0 {
+		progress.BytesPerSecond = int64(float64(t.bytesDone-t.startBytes) / elapsed)
+	}
+	if progress.BytesPerSecond > 0 && t.totalBytes > t.bytesDone {
+		progress.EtaSeconds = (t.totalBytes - t.bytesDone) / progress.BytesPerSecond
+	}
+	return progress
+}
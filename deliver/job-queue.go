@@ -0,0 +1,167 @@
+package deliver
+
+import (
+	"context"
+	"errors"
+	"fts-cd-file-utility/cfg"
+	"fts-cd-file-utility/common"
+	"log"
+	"sync"
+	"time"
+)
+
+var ErrQueueFull = errors.New("job queue is full")
+
+// ErrJobExists - задание с таким jobId уже в очереди или выполняется
+var ErrJobExists = errors.New("job already exists")
+
+type queuedJob struct {
+	jobId    string
+	artifact common.Artifact
+}
+
+// JobQueue ограничивает число одновременно выполняемых заданий для каждого типа артефакта.
+// Задания сверх лимита ждут в очереди в порядке поступления.
+type JobQueue struct {
+	lock    sync.Mutex
+	config  *cfg.StartupConfig
+	pending map[common.ArtifactType][]queuedJob
+	running map[common.ArtifactType]int
+	// функции отмены выполняющихся заданий
+	cancels map[string]context.CancelFunc
+	// run выполняет задание, по умолчанию startCd
+	run func(ctx context.Context, jobId string, artifact common.Artifact)
+}
+
+var jobQueue = NewJobQueue(&common.StartupConfig, startCd)
+
+func NewJobQueue(config *cfg.StartupConfig, run func(ctx context.Context, jobId string, artifact common.Artifact)) *JobQueue {
+	return &JobQueue{
+		config:  config,
+		pending: make(map[common.ArtifactType][]queuedJob),
+		running: make(map[common.ArtifactType]int),
+		cancels: make(map[string]context.CancelFunc),
+		run:     run,
+	}
+}
+
+// Submit запускает задание сразу, если есть свободный слот, иначе ставит его в очередь со статусом QUEUED.
+// Задание с jobId, который уже в очереди или выполняется, отклоняется: у них были бы общие файлы на шаре
+func (q *JobQueue) Submit(jobId string, artifact common.Artifact) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.contains(jobId) {
+		log.Printf("Job - %s: rejected since job with the same id is queued or running\n", jobId)
+		return ErrJobExists
+	}
+
+	artifactType := artifact.GetType()
+	if q.running[artifactType] < q.config.GetConcurrency(string(artifactType)) {
+		q.start(queuedJob{jobId: jobId, artifact: artifact})
+		return nil
+	}
+	if q.size() >= q.config.SendQueueSize {
+		log.Printf("Job - %s: rejected since queue is full (%d jobs)\n", jobId, q.config.SendQueueSize)
+		return ErrQueueFull
+	}
+	q.pending[artifactType] = append(q.pending[artifactType], queuedJob{jobId: jobId, artifact: artifact})
+	// у задания, возвращённого в очередь после перезапуска или отправленного повторно, история статусов сохраняется
+	jobStore.Update(jobId, func(jobStatus *common.JobStatus) bool {
+		history := jobStatus.History
+		*jobStatus = common.JobStatus{Artifact: artifact, ArtifactType: artifactType, Status: common.QUEUED, StatusDttm: time.Now()}
+		jobStatus.History = common.AppendStatusHistory(history, jobStatus.Status, jobStatus.StatusDttm)
+		return true
+	})
+	log.Printf("Job - %s: queued at position %d\n", jobId, len(q.pending[artifactType]))
+	return nil
+}
+
+// Position возвращает позицию задания в очереди (начиная с 1) или 0, если задание не в очереди
+func (q *JobQueue) Position(jobId string) int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for _, jobs := range q.pending {
+		for i, job := range jobs {
+			if job.jobId == jobId {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// Cancel убирает задание из очереди или отменяет контекст выполняющегося задания.
+// Возвращает false, если задание не найдено ни в очереди, ни среди выполняющихся.
+func (q *JobQueue) Cancel(jobId string) (found bool, wasQueued bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for artifactType, jobs := range q.pending {
+		for i, job := range jobs {
+			if job.jobId == jobId {
+				q.pending[artifactType] = append(jobs[:i:i], jobs[i+1:]...)
+				return true, true
+			}
+		}
+	}
+	if cancel, ok := q.cancels[jobId]; ok {
+		cancel()
+		return true, false
+	}
+	return false, false
+}
+
+// Contains - задание в очереди или выполняется
+func (q *JobQueue) Contains(jobId string) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.contains(jobId)
+}
+
+// contains должен вызываться под q.lock
+func (q *JobQueue) contains(jobId string) bool {
+	if _, running := q.cancels[jobId]; running {
+		return true
+	}
+	for _, jobs := range q.pending {
+		for _, job := range jobs {
+			if job.jobId == jobId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (q *JobQueue) size() int {
+	size := 0
+	for _, jobs := range q.pending {
+		size += len(jobs)
+	}
+	return size
+}
+
+// start должен вызываться под q.lock
+func (q *JobQueue) start(job queuedJob) {
+	artifactType := job.artifact.GetType()
+	ctx, cancel := context.WithCancel(context.Background())
+	q.running[artifactType]++
+	q.cancels[job.jobId] = cancel
+	go func() {
+		defer q.finish(job.jobId, artifactType)
+		defer cancel()
+		q.run(ctx, job.jobId, job.artifact)
+	}()
+}
+
+func (q *JobQueue) finish(jobId string, artifactType common.ArtifactType) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	delete(q.cancels, jobId)
+	q.running[artifactType]--
+	if jobs := q.pending[artifactType]; len(jobs) > 0 {
+		q.pending[artifactType] = jobs[1:]
+		log.Printf("Job - %s: leaving queue\n", jobs[0].jobId)
+		q.start(jobs[0])
+	}
+}
@@ -0,0 +1,130 @@
+package deliver
+
+import (
+	"context"
+	"fts-cd-file-utility/cfg"
+	"fts-cd-file-utility/common"
+	"testing"
+	"time"
+)
+
+// blockingRun запускает задания, которые выполняются до отмены контекста или закрытия release
+type blockingRun struct {
+	started   chan string
+	cancelled chan string
+	release   chan struct{}
+}
+
+func newBlockingRun() *blockingRun {
+	return &blockingRun{started: make(chan string, 10), cancelled: make(chan string, 10), release: make(chan struct{})}
+}
+
+func (r *blockingRun) run(ctx context.Context, jobId string, artifact common.Artifact) {
+	r.started <- jobId
+	select {
+	case <-ctx.Done():
+		r.cancelled <- jobId
+	case <-r.release:
+	}
+}
+
+func receiveJobId(t *testing.T, jobIds chan string, want string) {
+	t.Helper()
+	select {
+	case jobId := <-jobIds:
+		if jobId != want {
+			t.Fatalf("got job %s, want %s", jobId, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("job %s timed out", want)
+	}
+}
+
+func TestJobQueue(t *testing.T) {
+	useTestJobStore(t, NewJobStatusMap())
+	blocking := newBlockingRun()
+	defer close(blocking.release)
+	config := &cfg.StartupConfig{SendQueueSize: 2, SendConcurrency: map[string]int{string(common.RAW): 1}}
+	queue := NewJobQueue(config, blocking.run)
+
+	steps := []struct {
+		name    string
+		jobId   string
+		wantErr error
+		started bool
+	}{
+		{"starts when slot is free", "job-1", nil, true},
+		{"queued over concurrency limit", "job-2", nil, false},
+		{"queued behind", "job-3", nil, false},
+		{"rejected when queue is full", "job-4", ErrQueueFull, false},
+		{"rejected running duplicate", "job-1", ErrJobExists, false},
+		{"rejected queued duplicate", "job-2", ErrJobExists, false},
+	}
+	for _, step := range steps {
+		if err := queue.Submit(step.jobId, testArtifact); err != step.wantErr {
+			t.Errorf("%s: Submit(%s) error = %v, want %v", step.name, step.jobId, err, step.wantErr)
+		}
+		if step.started {
+			receiveJobId(t, blocking.started, step.jobId)
+		}
+	}
+	for jobId, want := range map[string]int{"job-1": 0, "job-2": 1, "job-3": 2, "job-4": 0} {
+		if position := queue.Position(jobId); position != want {
+			t.Errorf("Position(%s) = %d, want %d", jobId, position, want)
+		}
+	}
+	if status := jobStore.GetJobStatus("job-3").Status; status != common.QUEUED {
+		t.Errorf("job-3 status = %s, want %s", status, common.QUEUED)
+	}
+	if !queue.Contains("job-1") || !queue.Contains("job-3") || queue.Contains("job-4") {
+		t.Error("Contains reports wrong jobs")
+	}
+
+	// отмена задания в очереди сдвигает следующие
+	if found, wasQueued := queue.Cancel("job-2"); !found || !wasQueued {
+		t.Errorf("Cancel(job-2) = %v, %v, want true, true", found, wasQueued)
+	}
+	if position := queue.Position("job-3"); position != 1 {
+		t.Errorf("job-3 position after cancel = %d, want 1", position)
+	}
+	// отмена выполняющегося задания освобождает слот для следующего
+	if found, wasQueued := queue.Cancel("job-1"); !found || wasQueued {
+		t.Errorf("Cancel(job-1) = %v, %v, want true, false", found, wasQueued)
+	}
+	receiveJobId(t, blocking.cancelled, "job-1")
+	receiveJobId(t, blocking.started, "job-3")
+	if found, _ := queue.Cancel("job-4"); found {
+		t.Error("Cancel found unknown job")
+	}
+}
+
+func TestJobQueueConcurrencyPerArtifactType(t *testing.T) {
+	useTestJobStore(t, NewJobStatusMap())
+	blocking := newBlockingRun()
+	defer close(blocking.release)
+	config := &cfg.StartupConfig{SendQueueSize: 10, SendConcurrency: map[string]int{string(common.RAW): 2, string(common.DOCKER): 1}}
+	queue := NewJobQueue(config, blocking.run)
+
+	docker := &common.DockerArtifact{ImageName: "alpine"}
+	submits := []struct {
+		jobId    string
+		artifact common.Artifact
+		started  bool
+	}{
+		{"raw-1", testArtifact, true},
+		{"raw-2", testArtifact, true},
+		{"raw-3", testArtifact, false},
+		{"docker-1", docker, true},
+		{"docker-2", docker, false},
+	}
+	for _, submit := range submits {
+		if err := queue.Submit(submit.jobId, submit.artifact); err != nil {
+			t.Fatal(err)
+		}
+		if submit.started {
+			receiveJobId(t, blocking.started, submit.jobId)
+		} else if position := queue.Position(submit.jobId); position != 1 {
+			t.Errorf("%s position = %d, want 1", submit.jobId, position)
+		}
+	}
+}
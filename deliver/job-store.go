@@ -0,0 +1,338 @@
+package deliver
+
+import (
+	"encoding/json"
+	"fts-cd-file-utility/cfg"
+	"fts-cd-file-utility/common"
+	bolt "go.etcd.io/bbolt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobStore хранит статусы заданий SEND-режима
+type JobStore interface {
+	GetJobStatus(jobId string) common.JobStatus
+	SetJobStatus(jobId string, jobStatus common.JobStatus)
+	// Update атомарно читает статус задания и сохраняет его, если update вернул true.
+	// Для неизвестного задания update получает пустой статус. update не должна обращаться к хранилищу
+	Update(jobId string, update func(jobStatus *common.JobStatus) bool) bool
+	DeleteJob(jobId string)
+	// ListJobs возвращает копию всех сохранённых статусов
+	ListJobs() map[string]common.JobStatus
+	Close() error
+}
+
+// jobStore публикует каждое изменение задания подписчикам /cd-jobs/:jobId/events
+var jobStore JobStore = &notifyingJobStore{JobStore: NewJobStatusMap(), events: jobEvents}
+
+// InitJobStore открывает хранилище заданий согласно конфигу
+// и помечает задания, скачивание которых прервала остановка приложения
+func InitJobStore(config *cfg.StartupConfig) error {
+	if config.SendJobStore == cfg.MemoryJobStore {
+		log.Println("using in-memory job store. Job history will be lost on restart")
+		jobStore = &notifyingJobStore{JobStore: NewJobStatusMap(), events: jobEvents}
+		return nil
+	}
+	store, err := NewBoltJobStore(config.SendJobStorePath)
+	if err != nil {
+		return err
+	}
+	log.Println("using job store", config.SendJobStorePath)
+	jobStore = &notifyingJobStore{JobStore: store, events: jobEvents}
+	markInterruptedJobs(jobStore)
+	return nil
+}
+
+// setJobStatus сохраняет новый статус задания, перенося из предыдущего статуса сведения о попытках
+// и ходе скачивания и дополняя историю статусов
+func setJobStatus(jobId string, jobStatus common.JobStatus) {
+	jobStore.Update(jobId, func(previous *common.JobStatus) bool {
+		if jobStatus.Attempts == 0 {
+			jobStatus.Attempts = previous.Attempts
+			jobStatus.LastError = previous.LastError
+		}
+		if jobStatus.Progress == nil {
+			jobStatus.Progress = previous.Progress
+		}
+		jobStatus.History = common.AppendStatusHistory(previous.History, jobStatus.Status, jobStatus.StatusDttm)
+		*previous = jobStatus
+		return true
+	})
+}
+
+// recordAttempt сохраняет номер текущей попытки и, если есть, ошибку предыдущей.
+// Завершённое задание, например отменённое во время попытки, не меняется
+func recordAttempt(jobId string, attempt int, err error) {
+	jobStore.Update(jobId, func(jobStatus *common.JobStatus) bool {
+		if jobStatus.Status == "" || common.IsFinalStatus(jobStatus.Status) {
+			return false
+		}
+		jobStatus.Attempts = attempt
+		if err != nil {
+			jobStatus.LastError = err.Error()
+		}
+		return true
+	})
+}
+
+// ResumeInterruptedJobs возвращает в очередь задания, ожидавшие в ней при остановке приложения,
+// и ставит в очередь прерванные задания, скачивание которых можно продолжить с частично скачанного временного файла
+func ResumeInterruptedJobs() {
+	resumeQueuedJobs()
+	fsPath, err := getBaseFilePath(common.StartupConfig.NFSPath)
+	if err != nil {
+		log.Printf("failed to get path to store artifacts since %v", err)
+		return
+	}
+	for jobId, jobStatus := range jobStore.ListJobs() {
+		if jobStatus.Status != common.INTERRUPTED {
+			continue
+		}
+		if _, resumable := jobStatus.Artifact.(common.ResumableArtifact); !resumable {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(fsPath, jobId+".tmp")); err != nil {
+			continue
+		}
+		log.Printf("Job - %s: resuming interrupted download\n", jobId)
+		if err := jobQueue.Submit(jobId, jobStatus.Artifact); err != nil {
+			log.Printf("Job - %s: failed to resume: %v\n", jobId, err)
+		}
+	}
+}
+
+// resumeQueuedJobs ставит задания со статусом QUEUED в очередь в прежнем порядке.
+// Задание, которое не удалось поставить в очередь, помечается прерванным
+func resumeQueuedJobs() {
+	jobs := jobStore.ListJobs()
+	var queued []string
+	for jobId, jobStatus := range jobs {
+		if jobStatus.Status == common.QUEUED {
+			queued = append(queued, jobId)
+		}
+	}
+	sort.Slice(queued, func(i, j int) bool {
+		return jobs[queued[i]].StatusDttm.Before(jobs[queued[j]].StatusDttm)
+	})
+	for _, jobId := range queued {
+		log.Printf("Job - %s: returning to queue after restart\n", jobId)
+		if err := jobQueue.Submit(jobId, jobs[jobId].Artifact); err != nil {
+			log.Printf("Job - %s: failed to return to queue: %v\n", jobId, err)
+			interruptJob(jobStore, jobId)
+		}
+	}
+}
+
+func CloseJobStore() {
+	if err := jobStore.Close(); err != nil {
+		log.Printf("failed to close job store: %v\n", err)
+	}
+}
+
+// markInterruptedJobs помечает задания, которые скачивались при остановке приложения.
+// Задания из очереди остаются QUEUED, их вернёт в очередь ResumeInterruptedJobs
+func markInterruptedJobs(store JobStore) {
+	for jobId, jobStatus := range store.ListJobs() {
+		switch jobStatus.Status {
+		case common.DOWNLOADING, common.CHUNKED, common.CHUNK_DOWNLOADING:
+			interruptJob(store, jobId)
+		}
+	}
+}
+
+func interruptJob(store JobStore, jobId string) {
+	store.Update(jobId, func(jobStatus *common.JobStatus) bool {
+		if jobStatus.Status == "" || common.IsFinalStatus(jobStatus.Status) {
+			return false
+		}
+		log.Printf("Job - %s: marking as %s since it was %s at shutdown\n", jobId, common.INTERRUPTED, jobStatus.Status)
+		jobStatus.Status = common.INTERRUPTED
+		jobStatus.StatusDttm = time.Now()
+		jobStatus.History = common.AppendStatusHistory(jobStatus.History, jobStatus.Status, jobStatus.StatusDttm)
+		return true
+	})
+}
+
+// JobStatusMap - хранилище заданий в памяти, используется при `send_job_store` = memory
+type JobStatusMap struct {
+	JobStatusMap map[string]common.JobStatus
+	Lock         sync.RWMutex
+}
+
+func NewJobStatusMap() *JobStatusMap {
+	return &JobStatusMap{
+		JobStatusMap: make(map[string]common.JobStatus),
+	}
+}
+
+func (jsm *JobStatusMap) GetJobStatus(jobId string) common.JobStatus {
+	jsm.Lock.RLock()
+	defer jsm.Lock.RUnlock()
+	return jsm.JobStatusMap[jobId]
+}
+
+func (jsm *JobStatusMap) SetJobStatus(jobId string, jobStatus common.JobStatus) {
+	jsm.Lock.Lock()
+	defer jsm.Lock.Unlock()
+	jsm.JobStatusMap[jobId] = jobStatus
+}
+
+func (jsm *JobStatusMap) Update(jobId string, update func(jobStatus *common.JobStatus) bool) bool {
+	jsm.Lock.Lock()
+	defer jsm.Lock.Unlock()
+	jobStatus := jsm.JobStatusMap[jobId]
+	if !update(&jobStatus) {
+		return false
+	}
+	jsm.JobStatusMap[jobId] = jobStatus
+	return true
+}
+
+func (jsm *JobStatusMap) DeleteJob(jobId string) {
+	jsm.Lock.Lock()
+	defer jsm.Lock.Unlock()
+	delete(jsm.JobStatusMap, jobId)
+}
+
+func (jsm *JobStatusMap) ListJobs() map[string]common.JobStatus {
+	jsm.Lock.RLock()
+	defer jsm.Lock.RUnlock()
+	jobs := make(map[string]common.JobStatus, len(jsm.JobStatusMap))
+	for jobId, jobStatus := range jsm.JobStatusMap {
+		jobs[jobId] = jobStatus
+	}
+	return jobs
+}
+
+func (jsm *JobStatusMap) Close() error {
+	return nil
+}
+
+var jobsBucket = []byte("jobs")
+
+// BoltJobStore - хранилище заданий во встроенной файловой БД bbolt
+type BoltJobStore struct {
+	db *bolt.DB
+}
+
+func NewBoltJobStore(path string) (*BoltJobStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		log.Printf("failed to open job store %s: %v\n", path, err)
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(jobsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		log.Printf("failed to init job store %s: %v\n", path, err)
+		return nil, err
+	}
+	return &BoltJobStore{db: db}, nil
+}
+
+func (s *BoltJobStore) GetJobStatus(jobId string) common.JobStatus {
+	var jobStatus common.JobStatus
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(jobId))
+		if data == nil {
+			return nil
+		}
+		var err error
+		jobStatus, err = common.UnmarshalJobStatus(data)
+		return err
+	})
+	if err != nil {
+		log.Printf("Job - %s: failed to read job status: %v\n", jobId, err)
+	}
+	return jobStatus
+}
+
+func (s *BoltJobStore) SetJobStatus(jobId string, jobStatus common.JobStatus) {
+	data, err := marshalBoltJobStatus(jobStatus)
+	if err != nil {
+		log.Printf("Job - %s: failed to serialize job status %+v: %v\n", jobId, jobStatus, err)
+		return
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Put([]byte(jobId), data)
+	})
+	if err != nil {
+		log.Printf("Job - %s: failed to save job status: %v\n", jobId, err)
+	}
+}
+
+// Update читает и сохраняет статус в одной транзакции bbolt, транзакции на запись выполняются по одной
+func (s *BoltJobStore) Update(jobId string, update func(jobStatus *common.JobStatus) bool) bool {
+	updated := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(jobsBucket)
+		var jobStatus common.JobStatus
+		if data := bucket.Get([]byte(jobId)); data != nil {
+			var err error
+			if jobStatus, err = common.UnmarshalJobStatus(data); err != nil {
+				return err
+			}
+		}
+		if !update(&jobStatus) {
+			return nil
+		}
+		data, err := marshalBoltJobStatus(jobStatus)
+		if err != nil {
+			return err
+		}
+		updated = true
+		return bucket.Put([]byte(jobId), data)
+	})
+	if err != nil {
+		log.Printf("Job - %s: failed to update job status: %v\n", jobId, err)
+		return false
+	}
+	return updated
+}
+
+func marshalBoltJobStatus(jobStatus common.JobStatus) ([]byte, error) {
+	// тип артефакта нужен, чтобы восстановить артефакт при чтении
+	if jobStatus.ArtifactType == "" && jobStatus.Artifact != nil {
+		jobStatus.ArtifactType = jobStatus.Artifact.GetType()
+	}
+	return json.Marshal(jobStatus)
+}
+
+func (s *BoltJobStore) DeleteJob(jobId string) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Delete([]byte(jobId))
+	})
+	if err != nil {
+		log.Printf("Job - %s: failed to delete job status: %v\n", jobId, err)
+	}
+}
+
+func (s *BoltJobStore) ListJobs() map[string]common.JobStatus {
+	jobs := make(map[string]common.JobStatus)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(k, v []byte) error {
+			jobStatus, err := common.UnmarshalJobStatus(v)
+			if err != nil {
+				log.Printf("Job - %s: skipping unreadable job status: %v\n", string(k), err)
+				return nil
+			}
+			jobs[string(k)] = jobStatus
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("failed to list jobs: %v\n", err)
+	}
+	return jobs
+}
+
+func (s *BoltJobStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,230 @@
+package deliver
+
+import (
+	"context"
+	"errors"
+	"fts-cd-file-utility/cfg"
+	"fts-cd-file-utility/common"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errTest = errors.New("connection reset")
+
+// testArtifact - артефакт для статусов заданий в тестах, без него bbolt не восстановит статус
+var testArtifact = &common.HttpArtifact{}
+
+func newTestStores(t *testing.T) map[string]JobStore {
+	t.Helper()
+	boltStore, err := NewBoltJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { boltStore.Close() })
+	return map[string]JobStore{"memory": NewJobStatusMap(), "bolt": boltStore}
+}
+
+// useTestJobStore подменяет глобальное хранилище заданий на время теста
+func useTestJobStore(t *testing.T, store JobStore) {
+	t.Helper()
+	previous := jobStore
+	jobStore = &notifyingJobStore{JobStore: store, events: jobEvents}
+	t.Cleanup(func() { jobStore = previous })
+}
+
+func TestJobStoreUpdateIsAtomic(t *testing.T) {
+	for name, store := range newTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store.SetJobStatus("job", common.JobStatus{Artifact: testArtifact, Status: common.DOWNLOADING, StatusDttm: time.Now()})
+			const updates = 50
+			var wg sync.WaitGroup
+			for i := 0; i < updates; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					store.Update("job", func(jobStatus *common.JobStatus) bool {
+						jobStatus.Attempts++
+						return true
+					})
+				}()
+			}
+			wg.Wait()
+			if attempts := store.GetJobStatus("job").Attempts; attempts != updates {
+				t.Errorf("attempts = %d, want %d", attempts, updates)
+			}
+		})
+	}
+}
+
+func TestJobStoreUpdateSkipsWhenRejected(t *testing.T) {
+	for name, store := range newTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if store.Update("missing", func(jobStatus *common.JobStatus) bool { return jobStatus.Status != "" }) {
+				t.Error("Update saved status of unknown job")
+			}
+			if status := store.GetJobStatus("missing").Status; status != "" {
+				t.Errorf("unknown job got status %s", status)
+			}
+		})
+	}
+}
+
+func TestSetJobStatusKeepsAttemptsAndHistory(t *testing.T) {
+	for name, store := range newTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			useTestJobStore(t, store)
+			setJobStatus("job", common.JobStatus{Artifact: testArtifact, Status: common.DOWNLOADING, StatusDttm: time.Now()})
+			recordAttempt("job", 2, errTest)
+			setJobStatus("job", common.JobStatus{Artifact: testArtifact, Status: common.DOWNLOADING_DONE, StatusDttm: time.Now()})
+
+			jobStatus := jobStore.GetJobStatus("job")
+			if jobStatus.Attempts != 2 || jobStatus.LastError != errTest.Error() {
+				t.Errorf("attempts = %d, lastError = %q", jobStatus.Attempts, jobStatus.LastError)
+			}
+			var statuses []common.CdStatus
+			for _, transition := range jobStatus.History {
+				statuses = append(statuses, transition.Status)
+			}
+			if len(statuses) != 2 || statuses[0] != common.DOWNLOADING || statuses[1] != common.DOWNLOADING_DONE {
+				t.Errorf("history = %v", statuses)
+			}
+		})
+	}
+}
+
+func TestProgressDoesNotOverwriteCancelledJob(t *testing.T) {
+	for name, store := range newTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			useTestJobStore(t, store)
+			setJobStatus("job", common.JobStatus{Artifact: testArtifact, Status: common.DOWNLOADING, StatusDttm: time.Now()})
+			tracker := newProgressTracker("job", 0, 100)
+
+			var wg sync.WaitGroup
+			stop := make(chan struct{})
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						tracker.Flush()
+						recordAttempt("job", 2, nil)
+					}
+				}
+			}()
+			setJobStatus("job", common.JobStatus{Artifact: testArtifact, Status: common.CANCELLED, StatusDttm: time.Now()})
+			close(stop)
+			wg.Wait()
+			tracker.Flush()
+			recordAttempt("job", 3, errTest)
+
+			jobStatus := jobStore.GetJobStatus("job")
+			if jobStatus.Status != common.CANCELLED {
+				t.Fatalf("status = %s, want %s", jobStatus.Status, common.CANCELLED)
+			}
+			if jobStatus.Attempts == 3 {
+				t.Error("attempt is recorded for cancelled job")
+			}
+		})
+	}
+}
+
+// useTestJobQueue подменяет глобальную очередь заданий на время теста
+func useTestJobQueue(t *testing.T, config *cfg.StartupConfig, run func(ctx context.Context, jobId string, artifact common.Artifact)) *JobQueue {
+	t.Helper()
+	previous := jobQueue
+	jobQueue = NewJobQueue(config, run)
+	t.Cleanup(func() { jobQueue = previous })
+	return jobQueue
+}
+
+func TestResumeInterruptedJobsAfterRestart(t *testing.T) {
+	fsPath := t.TempDir()
+	previousNfsPath := common.StartupConfig.NFSPath
+	common.StartupConfig.NFSPath = "fs://" + fsPath
+	t.Cleanup(func() { common.StartupConfig.NFSPath = previousNfsPath })
+
+	store, err := NewBoltJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	useTestJobStore(t, store)
+
+	now := time.Now()
+	jobs := map[string]common.JobStatus{
+		"queued-2":    {Artifact: testArtifact, Status: common.QUEUED, StatusDttm: now.Add(-time.Minute)},
+		"queued-1":    {Artifact: testArtifact, Status: common.QUEUED, StatusDttm: now.Add(-2 * time.Minute)},
+		"partial":     {Artifact: testArtifact, Status: common.DOWNLOADING, StatusDttm: now},
+		"not-started": {Artifact: testArtifact, Status: common.DOWNLOADING, StatusDttm: now},
+		"docker":      {Artifact: &common.DockerArtifact{ImageName: "alpine"}, Status: common.CHUNK_DOWNLOADING, StatusDttm: now},
+		"deployed":    {Artifact: testArtifact, Status: common.DEPLOYED, StatusDttm: now},
+	}
+	for jobId, jobStatus := range jobs {
+		store.SetJobStatus(jobId, jobStatus)
+	}
+	for _, jobId := range []string{"partial", "docker"} {
+		if err := os.WriteFile(filepath.Join(fsPath, jobId+".tmp"), []byte("part"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// перезапуск: InitJobStore помечает прерванные задания, затем они возвращаются в очередь
+	markInterruptedJobs(jobStore)
+	started := make(chan string, len(jobs))
+	release := make(chan struct{})
+	config := &cfg.StartupConfig{SendQueueSize: 10, SendConcurrency: map[string]int{string(common.RAW): 1}}
+	useTestJobQueue(t, config, func(ctx context.Context, jobId string, artifact common.Artifact) {
+		started <- jobId
+		<-release
+	})
+	ResumeInterruptedJobs()
+
+	if position := jobQueue.Position("queued-2"); position != 1 {
+		t.Errorf("queued-2 position = %d, want 1", position)
+	}
+	if status := jobStore.GetJobStatus("queued-2").Status; status != common.QUEUED {
+		t.Errorf("queued-2 status = %s, want %s", status, common.QUEUED)
+	}
+	close(release)
+	var order []string
+	for i := 0; i < 3; i++ {
+		select {
+		case jobId := <-started:
+			order = append(order, jobId)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("jobs started: %v", order)
+		}
+	}
+	if want := []string{"queued-1", "queued-2", "partial"}; !equalStrings(order, want) {
+		t.Errorf("jobs started in order %v, want %v", order, want)
+	}
+
+	wantStatuses := map[string]common.CdStatus{
+		"not-started": common.INTERRUPTED,
+		"docker":      common.INTERRUPTED,
+		"deployed":    common.DEPLOYED,
+	}
+	for jobId, want := range wantStatuses {
+		if status := jobStore.GetJobStatus(jobId).Status; status != want {
+			t.Errorf("%s status = %s, want %s", jobId, status, want)
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
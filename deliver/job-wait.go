@@ -0,0 +1,98 @@
+package deliver
+
+import (
+	"fmt"
+	"fts-cd-file-utility/common"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_WAIT_TIMEOUT = 30 * time.Minute
+	MAX_WAIT_TIMEOUT     = 24 * time.Hour
+)
+
+// WaitJobHandler ждёт, пока задание не достигнет статуса until (по умолчанию SUCCESS) или не завершится.
+// Коды ответа рассчитаны на `curl --fail`:
+// 200 - статус достигнут, 500 - задание упало, 410 - задание отменено,
+// 409 - задание завершилось, не пройдя статус until, 408 - истёк timeout, 404 - задание не найдено.
+// Прерванное перезапуском задание (INTERRUPTED) может быть продолжено, поэтому ожидание не прекращается
+func WaitJobHandler(c echo.Context) error {
+	jobId := c.Param("jobId")
+	until := common.SUCCESS
+	if value := c.QueryParam("until"); value != "" {
+		until = common.CdStatus(strings.ToUpper(value))
+		switch until {
+		case common.DOWNLOADING, common.DOWNLOADING_DONE, common.CHUNKED, common.CHUNK_DOWNLOADING, common.CHUNK_DONE, common.SUCCESS, common.DEPLOYED:
+		default:
+			return c.JSONPretty(http.StatusBadRequest, map[string]interface{}{
+				"success":      false,
+				"errorMessage": fmt.Sprintf("can't wait for status '%s'", value),
+			}, "  ")
+		}
+	}
+	timeout := DEFAULT_WAIT_TIMEOUT
+	if value := c.QueryParam("timeout"); value != "" {
+		var err error
+		timeout, err = time.ParseDuration(value)
+		if err != nil || timeout <= 0 || timeout > MAX_WAIT_TIMEOUT {
+			return c.JSONPretty(http.StatusBadRequest, map[string]interface{}{
+				"success":      false,
+				"errorMessage": fmt.Sprintf("parameter 'timeout' must be a positive duration up to %s, e.g. 30m", MAX_WAIT_TIMEOUT),
+			}, "  ")
+		}
+	}
+
+	// подписываемся до чтения статуса, чтобы не пропустить изменение между ними
+	events, unsubscribe := jobEvents.Subscribe(jobId)
+	defer unsubscribe()
+	jobStatus := jobStore.GetJobStatus(jobId)
+	if jobStatus.Status == "" {
+		return c.JSONPretty(http.StatusNotFound, map[string]interface{}{
+			"success":      false,
+			"errorMessage": fmt.Sprintf("job %s not found", jobId),
+		}, "  ")
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		if code, done := getWaitResult(jobStatus, until); done {
+			return c.JSONPretty(code, jobStatus, "  ")
+		}
+		select {
+		case jobStatus = <-events:
+		case <-deadline.C:
+			if jobStatus.Status == common.QUEUED {
+				jobStatus.QueuePosition = jobQueue.Position(jobId)
+			}
+			return c.JSONPretty(http.StatusRequestTimeout, jobStatus, "  ")
+		case <-c.Request().Context().Done():
+			return nil
+		}
+	}
+}
+
+// getWaitResult возвращает код ответа и признак того, что ждать больше нечего
+func getWaitResult(jobStatus common.JobStatus, until common.CdStatus) (int, bool) {
+	// подтверждённая RECEIVE загрузка считается успешным завершением
+	if jobStatus.Status == until || (jobStatus.Status == common.DEPLOYED && until == common.SUCCESS) {
+		return http.StatusOK, true
+	}
+	for _, transition := range jobStatus.History {
+		if transition.Status == until {
+			return http.StatusOK, true
+		}
+	}
+	switch jobStatus.Status {
+	case common.DOWNLOADING_FAILED, common.META_WRITING_FAILED, common.DEPLOY_FAILED:
+		return http.StatusInternalServerError, true
+	case common.CANCELLED:
+		return http.StatusGone, true
+	case common.SUCCESS, common.DEPLOYED:
+		return http.StatusConflict, true
+	}
+	return 0, false
+}
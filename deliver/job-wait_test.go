@@ -0,0 +1,42 @@
+package deliver
+
+import (
+	"fts-cd-file-utility/common"
+	"net/http"
+	"testing"
+)
+
+func TestGetWaitResult(t *testing.T) {
+	history := func(statuses ...common.CdStatus) []common.StatusTransition {
+		var transitions []common.StatusTransition
+		for _, status := range statuses {
+			transitions = append(transitions, common.StatusTransition{Status: status})
+		}
+		return transitions
+	}
+	tests := []struct {
+		name     string
+		status   common.CdStatus
+		history  []common.StatusTransition
+		until    common.CdStatus
+		wantCode int
+		wantDone bool
+	}{
+		{"reached", common.DOWNLOADING_DONE, nil, common.DOWNLOADING_DONE, http.StatusOK, true},
+		{"deployed satisfies success", common.DEPLOYED, nil, common.SUCCESS, http.StatusOK, true},
+		{"passed in history", common.DEPLOY_FAILED, history(common.DOWNLOADING, common.DOWNLOADING_DONE), common.DOWNLOADING_DONE, http.StatusOK, true},
+		{"still running", common.DOWNLOADING, nil, common.SUCCESS, 0, false},
+		{"queued", common.QUEUED, nil, common.SUCCESS, 0, false},
+		{"interrupted may be resumed", common.INTERRUPTED, nil, common.SUCCESS, 0, false},
+		{"download failed", common.DOWNLOADING_FAILED, nil, common.SUCCESS, http.StatusInternalServerError, true},
+		{"deploy failed", common.DEPLOY_FAILED, nil, common.SUCCESS, http.StatusInternalServerError, true},
+		{"cancelled", common.CANCELLED, nil, common.SUCCESS, http.StatusGone, true},
+		{"finished without status", common.DEPLOYED, nil, common.CHUNKED, http.StatusConflict, true},
+	}
+	for _, test := range tests {
+		code, done := getWaitResult(common.JobStatus{Status: test.status, History: test.history}, test.until)
+		if code != test.wantCode || done != test.wantDone {
+			t.Errorf("%s: getWaitResult = %d, %v, want %d, %v", test.name, code, done, test.wantCode, test.wantDone)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package deploy
+
+import (
+	"fts-cd-file-utility/cfg"
+	"fts-cd-file-utility/common"
+	"github.com/hirochachacha/go-smb2"
+	"strings"
+)
+
+// artifactPublishers - загрузка на стороне RECEIVE по типам артефактов, добавляется в реестр типов common
+var artifactPublishers = map[common.ArtifactType]common.ArtifactPublisher{
+	common.DOCKER: {Description: "docker image", Toggle: "receive_docker_enabled",
+		Enabled: func() bool { return common.StartupConfig.ReceiveDockerEnabled }, Publish: withChecksum(publishDockerImage)},
+	common.PYPI: {Description: "pypi package", Toggle: "receive_pypi_enabled",
+		Enabled: func() bool { return common.StartupConfig.ReceivePypiEnabled }, Publish: withChecksum(publishPypiPackage)},
+	common.HF: {Description: "huggingface model", Toggle: "receive_hf_enabled",
+		Enabled: func() bool { return common.StartupConfig.ReceiveHfEnabled }, Publish: withChecksum(publishHfModel)},
+	common.NPM: {Description: "npm package", Toggle: "receive_npm_enabled",
+		Enabled: func() bool { return common.StartupConfig.ReceiveNpmEnabled }, Publish: withChecksum(publishNpmPackage)},
+	common.MAVEN: {Description: "maven artifact", Toggle: "receive_maven_enabled",
+		Enabled: func() bool { return common.StartupConfig.ReceiveMavenEnabled }, Publish: withChecksum(publishMavenArtifact)},
+	common.RAW: {Description: "raw file", Toggle: "receive_raw_enabled",
+		Enabled: func() bool { return common.StartupConfig.ReceiveRawEnabled }, Publish: withChecksum(publishRawFile)},
+	common.HELM: {Description: "helm chart", Toggle: "receive_helm_enabled",
+		Enabled: func() bool { return common.StartupConfig.ReceiveHelmEnabled }, Publish: withChecksum(publishHelmChart)},
+	common.GO: {Description: "go module", Toggle: "receive_go_enabled",
+		Enabled: func() bool { return common.StartupConfig.ReceiveGoEnabled }, Publish: withChecksum(publishGoModule)},
+	common.APT: {Description: "apt package", Toggle: "receive_apt_enabled",
+		Enabled: func() bool { return common.StartupConfig.ReceiveAptEnabled }, Publish: withChecksum(withJobStatus(smbUploadAptPackage))},
+	common.YUM: {Description: "yum package", Toggle: "receive_yum_enabled",
+		Enabled: func() bool { return common.StartupConfig.ReceiveYumEnabled }, Publish: withChecksum(withJobStatus(smbUploadYumPackage))},
+	common.NUGET: {Description: "nuget package", Toggle: "receive_nuget_enabled",
+		Enabled: func() bool { return common.StartupConfig.ReceiveNugetEnabled }, Publish: withChecksum(withJobStatus(smbUploadNugetPackage))},
+	common.CONDA: {Description: "conda package", Toggle: "receive_conda_enabled",
+		Enabled: func() bool { return common.StartupConfig.ReceiveCondaEnabled }, Publish: withChecksum(withJobStatus(smbUploadCondaPackage))},
+	common.CARGO: {Description: "crate", Toggle: "receive_cargo_enabled",
+		Enabled: func() bool { return common.StartupConfig.ReceiveCargoEnabled }, Publish: withChecksum(publishCrate)},
+}
+
+// RegisterArtifactPublishers добавляет загрузку на стороне RECEIVE в реестр типов артефактов.
+// Тип без загрузки в реестре пропускается при обработке заданий
+func RegisterArtifactPublishers() error {
+	for artifactType, publisher := range artifactPublishers {
+		if err := common.RegisterArtifactPublisher(artifactType, publisher); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withChecksum передаёт в загрузку проверку sha256 артефакта, посчитанной SEND
+func withChecksum(publish func(fs *smb2.Share, filePath string, jobStatus *common.JobStatus, checksum *checksumVerifier) (string, string, error)) func(*smb2.Share, string, *common.JobStatus) (string, string, error) {
+	return func(fs *smb2.Share, filePath string, jobStatus *common.JobStatus) (string, string, error) {
+		return publish(fs, filePath, jobStatus, newChecksumVerifier(jobStatus))
+	}
+}
+
+func publishDockerImage(fs *smb2.Share, filePath string, jobStatus *common.JobStatus, checksum *checksumVerifier) (string, string, error) {
+	artifact := *jobStatus.Artifact.(*common.DockerArtifact)
+	load := smbLoadImage
+	if common.StartupConfig.ReceiveDockerTransport == cfg.RegistryDockerTransport {
+		load = smbPushImageArchive
+	}
+	digest, err := load(filePath, artifact, fs, checksum)
+	if err != nil {
+		return "", "", err
+	}
+	location := common.BuildTargetImageName(common.StartupConfig.ReceiveDockerRegistry, artifact.ImageName)
+	if digest != "" {
+		location += "@" + digest
+	}
+	return location, digest, nil
+}
+
+func publishPypiPackage(fs *smb2.Share, filePath string, jobStatus *common.JobStatus, checksum *checksumVerifier) (string, string, error) {
+	artifact := *jobStatus.Artifact.(*common.PypiArtifact)
+	var err error
+	if strings.HasSuffix(jobStatus.ArtifactPath, common.PypiBundleSuffix) {
+		err = smbUploadPypiBundle(filePath, artifact, fs, checksum)
+	} else {
+		err = smbUploadPypiPackage(filePath, jobStatus.ArtifactPath, artifact, fs, checksum)
+	}
+	// twine не возвращает адрес загруженного файла, поэтому указываем репозиторий
+	return buildNexusPypiRepoName(), "", err
+}
+
+func publishHfModel(fs *smb2.Share, filePath string, jobStatus *common.JobStatus, checksum *checksumVerifier) (string, string, error) {
+	location, err := smbUploadHfModel(filePath, jobStatus.ArtifactPath, *jobStatus.Artifact.(*common.HfArtifact), fs, checksum)
+	return location, "", err
+}
+
+func publishNpmPackage(fs *smb2.Share, filePath string, jobStatus *common.JobStatus, checksum *checksumVerifier) (string, string, error) {
+	location, err := smbUploadNpmPackage(filePath, jobStatus.ArtifactPath, *jobStatus.Artifact.(*common.NpmArtifact), fs, checksum)
+	return location, "", err
+}
+
+func publishMavenArtifact(fs *smb2.Share, filePath string, jobStatus *common.JobStatus, checksum *checksumVerifier) (string, string, error) {
+	location, err := smbUploadMavenArtifact(filePath, *jobStatus.Artifact.(*common.MavenArtifact), fs, checksum)
+	return location, "", err
+}
+
+func publishRawFile(fs *smb2.Share, filePath string, jobStatus *common.JobStatus, checksum *checksumVerifier) (string, string, error) {
+	location, err := smbUploadRawFile(filePath, jobStatus.ArtifactPath, *jobStatus.Artifact.(*common.HttpArtifact), fs, checksum)
+	return location, "", err
+}
+
+func publishHelmChart(fs *smb2.Share, filePath string, jobStatus *common.JobStatus, checksum *checksumVerifier) (string, string, error) {
+	location, err := smbUploadHelmChart(filePath, *jobStatus.Artifact.(*common.HelmArtifact), fs, checksum)
+	return location, "", err
+}
+
+func publishGoModule(fs *smb2.Share, filePath string, jobStatus *common.JobStatus, checksum *checksumVerifier) (string, string, error) {
+	location, err := smbUploadGoModule(filePath, *jobStatus.Artifact.(*common.GoModuleArtifact), fs, checksum)
+	return location, "", err
+}
+
+func publishCrate(fs *smb2.Share, filePath string, jobStatus *common.JobStatus, checksum *checksumVerifier) (string, string, error) {
+	location, err := smbUploadCargoCrate(filePath, jobStatus, *jobStatus.Artifact.(*common.CargoArtifact), fs, checksum)
+	return location, "", err
+}
+
+// withJobStatus приводит загрузку пакета, которой нужны только метаданные задания, к сигнатуре publish
+func withJobStatus(upload func(filePath string, jobStatus *common.JobStatus, fs *smb2.Share, checksum *checksumVerifier) (string, error)) func(*smb2.Share, string, *common.JobStatus, *checksumVerifier) (string, string, error) {
+	return func(fs *smb2.Share, filePath string, jobStatus *common.JobStatus, checksum *checksumVerifier) (string, string, error) {
+		location, err := upload(filePath, jobStatus, fs, checksum)
+		return location, "", err
+	}
+}
@@ -0,0 +1,78 @@
+package deploy
+
+import (
+	"fts-cd-file-utility/common"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// declaredArtifactTypes возвращает значения всех констант типа ArtifactType из пакета common
+func declaredArtifactTypes(t *testing.T) []common.ArtifactType {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join("..", "common", "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var artifactTypes []common.ArtifactType
+	fileSet := token.NewFileSet()
+	for _, file := range files {
+		parsed, err := parser.ParseFile(fileSet, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(parsed, func(node ast.Node) bool {
+			spec, ok := node.(*ast.ValueSpec)
+			if !ok {
+				return true
+			}
+			if ident, ok := spec.Type.(*ast.Ident); !ok || ident.Name != "ArtifactType" {
+				return true
+			}
+			for _, value := range spec.Values {
+				if literal, ok := value.(*ast.BasicLit); ok && literal.Kind == token.STRING {
+					unquoted, err := strconv.Unquote(literal.Value)
+					if err != nil {
+						t.Fatal(err)
+					}
+					artifactTypes = append(artifactTypes, common.ArtifactType(unquoted))
+				}
+			}
+			return true
+		})
+	}
+	return artifactTypes
+}
+
+func TestEveryArtifactTypeIsRegistered(t *testing.T) {
+	if err := RegisterArtifactPublishers(); err != nil {
+		t.Fatal(err)
+	}
+	artifactTypes := declaredArtifactTypes(t)
+	if len(artifactTypes) == 0 {
+		t.Fatal("no ArtifactType constants found in common")
+	}
+	for _, artifactType := range artifactTypes {
+		definition, found := common.GetArtifactTypeDefinition(artifactType)
+		if !found {
+			t.Errorf("artifact type %s is not registered", artifactType)
+			continue
+		}
+		if definition.Name == "" || definition.NewArtifact == nil || definition.NewJob == nil {
+			t.Errorf("artifact type %s has incomplete definition", artifactType)
+			continue
+		}
+		if artifact := definition.NewArtifact(); artifact.GetType() != artifactType {
+			t.Errorf("artifact of type %s reports type %s", artifactType, artifact.GetType())
+		}
+		if definition.Publisher == nil {
+			t.Errorf("artifact type %s has no publisher", artifactType)
+		}
+	}
+	if err := common.RegisterArtifactPublisher(common.DOCKER, artifactPublishers[common.DOCKER]); err == nil {
+		t.Error("publisher is registered twice for the same type")
+	}
+}
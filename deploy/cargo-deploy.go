@@ -0,0 +1,195 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"fts-cd-file-utility/common"
+	"github.com/hirochachacha/go-smb2"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// cargoPublishMetadata - метаданные запроса публикации крейта (PUT /api/v1/crates/new)
+type cargoPublishMetadata struct {
+	Name        string              `json:"name"`
+	Vers        string              `json:"vers"`
+	Deps        []cargoPublishDep   `json:"deps"`
+	Features    map[string][]string `json:"features"`
+	Authors     []string            `json:"authors"`
+	Keywords    []string            `json:"keywords"`
+	Categories  []string            `json:"categories"`
+	Badges      map[string]string   `json:"badges"`
+	Links       string              `json:"links,omitempty"`
+	RustVersion string              `json:"rust_version,omitempty"`
+}
+
+type cargoPublishDep struct {
+	Name            string   `json:"name"`
+	VersionReq      string   `json:"version_req"`
+	Features        []string `json:"features"`
+	Optional        bool     `json:"optional"`
+	DefaultFeatures bool     `json:"default_features"`
+	Target          string   `json:"target,omitempty"`
+	Kind            string   `json:"kind"`
+	Registry        string   `json:"registry,omitempty"`
+	// Имя зависимости в Cargo.toml, если она переименована
+	ExplicitNameInToml string `json:"explicit_name_in_toml,omitempty"`
+}
+
+// smbUploadCargoCrate публикует крейт с шары в cargo-hosted репозиторий с зависимостями и features
+// из индекса исходного реестра. Возвращает url скачивания крейта
+func smbUploadCargoCrate(crateFilePath string, jobStatus *common.JobStatus, artifact common.CargoArtifact, fs *smb2.Share, checksum *checksumVerifier) (string, error) {
+	tempDir, err := os.MkdirTemp("", "cargo_")
+	if err != nil {
+		log.Println("failed to create temp dir", err)
+		return "", err
+	}
+	defer os.RemoveAll(tempDir)
+
+	localFilePath, err := copyVerifiedPackage(crateFilePath, tempDir, fs, checksum)
+	if err != nil {
+		return "", err
+	}
+	metadata, err := buildCargoPublishMetadata(jobStatus, artifact)
+	if err != nil {
+		log.Printf("failed to read index entry of crate %s: %v\n", artifact.GetOriginalResourceName(), err)
+		return "", err
+	}
+	if err := publishCargoCrate(metadata, localFilePath); err != nil {
+		return "", err
+	}
+	location := buildNexusRepoName(common.StartupConfig.ReceiveNexusCargoRepository) +
+		"api/v1/crates/" + metadata.Name + "/" + metadata.Vers + "/download"
+	log.Printf("crate %s %s published successfully to %s\n", metadata.Name, metadata.Vers, location)
+	return location, nil
+}
+
+// buildCargoPublishMetadata переводит строку sparse index в формат запроса публикации
+func buildCargoPublishMetadata(jobStatus *common.JobStatus, artifact common.CargoArtifact) (cargoPublishMetadata, error) {
+	metadata := cargoPublishMetadata{
+		Name:       jobStatus.Metadata[common.PackageMetaName],
+		Vers:       jobStatus.Metadata[common.PackageMetaVersion],
+		Deps:       []cargoPublishDep{},
+		Features:   map[string][]string{},
+		Authors:    []string{},
+		Keywords:   []string{},
+		Categories: []string{},
+		Badges:     map[string]string{},
+	}
+	if metadata.Name == "" {
+		metadata.Name = artifact.CrateName
+	}
+	if metadata.Vers == "" {
+		metadata.Vers = artifact.Version
+	}
+	indexLine := jobStatus.Metadata[common.CargoMetaIndex]
+	if indexLine == "" {
+		log.Printf("job has no index entry of crate %s %s, publishing without dependencies\n", metadata.Name, metadata.Vers)
+		return metadata, nil
+	}
+	var entry common.CargoIndexEntry
+	if err := json.Unmarshal([]byte(indexLine), &entry); err != nil {
+		return metadata, err
+	}
+	metadata.Name, metadata.Vers = entry.Name, entry.Vers
+	metadata.Links, metadata.RustVersion = entry.Links, entry.RustVersion
+	for name, values := range entry.Features {
+		metadata.Features[name] = values
+	}
+	for name, values := range entry.Features2 {
+		metadata.Features[name] = values
+	}
+	for _, dep := range entry.Deps {
+		publishDep := cargoPublishDep{
+			Name:            dep.Name,
+			VersionReq:      dep.Req,
+			Features:        dep.Features,
+			Optional:        dep.Optional,
+			DefaultFeatures: dep.DefaultFeatures,
+			Target:          dep.Target,
+			Kind:            dep.Kind,
+			Registry:        dep.Registry,
+		}
+		// в индексе name - имя в Cargo.toml, а package - настоящее имя крейта
+		if dep.Package != "" {
+			publishDep.Name, publishDep.ExplicitNameInToml = dep.Package, dep.Name
+		}
+		if publishDep.Kind == "" {
+			publishDep.Kind = "normal"
+		}
+		if publishDep.Features == nil {
+			publishDep.Features = []string{}
+		}
+		metadata.Deps = append(metadata.Deps, publishDep)
+	}
+	return metadata, nil
+}
+
+// publishCargoCrate отправляет крейт в cargo-hosted репозиторий. Тело запроса: длина json (u32 LE), json,
+// длина .crate (u32 LE), .crate
+func publishCargoCrate(metadata cargoPublishMetadata, crateFilePath string) error {
+	metadataJson, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	crateFile, err := os.Open(crateFilePath)
+	if err != nil {
+		log.Println("failed to open file for upload", crateFilePath, err)
+		return err
+	}
+	defer crateFile.Close()
+	info, err := crateFile.Stat()
+	if err != nil {
+		log.Println("failed to get file info", crateFilePath, err)
+		return err
+	}
+
+	var header bytes.Buffer
+	binary.Write(&header, binary.LittleEndian, uint32(len(metadataJson)))
+	header.Write(metadataJson)
+	binary.Write(&header, binary.LittleEndian, uint32(info.Size()))
+
+	publishUrl := buildNexusRepoName(common.StartupConfig.ReceiveNexusCargoRepository) + "api/v1/crates/new"
+	req, err := http.NewRequest(http.MethodPut, publishUrl, io.MultiReader(&header, crateFile))
+	if err != nil {
+		log.Println("failed to create request", err)
+		return err
+	}
+	req.ContentLength = int64(header.Len()) + info.Size()
+	req.SetBasicAuth(common.StartupConfig.ReceiveNexusLogin, common.StartupConfig.ReceiveNexusPassword)
+
+	resp, err := common.HttpClient.Do(req)
+	if err != nil {
+		log.Println("publish request failed", err)
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Println("failed to read response", err)
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("publish failed with status %d: %s\n", resp.StatusCode, string(respBody))
+		return &common.HttpStatusError{Url: publishUrl, StatusCode: resp.StatusCode}
+	}
+	// реестр может вернуть ошибки и со статусом 200
+	var result struct {
+		Errors []struct {
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(respBody, &result) == nil && len(result.Errors) > 0 {
+		var details []string
+		for _, e := range result.Errors {
+			details = append(details, e.Detail)
+		}
+		return fmt.Errorf("failed to publish crate %s %s: %s", metadata.Name, metadata.Vers, strings.Join(details, "; "))
+	}
+	return nil
+}
@@ -97,7 +97,7 @@ func LoadChunkedFile(fs *smb2.Share, manifestPath, jobFilePath string) (string,
 	outputPath, err := common.MergeChunks(localManifestPath, tempDir)
 	if err != nil {
 		log.Printf("Error merging chunks: %v\n", err)
-		return "", fmt.Errorf("failed to merge chunks: %v", err)
+		return "", fmt.Errorf("failed to merge chunks: %w", err)
 	}
 	
 	// Дополнительная проверка хеш-сумм (на случай, если MergeChunks не выполнил проверку)
@@ -121,7 +121,7 @@ func LoadChunkedFile(fs *smb2.Share, manifestPath, jobFilePath string) (string,
 			if err != nil {
 				log.Printf("Warning: Failed to calculate SHA256 hash: %v\n", err)
 			} else if calculatedSHA256 != manifest.SHA256Hash {
-				return "", fmt.Errorf("SHA256 hash verification failed: expected %s, got %s", 
+				return "", fmt.Errorf("%w: SHA256 hash verification failed: expected %s, got %s", common.ErrChecksumMismatch,
 					manifest.SHA256Hash, calculatedSHA256)
 			} else {
 				log.Printf("SHA256 hash verified successfully: %s\n", calculatedSHA256)
@@ -230,7 +230,7 @@ func TryProcessChunkedArtifact(fs *smb2.Share, jobFileContent []byte, jobFilePat
 	// Собираем файл из фрагментов
 	mergedFilePath, err := LoadChunkedFile(fs, manifestPath, jobFilePath)
 	if err != nil {
-		return true, "", fmt.Errorf("failed to load chunked file: %v", err)
+		return true, "", fmt.Errorf("failed to load chunked file: %w", err)
 	}
 
 	return true, mergedFilePath, nil
@@ -0,0 +1,193 @@
+package deploy
+
+import (
+	"archive/tar"
+	"compress/bzip2"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"fts-cd-file-utility/common"
+	"github.com/hirochachacha/go-smb2"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// smbUploadCondaPackage загружает conda пакет с шары в raw-hosted репозиторий, который служит каналом conda:
+// файл кладётся в <subdir>/, а его запись добавляется в <subdir>/repodata.json. Возвращает url пакета
+func smbUploadCondaPackage(condaFilePath string, jobStatus *common.JobStatus, fs *smb2.Share, checksum *checksumVerifier) (string, error) {
+	tempDir, err := os.MkdirTemp("", "conda_")
+	if err != nil {
+		log.Println("failed to create temp dir", err)
+		return "", err
+	}
+	defer os.RemoveAll(tempDir)
+
+	localFilePath, err := copyVerifiedPackage(condaFilePath, tempDir, fs, checksum)
+	if err != nil {
+		return "", err
+	}
+	fileName := filepath.Base(localFilePath)
+	subdir := jobStatus.Metadata[common.CondaMetaSubdir]
+	if subdir == "" || subdir == "." || subdir == "/" {
+		subdir = common.CondaNoarchSubdir
+	}
+	// запись готовится до загрузки файла, чтобы в канале не оказался пакет, которого нет в индексе
+	entry, err := buildCondaRepodataEntry(localFilePath, jobStatus.Metadata[common.CondaMetaRepodata])
+	if err != nil {
+		log.Printf("failed to build repodata.json entry of %s: %v\n", fileName, err)
+		return "", err
+	}
+
+	channelUrl := buildNexusRepoName(common.StartupConfig.ReceiveNexusCondaRepository)
+	location := channelUrl + subdir + "/" + escapeUrlPath(fileName)
+	if err := putNexusFile(location, localFilePath); err != nil {
+		return "", err
+	}
+	if err := updateCondaRepodata(channelUrl, subdir, fileName, entry, tempDir); err != nil {
+		log.Printf("failed to update %s/repodata.json: %v\n", subdir, err)
+		return "", err
+	}
+	// conda требует наличия noarch в канале, даже если все пакеты платформенные
+	if subdir != common.CondaNoarchSubdir {
+		if err := updateCondaRepodata(channelUrl, common.CondaNoarchSubdir, "", nil, tempDir); err != nil {
+			log.Printf("failed to create %s/repodata.json: %v\n", common.CondaNoarchSubdir, err)
+			return "", err
+		}
+	}
+	log.Printf("conda package %s uploaded successfully to %s\n", fileName, location)
+	return location, nil
+}
+
+// buildCondaRepodataEntry возвращает запись пакета для repodata.json: из исходного канала, а если её нет -
+// из info/index.json внутри .tar.bz2. Размер и хеш-суммы всегда считаются по загружаемому файлу
+func buildCondaRepodataEntry(localFilePath, sourceEntry string) (map[string]interface{}, error) {
+	entry := map[string]interface{}{}
+	if sourceEntry != "" {
+		if err := json.Unmarshal([]byte(sourceEntry), &entry); err != nil {
+			return nil, err
+		}
+	} else {
+		if !strings.HasSuffix(localFilePath, ".tar.bz2") {
+			return nil, errors.New("repodata.json entry is missing in the job and can't be read from .conda package")
+		}
+		var err error
+		if entry, err = readCondaIndexJson(localFilePath); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.Open(localFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	sha256Hash, md5Hash := sha256.New(), md5.New()
+	size, err := io.Copy(io.MultiWriter(sha256Hash, md5Hash), file)
+	if err != nil {
+		return nil, err
+	}
+	entry["size"] = size
+	entry["sha256"] = fmt.Sprintf("%x", sha256Hash.Sum(nil))
+	entry["md5"] = fmt.Sprintf("%x", md5Hash.Sum(nil))
+	return entry, nil
+}
+
+// readCondaIndexJson читает метаданные info/index.json из пакета формата .tar.bz2
+func readCondaIndexJson(packageFilePath string) (map[string]interface{}, error) {
+	file, err := os.Open(packageFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	tarReader := tar.NewReader(bzip2.NewReader(file))
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("info/index.json not found in %s", filepath.Base(packageFilePath))
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimPrefix(header.Name, "./") != "info/index.json" {
+			continue
+		}
+		index := map[string]interface{}{}
+		if err := json.NewDecoder(tarReader).Decode(&index); err != nil {
+			return nil, err
+		}
+		return index, nil
+	}
+}
+
+// updateCondaRepodata добавляет запись пакета в <subdir>/repodata.json канала, создавая файл при необходимости.
+// Без fileName только создаёт пустой repodata.json, если его ещё нет
+func updateCondaRepodata(channelUrl, subdir, fileName string, entry map[string]interface{}, tempDir string) error {
+	repodataUrl := channelUrl + subdir + "/repodata.json"
+	repodata, err := getCondaRepodata(repodataUrl)
+	if err != nil {
+		return err
+	}
+	if repodata == nil {
+		repodata = &common.CondaRepodata{Info: map[string]interface{}{"subdir": subdir}, RepodataVersion: 1}
+	} else if fileName == "" {
+		return nil
+	}
+	if repodata.Packages == nil {
+		repodata.Packages = map[string]json.RawMessage{}
+	}
+	if repodata.PackagesConda == nil {
+		repodata.PackagesConda = map[string]json.RawMessage{}
+	}
+	if fileName != "" {
+		content, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(fileName, ".conda") {
+			repodata.PackagesConda[fileName] = content
+		} else {
+			repodata.Packages[fileName] = content
+		}
+	}
+
+	content, err := json.Marshal(repodata)
+	if err != nil {
+		return err
+	}
+	repodataFilePath := filepath.Join(tempDir, subdir+"-repodata.json")
+	if err := os.WriteFile(repodataFilePath, content, 0644); err != nil {
+		return err
+	}
+	return putNexusFile(repodataUrl, repodataFilePath)
+}
+
+// getCondaRepodata скачивает repodata.json канала RECEIVE, nil - файла ещё нет
+func getCondaRepodata(repodataUrl string) (*common.CondaRepodata, error) {
+	req, err := http.NewRequest(http.MethodGet, repodataUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(common.StartupConfig.ReceiveNexusLogin, common.StartupConfig.ReceiveNexusPassword)
+	resp, err := common.HttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &common.HttpStatusError{Url: repodataUrl, StatusCode: resp.StatusCode}
+	}
+	var repodata common.CondaRepodata
+	if err := json.NewDecoder(resp.Body).Decode(&repodata); err != nil {
+		return nil, err
+	}
+	return &repodata, nil
+}
@@ -0,0 +1,90 @@
+package deploy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"fts-cd-file-utility/common"
+	"github.com/hirochachacha/go-smb2"
+	"hash"
+	"io"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// checksumVerifier считает sha256 артефакта при его чтении с шары
+// и сравнивает с хеш-суммой, посчитанной SEND
+type checksumVerifier struct {
+	expected string
+	hash     hash.Hash
+}
+
+func newChecksumVerifier(jobStatus *common.JobStatus) *checksumVerifier {
+	return &checksumVerifier{expected: jobStatus.SHA256Hash, hash: sha256.New()}
+}
+
+// Wrap возвращает reader, данные которого учитываются в хеш-сумме
+func (v *checksumVerifier) Wrap(r io.Reader) io.Reader {
+	return io.TeeReader(r, v.hash)
+}
+
+// Verify сверяет хеш-суммы. Если SEND не передал хеш-сумму, проверка пропускается
+func (v *checksumVerifier) Verify() error {
+	if v.expected == "" {
+		return nil
+	}
+	if actual := hex.EncodeToString(v.hash.Sum(nil)); actual != v.expected {
+		return fmt.Errorf("%w: expected %s, got %s", common.ErrChecksumMismatch, v.expected, actual)
+	}
+	return nil
+}
+
+// newDeployAck формирует подтверждение загрузки по результату publish
+func newDeployAck(jobId string, jobStatus *common.JobStatus, location, digest string, err error) common.DeployAck {
+	ack := common.DeployAck{
+		JobId:            jobId,
+		Result:           common.DEPLOYED,
+		Location:         location,
+		Digest:           digest,
+		Checksum:         jobStatus.SHA256Hash,
+		ChecksumVerified: jobStatus.SHA256Hash != "" && err == nil,
+		Attempts:         jobStatus.Attempts,
+		Dttm:             time.Now(),
+	}
+	if err != nil {
+		ack.Result = common.DEPLOY_FAILED
+		ack.ErrorCode = common.GetErrorCode(err)
+		ack.ErrorMessage = err.Error()
+	}
+	return ack
+}
+
+// writeDeployAck кладёт на шару <jobId>.ack. Файл пишется до удаления .job файла,
+// поэтому SEND, не найдя .job файл, всегда найдёт и подтверждение
+func writeDeployAck(fs *smb2.Share, ack common.DeployAck) error {
+	ackFilePath := filepath.Join(common.StartupConfig.SmbSharePath, common.GetJobAckFileName(ack.JobId))
+	content, err := json.Marshal(ack)
+	if err != nil {
+		log.Printf("failed to serialize deploy ack %+v with error %v\n", ack, err)
+		return err
+	}
+	if err := fs.WriteFile(ackFilePath, content, 0644); err != nil {
+		log.Println("failed to write deploy ack", ackFilePath, err)
+		return err
+	}
+	log.Printf("Job - %s: deploy ack %s written\n", ack.JobId, ack.Result)
+	return nil
+}
+
+// dropFailedJob подтверждает неудачную загрузку и убирает задание с шары: DEPLOY_FAILED окончательный статус,
+// RECEIVE не повторяет такое задание при следующих опросах. Если подтверждение не записано, задание остаётся на шаре,
+// иначе SEND так и не узнает результат загрузки
+func dropFailedJob(fs *smb2.Share, jobId string, jobStatus *common.JobStatus, err error) {
+	if writeDeployAck(fs, newDeployAck(jobId, jobStatus, "", "", err)) != nil {
+		return
+	}
+	log.Printf("Job - %s: failed, removing it from share\n", jobId)
+	removeJobFromShare(fs, jobId, jobStatus)
+}
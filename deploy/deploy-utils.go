@@ -4,12 +4,15 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"fts-cd-file-utility/cfg"
 	"fts-cd-file-utility/common"
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/hirochachacha/go-smb2"
 	"github.com/labstack/echo/v4"
 	"io"
@@ -20,6 +23,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -129,65 +134,22 @@ func LoadArtifactsFs(ctx context.Context) {
 }
 
 func loadFromSmb(ctx context.Context, u url.URL) {
-	conn, err := net.Dial("tcp", u.Host)
+	conn, err := dialSmbShare(u)
 	if err != nil {
-		log.Printf("failed to dial nfs %s. Error was %v", u.Host, err)
 		return
 	}
 	defer conn.Close()
 
-	password, passwordSet := u.User.Password()
-	userAndDomain := strings.Split(u.User.Username(), "@")
-	if len(userAndDomain) != 2 {
-		// log.Println()
-		panic(fmt.Sprintf("domain must be set. But username was %s", u.User.Username()))
-	}
-	user := userAndDomain[0]
-	domain := userAndDomain[1]
-
-	var initiator smb2.NTLMInitiator
-	if passwordSet {
-		initiator = smb2.NTLMInitiator{
-			User:     user,
-			Password: password,
-			Domain:   domain,
-		}
-	} else {
-		initiator = smb2.NTLMInitiator{
-			User:   user,
-			Domain: domain,
-		}
-	}
-
-	d := &smb2.Dialer{
-		Initiator: &initiator,
-	}
-
-	s, err := d.Dial(conn)
-	if err != nil {
-		log.Printf("failed to dial smb %s. Error was %v", u.Host, err)
-		return
-	}
-	defer s.Logoff()
-
-	shareName := buildShareName(u)
-	// log.Println("mounting share", shareName)
-	//fs, err := s.Mount("\\\\sgo-fc01-r13.go.rshbank.ru\\intech")
-	fs, err := s.Mount(shareName)
-	if err != nil {
-		log.Printf("failed to mount %s. Error was %v", shareName, err)
-		return
-	}
-	defer fs.Umount()
-
 	// files, err := os.ReadDir(common.StartupConfig.NFSPath)
 	// log.Println("")
-	files, err := fs.ReadDir(common.StartupConfig.SmbSharePath)
+	files, err := conn.Share.ReadDir(common.StartupConfig.SmbSharePath)
 	if err != nil {
 		log.Println("failed to read dir", common.StartupConfig.SmbSharePath, err)
 		return
 	}
 	for _, f := range files {
+		// подключение могло быть восстановлено при повторах предыдущего задания
+		fs := conn.Share
 		if !f.IsDir() && strings.HasSuffix(f.Name(), ".job") {
 			jobId := strings.Split(f.Name(), ".job")[0]
 			log.Println("found jobFile", f.Name(), "with jobId =", jobId)
@@ -199,17 +161,26 @@ func loadFromSmb(ctx context.Context, u url.URL) {
 			}
 			//jobFile, err := os.ReadFile(jobFilePath)
 			jobFileContent, err := io.ReadAll(jobFile)
+			jobFile.Close()
 			if err != nil {
 				log.Println("failed to read job file", jobFilePath)
 				continue
 			}
 			var basicJobStatus = new(common.JobStatus)
 			err = json.Unmarshal(jobFileContent, &basicJobStatus)
-			
+
+			if isJobCancelled(fs, jobId) {
+				dropCancelledJob(fs, jobId, basicJobStatus)
+				continue
+			}
 			// Проверяем, является ли артефакт фрагментированным
 			isChunked, mergedFilePath, err := TryProcessChunkedArtifact(fs, jobFileContent, jobFilePath)
 			if err != nil {
 				log.Printf("Error processing chunked artifact: %v\n", err)
+				// при сетевой ошибке фрагменты будут собраны при следующем опросе шары
+				if !common.IsRetryable(err) {
+					dropFailedJob(fs, jobId, basicJobStatus, err)
+				}
 				continue
 			}
 			
@@ -232,83 +203,44 @@ func loadFromSmb(ctx context.Context, u url.URL) {
 				}
 			}
 
-			// if IsDockerArtifact(jobFileContent) {
-			if basicJobStatus.ArtifactType == common.DOCKER {
-				log.Println("docker artifact upload job found", jobFile)
-				if !common.StartupConfig.ReceiveDockerEnabled {
-					log.Println("docker artifact won't be processed since property `receive_docker_enabled` set to false")
-					continue
-				}
-				var dockerArtifact common.DockerArtifact
-				var dockerJobStatus = common.JobStatus{Artifact: &dockerArtifact}
-				err = json.Unmarshal(jobFileContent, &dockerJobStatus)
-				if err != nil {
-					log.Println("failed to read json from file", jobFilePath)
-					continue
-				}
-				log.Printf("JobStatus = %+v\n", dockerJobStatus)
-				log.Printf("dockerArtifact = %+v\n", dockerArtifact)
-
-				imageFileName := filepath.Join(common.StartupConfig.SmbSharePath, dockerJobStatus.ArtifactPath)
-				err = smbLoadImage(imageFileName, dockerArtifact, fs)
-				if err != nil {
-					log.Print("failed to load image", imageFileName, err)
-					continue
-				}
-				cleanUp(imageFileName, jobFilePath, fs)
-				log.Println("image", dockerArtifact.ImageName, "is successfully loaded!")
-				// } else if IsPypiArtifact(jobFileContent) {
-			} else if basicJobStatus.ArtifactType == common.HF {
-			    log.Println("hf artifact upload job found", jobFile)
-			    if !common.StartupConfig.ReceiveHfEnabled {
-					log.Println("huggingface artifact won't be processed since property `receive_hf_enabled` set to false")
-					continue
-				}
-				var hfArtifact common.HfArtifact
-				var hfJobStatus = common.JobStatus{Artifact: &hfArtifact}
-				err = json.Unmarshal(jobFileContent, &hfJobStatus)
-				if err != nil {
-					log.Println("failed to read json from file", jobFilePath)
-					continue
-				}
-				log.Printf("JobStatus = %+v\n", hfJobStatus)
-				log.Printf("hfArtifact = %+v\n", hfArtifact)
-
-				hfFileName := filepath.Join(common.StartupConfig.SmbSharePath, hfJobStatus.ArtifactPath)
-				err = smbUploadHfModel(hfFileName, hfJobStatus.ArtifactPath, hfArtifact, fs)
-				if err != nil {
-					log.Printf("failed to load huggingface model %s. Err: %v\n", hfFileName, err)
-					continue
-				}
-				cleanUp(hfFileName, jobFilePath, fs)
-				log.Println("model", hfArtifact.ModelName, "is successfully loaded!")
-			} else if basicJobStatus.ArtifactType == common.PYPI {
-				log.Println("pypi artifact upload job found", jobFile)
-				if !common.StartupConfig.ReceivePypiEnabled {
-					log.Println("pypi artifact won't be processed since property `receive_pypi_enabled` set to false")
-					continue
-				}
-				var pypiArtifact common.PypiArtifact
-				var pypiJobStatus = common.JobStatus{Artifact: &pypiArtifact}
-				err = json.Unmarshal(jobFileContent, &pypiJobStatus)
-				if err != nil {
-					log.Println("failed to read json from file", jobFilePath)
-					continue
-				}
-				log.Printf("JobStatus = %+v\n", pypiJobStatus)
-				log.Printf("pypiArtifact = %+v\n", pypiArtifact)
-
-				pypiFileName := filepath.Join(common.StartupConfig.SmbSharePath, pypiJobStatus.ArtifactPath)
-				err = smbUploadPypiPackage(pypiFileName, pypiJobStatus.ArtifactPath, pypiArtifact, fs)
-				if err != nil {
-					log.Printf("failed to load pypi package %s. Err: %v\n", pypiFileName, err)
-					continue
-				}
-				cleanUp(pypiFileName, jobFilePath, fs)
-				log.Println("package", pypiArtifact.PackageName, "is successfully loaded!")
-			} else {
+			definition, found := common.GetArtifactTypeDefinition(basicJobStatus.ArtifactType)
+			if !found || definition.Publisher == nil {
+				log.Printf("unknown artifact type '%s' in job file %s\n", basicJobStatus.ArtifactType, jobFilePath)
+				continue
+			}
+			publisher := definition.Publisher
+			log.Println(publisher.Description, "upload job found", jobFilePath)
+			if !publisher.Enabled() {
+				log.Printf("%s won't be processed since property `%s` set to false\n", publisher.Description, publisher.Toggle)
+				continue
+			}
+			jobStatus, err := common.UnmarshalJobStatus(jobFileContent)
+			if err != nil {
+				log.Println("failed to read json from file", jobFilePath)
 				continue
 			}
+			log.Printf("JobStatus = %+v\n", jobStatus)
+
+			artifactFileName := filepath.Join(common.StartupConfig.SmbSharePath, jobStatus.ArtifactPath)
+			var location, digest string
+			err = publishWithRetry(ctx, conn, jobId, jobFilePath, &jobStatus, func(fs *smb2.Share) error {
+				var err error
+				location, digest, err = publisher.Publish(fs, artifactFileName, &jobStatus)
+				return err
+			})
+			if conn.Share == nil {
+				// без подключения к шаре остальные задания тоже не обработать, они будут взяты в следующем проходе
+				log.Printf("Job - %s: connection to share is lost, stopping until next scan. Err: %v\n", jobId, err)
+				return
+			}
+			if err != nil {
+				log.Printf("failed to load %s %s. Err: %v\n", publisher.Description, artifactFileName, err)
+				dropFailedJob(conn.Share, jobId, &jobStatus, err)
+				continue
+			}
+			writeDeployAck(conn.Share, newDeployAck(jobId, &jobStatus, location, digest, nil))
+			cleanUp(artifactFileName, jobFilePath, conn.Share)
+			log.Println(publisher.Description, jobStatus.Artifact.GetOriginalResourceName(), "is successfully loaded!")
 			log.Println(jobId, "is successfully finished!")
 		}
 	}
@@ -327,27 +259,6 @@ func cleanUp(artifactFileName, jobFilePath string, fs *smb2.Share) {
 	}
 }
 
-func IsDockerArtifact(jobFileContent []byte) bool {
-	var dockerArtifact common.DockerArtifact
-	var dockerJobStatus = common.JobStatus{Artifact: &dockerArtifact}
-	err := json.Unmarshal(jobFileContent, &dockerJobStatus)
-	return err == nil && dockerArtifact.ImageName != ""
-}
-
-func IsPypiArtifact(jobFileContent []byte) bool {
-	var pypiArtifact common.PypiArtifact
-	var pypiJobStatus = common.JobStatus{Artifact: &pypiArtifact}
-	err := json.Unmarshal(jobFileContent, &pypiJobStatus)
-	return err == nil && pypiArtifact.PackageName != ""
-}
-
-func IsHfArtifact(jobFileContent []byte) bool {
-	var hfArtifact common.HfArtifact
-	var hfJobStatus = common.JobStatus{Artifact: &hfArtifact}
-	err := json.Unmarshal(jobFileContent, &hfJobStatus)
-	return err == nil && hfArtifact.ModelName != ""
-}
-
 func buildShareName(u url.URL) string {
 	host, _, _ := net.SplitHostPort(u.Host)
 	share := strings.ReplaceAll(u.Path, "/", "")
@@ -436,111 +347,108 @@ func loadImage(imageFileName string, artifact common.DockerArtifact) error {
 	return nil
 }
 
-func smbUploadPypiPackage(pypiFilePath, artifactFileName string, artifact common.PypiArtifact, fs *smb2.Share) error {
+func smbUploadPypiPackage(pypiFilePath, artifactFileName string, artifact common.PypiArtifact, fs *smb2.Share, checksum *checksumVerifier) error {
 	pypiFromFile, err := fs.OpenFile(pypiFilePath, os.O_RDONLY, 0644)
 	if err != nil {
 		log.Println("failed to open image", pypiFilePath, err)
 		return err
 	}
+	defer pypiFromFile.Close()
 
 	pypiTgtFile, err := os.Create(artifactFileName)
 	if err != nil {
 		log.Println("failed to create tgtFile")
 		return err
 	}
-	_, err = io.Copy(pypiTgtFile, pypiFromFile)
+	_, err = io.Copy(pypiTgtFile, checksum.Wrap(pypiFromFile))
+	pypiTgtFile.Close()
 	if err != nil {
-		log.Println("failed to copy file %s to %s. Error: %v", pypiFilePath, pypiTgtFile.Name(), err)
+		log.Printf("failed to copy file %s to %s. Error: %v\n", pypiFilePath, pypiTgtFile.Name(), err)
+		return err
+	}
+	if err := checksum.Verify(); err != nil {
+		log.Printf("package %s is corrupted: %v\n", pypiFilePath, err)
 		return err
 	}
+	return twineUpload(artifactFileName)
+}
+
+// twineUpload загружает файлы python пакетов в pypi репозиторий RECEIVE
+func twineUpload(fileNames ...string) error {
 	// twine upload --repository-url http://10.7.86.10:8081/repository/pypi-hosted/ -u USER -p PASSWORD Hello_World_Package-0.1.3-py2.py3-none-any.whl
-	cmd := exec.Command("twine", "upload",
+	args := []string{"upload",
 		"--repository-url", buildNexusPypiRepoName(),
 		"-u", common.StartupConfig.ReceiveNexusLogin,
-		"-p", common.StartupConfig.ReceiveNexusPassword,
-		artifactFileName)
+		"-p", common.StartupConfig.ReceiveNexusPassword}
+	cmd := exec.Command("twine", append(args, fileNames...)...)
 
 	var out strings.Builder
 	cmd.Stdout = &out
 	cmd.Stderr = &out
-	err = cmd.Run()
+	err := cmd.Run()
 	cmdOutput := out.String()
 	log.Println("----------- `twine upload` OUTPUT START -----------")
 	log.Println("\n", cmdOutput)
 	log.Println("----------- `twine upload` OUTPUT END   -----------")
+	if err != nil {
+		return twineUploadError(cmdOutput, err)
+	}
 
 	return nil
 }
 
-func smbUploadHfModel(hfFilePath, artifactFileName string, artifact common.HfArtifact, fs *smb2.Share) error {
+var twineHttpErrorRegex = regexp.MustCompile(`HTTPError: (\d{3})`)
+
+// twineUploadError определяет по выводу twine, можно ли повторить загрузку
+func twineUploadError(cmdOutput string, err error) error {
+	if matches := twineHttpErrorRegex.FindStringSubmatch(cmdOutput); len(matches) == 2 {
+		statusCode, _ := strconv.Atoi(matches[1])
+		return fmt.Errorf("twine upload failed: %w", &common.HttpStatusError{Url: buildNexusPypiRepoName(), StatusCode: statusCode})
+	}
+	if strings.Contains(cmdOutput, "ConnectionError") || strings.Contains(cmdOutput, "Max retries exceeded") {
+		return common.Transient(fmt.Errorf("twine upload failed: %w", err))
+	}
+	return fmt.Errorf("twine upload failed: %w", err)
+}
+
+// smbUploadHfModel загружает модель с шары в Nexus и возвращает url загруженного ассета
+func smbUploadHfModel(hfFilePath, artifactFileName string, artifact common.HfArtifact, fs *smb2.Share, checksum *checksumVerifier) (string, error) {
+	if strings.HasSuffix(artifactFileName, common.HfBundleSuffix) {
+		return smbUploadHfBundle(hfFilePath, artifact, fs, checksum)
+	}
 	hfFromFile, err := fs.OpenFile(hfFilePath, os.O_RDONLY, 0644)
 	if err != nil {
 		log.Println("failed to open file", hfFilePath, err)
-		return err
+		return "", err
 	}
 	defer hfFromFile.Close()
 
 	hfTgtFile, err := os.Create(artifactFileName)
 	if err != nil {
 		log.Println("failed to create target file", artifactFileName, err)
-		return err
+		return "", err
 	}
 	defer hfTgtFile.Close()
 
-	_, err = io.Copy(hfTgtFile, hfFromFile)
+	_, err = io.Copy(hfTgtFile, checksum.Wrap(hfFromFile))
 	if err != nil {
 		log.Println("failed to copy file from", hfFilePath, "to", artifactFileName, err)
-		return err
+		return "", err
+	}
+	if err := checksum.Verify(); err != nil {
+		log.Printf("model %s is corrupted: %v\n", hfFilePath, err)
+		return "", err
 	}
 
 	nexusURL := buildNexusHfRepoName()
 	uploadURL := fmt.Sprintf("%s%s/%s", nexusURL, artifact.ModelName, filepath.Base(artifactFileName))
 
-	uploadFile, err := os.Open(artifactFileName)
-	if err != nil {
-		log.Println("failed to open file for upload", artifactFileName, err)
-		return err
-	}
-	defer uploadFile.Close()
-
-	info, err := uploadFile.Stat()
-	if err != nil {
-		log.Println("failed to get file info", artifactFileName, err)
-		return err
-	}
-	fileSize := info.Size()
-
-	req, err := http.NewRequest(http.MethodPut, uploadURL, uploadFile)
-	if err != nil {
-		log.Println("failed to create request", err)
-		return err
-	}
-
-	req.ContentLength = fileSize
-
-	req.SetBasicAuth(common.StartupConfig.ReceiveNexusLogin, common.StartupConfig.ReceiveNexusPassword)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Println("upload request failed", err)
-		return err
-	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Println("failed to read response", err)
-		return err
-	}
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		log.Printf("upload failed with status %d: %s\n", resp.StatusCode, string(respBody))
-		return fmt.Errorf("upload failed with status %d", resp.StatusCode)
+	if err := putNexusFile(uploadURL, artifactFileName); err != nil {
+		return "", err
 	}
 
 	log.Printf("File %s uploaded successfully to %s\n", artifactFileName, uploadURL)
-	return nil
+	return uploadURL, nil
 }
 
 func buildNexusPypiRepoName() string {
@@ -550,6 +458,11 @@ func buildNexusPypiRepoName() string {
 	return common.StartupConfig.ReceiveNexusUrl + "/repository/" + common.StartupConfig.ReceiveNexusPypiRepository + "/"
 }
 
+// buildNexusRepoName возвращает url репозитория в Nexus на стороне RECEIVE со слешем на конце
+func buildNexusRepoName(repository string) string {
+	return common.StartupConfig.ReceiveNexusUrl + "/repository/" + strings.TrimSuffix(repository, "/") + "/"
+}
+
 func buildNexusHfRepoName() string {
 	if strings.HasSuffix(common.StartupConfig.ReceiveNexusHfRepository, "/") {
 		return common.StartupConfig.ReceiveNexusUrl + "/repository/" + common.StartupConfig.ReceiveNexusHfRepository
@@ -557,25 +470,33 @@ func buildNexusHfRepoName() string {
 	return common.StartupConfig.ReceiveNexusUrl + "/repository/" + common.StartupConfig.ReceiveNexusHfRepository + "/"
 }
 
-func smbLoadImage(imageFileName string, artifact common.DockerArtifact, fs *smb2.Share) error {
+// smbLoadImage загружает образ с шары в docker, проверяя хеш-сумму, и пушит его в registry.
+// Возвращает digest запушенного образа
+func smbLoadImage(imageFileName string, artifact common.DockerArtifact, fs *smb2.Share, checksum *checksumVerifier) (string, error) {
 	apiClient, err := client.NewClientWithOpts(client.WithVersion(common.DockerApiVersion))
 	if err != nil {
 		log.Println("failed to open docker api client", err)
-		return err
+		return "", err
 	}
 	defer apiClient.Close()
 
 	log.Println("starting to load image", imageFileName)
+	if len(artifact.Platforms) > 0 {
+		// docker daemon загружает из архива только образ одной платформы, индекс в registry RECEIVE не переносится
+		log.Printf("image %s: platforms %v are ignored by docker daemon, only image of one platform is pushed and index digest is not preserved. Use receive_docker_transport = registry\n",
+			artifact.ImageName, artifact.Platforms)
+	}
 
 	//imageFileName := "/home/GO/raisa/image.docker"
 	imageFile, err := fs.OpenFile(imageFileName, os.O_RDONLY, 0644)
 	// imageFile, err := imageReader(imageFileName)
-	// defer imageFile.Close()
 	if err != nil {
 		log.Println("failed to open image", imageFileName, err)
-		return err
+		return "", err
 	}
-	load, err := apiClient.ImageLoad(context.Background(), imageFile, false)
+	defer imageFile.Close()
+	imageReader := checksum.Wrap(imageFile)
+	load, err := apiClient.ImageLoad(context.Background(), imageReader, false)
 	if err != nil {
 		body, errLoad := io.ReadAll(load.Body)
 		if errLoad != nil {
@@ -584,7 +505,7 @@ func smbLoadImage(imageFileName string, artifact common.DockerArtifact, fs *smb2
 			log.Println(string(body))
 		}
 		log.Println("failed to load image", imageFileName, err)
-		return err
+		return "", err
 	} else {
 		body, errLoad := io.ReadAll(load.Body)
 		if errLoad != nil {
@@ -594,14 +515,39 @@ func smbLoadImage(imageFileName string, artifact common.DockerArtifact, fs *smb2
 		}
 	}
 	defer load.Body.Close()
+	// docker мог прочитать не весь файл, дочитываем его для проверки хеш-суммы
+	if _, err := io.Copy(io.Discard, imageReader); err != nil {
+		log.Println("failed to read image", imageFileName, err)
+		return "", err
+	}
+	if err := checksum.Verify(); err != nil {
+		log.Printf("image %s is corrupted: %v\n", imageFileName, err)
+		return "", err
+	}
+
+	receiveTag, digest, err := tagAndPushImage(apiClient, artifact)
+	if err != nil {
+		return "", err
+	}
+
+	err = artifact.DeployCleanup()
+	if err != nil {
+		log.Printf("failed to remove image %s. Error: %v\n", receiveTag, err)
+	}
+	return digest, nil
+}
 
+
+// tagAndPushImage тегирует загруженный в docker образ под registry RECEIVE и пушит его.
+// Возвращает тег и digest запушенного образа
+func tagAndPushImage(apiClient *client.Client, artifact common.DockerArtifact) (string, string, error) {
 	receiveTag := common.BuildTargetImageName(common.StartupConfig.ReceiveDockerRegistry, artifact.ImageName)
 	sendImage := common.BuildTargetImageName(common.StartupConfig.SendDockerRegistry, artifact.ImageName)
 	log.Println("starting to tag image", sendImage, "with tag", receiveTag)
-	err = apiClient.ImageTag(context.Background(), sendImage, receiveTag)
+	err := apiClient.ImageTag(context.Background(), sendImage, receiveTag)
 	if err != nil {
 		log.Printf("failed to tag image artifact %s with tag %s. error: %v\n", sendImage, receiveTag, err)
-		return err
+		return "", "", err
 	}
 	log.Println("starting to push image", receiveTag)
 
@@ -609,69 +555,161 @@ func smbLoadImage(imageFileName string, artifact common.DockerArtifact, fs *smb2
 	authConfigBytes, err := json.Marshal(authConfig)
 	if err != nil {
 		log.Printf("failed to marshal auth config for push options. error: %v\n", err)
-		return err
+		return "", "", err
 	}
 	authConfigEncoded := base64.URLEncoding.EncodeToString(authConfigBytes)
 	progressReader, err := apiClient.ImagePush(context.Background(), receiveTag, image.PushOptions{RegistryAuth: authConfigEncoded})
+	if err != nil {
+		log.Printf("failed to push image %s. error: %v\n", receiveTag, err)
+		return "", "", err
+	}
 	defer progressReader.Close()
-	io.Copy(os.Stdout, progressReader)
+	digest, err := readPushResult(progressReader)
 	if err != nil {
 		log.Printf("failed to push image %s. error: %v\n", receiveTag, err)
-		return err
+		return "", "", err
 	}
+	return receiveTag, digest, nil
+}
 
-	err = artifact.DeployCleanup()
+// readPushResult выводит ход push и возвращает digest образа.
+// Ошибки registry приходят в потоке, а не в ошибке ImagePush
+func readPushResult(progressReader io.Reader) (string, error) {
+	var digest string
+	err := jsonmessage.DisplayJSONMessagesStream(progressReader, os.Stdout, 0, false, func(msg jsonmessage.JSONMessage) {
+		var pushResult types.PushResult
+		if msg.Aux != nil && json.Unmarshal(*msg.Aux, &pushResult) == nil && pushResult.Digest != "" {
+			digest = pushResult.Digest
+		}
+	})
+	return digest, err
+}
+
+// openSmbShare подключается к шаре из NFSPath. Возвращаемую функцию нужно вызвать для отключения
+func openSmbShare(u url.URL) (*smb2.Share, func(), error) {
+	password, passwordSet := u.User.Password()
+	userAndDomain := strings.Split(u.User.Username(), "@")
+	if len(userAndDomain) != 2 {
+		err := fmt.Errorf("domain must be set. But username was %s", u.User.Username())
+		log.Println("failed to connect to smb share", err)
+		return nil, nil, err
+	}
+
+	conn, err := net.Dial("tcp", u.Host)
 	if err != nil {
-		log.Printf("failed to remove image %s. Error: %v\n", receiveTag, err)
+		log.Printf("failed to dial nfs %s. Error was %v", u.Host, err)
+		return nil, nil, err
 	}
-	return nil
+	user := userAndDomain[0]
+	domain := userAndDomain[1]
+
+	var initiator smb2.NTLMInitiator
+	if passwordSet {
+		initiator = smb2.NTLMInitiator{
+			User:     user,
+			Password: password,
+			Domain:   domain,
+		}
+	} else {
+		initiator = smb2.NTLMInitiator{
+			User:   user,
+			Domain: domain,
+		}
+	}
+
+	d := &smb2.Dialer{
+		Initiator: &initiator,
+	}
+
+	s, err := d.Dial(conn)
+	if err != nil {
+		conn.Close()
+		log.Printf("failed to dial smb %s. Error was %v", u.Host, err)
+		return nil, nil, err
+	}
+
+	shareName := buildShareName(u)
+	fs, err := s.Mount(shareName)
+	if err != nil {
+		s.Logoff()
+		conn.Close()
+		log.Printf("failed to mount %s. Error was %v", shareName, err)
+		return nil, nil, err
+	}
+	return fs, func() {
+		fs.Umount()
+		s.Logoff()
+		conn.Close()
+	}, nil
 }
 
+// smbConnection - подключение к шаре, которое можно восстановить после обрыва
+type smbConnection struct {
+	u     url.URL
+	Share *smb2.Share
+	close func()
+}
 
-func connectToSmb2(sharePath url.URL) (*net.Conn, error) {
-    //Implementation for connecting to SMB share.  Replace with actual logic.
-    conn, err := net.Dial("tcp", sharePath.Host)
-    return &conn, err
+func dialSmbShare(u url.URL) (*smbConnection, error) {
+	fs, closeShare, err := openSmbShare(u)
+	if err != nil {
+		return nil, err
+	}
+	return &smbConnection{u: u, Share: fs, close: closeShare}, nil
 }
 
-func mountSmbShare(conn *net.Conn, sharePath url.URL) (*smb2.Share, error) {
-    //Implementation for mounting SMB share. Replace with actual logic.  Uses smb2 package.
-    password, passwordSet := sharePath.User.Password()
-    userAndDomain := strings.Split(sharePath.User.Username(), "@")
-    if len(userAndDomain) != 2 {
-        panic(fmt.Sprintf("domain must be set. But username was %s", sharePath.User.Username()))
-    }
-    user := userAndDomain[0]
-    domain := userAndDomain[1]
-
-    var initiator smb2.NTLMInitiator
-    if passwordSet {
-        initiator = smb2.NTLMInitiator{
-            User:     user,
-            Password: password,
-            Domain:   domain,
-        }
-    } else {
-        initiator = smb2.NTLMInitiator{
-            User:   user,
-            Domain: domain,
-        }
-    }
-
-    d := &smb2.Dialer{
-        Initiator: &initiator,
-    }
-
-    s, err := d.Dial(*conn)
-    if err != nil {
-        return nil, err
-    }
-    shareName := buildShareName(sharePath)
-    fs, err := s.Mount(shareName)
-    return fs, err
+// Reconnect переподключается к шаре. Если подключиться не удалось, Share становится nil
+func (c *smbConnection) Reconnect() error {
+	c.close()
+	c.close = func() {}
+	fs, closeShare, err := openSmbShare(c.u)
+	if err != nil {
+		c.Share = nil
+		return err
+	}
+	c.Share, c.close = fs, closeShare
+	return nil
+}
+
+func (c *smbConnection) Close() {
+	c.close()
+}
 
+// publishWithRetry загружает артефакт в целевой репозиторий, повторяя загрузку при временных ошибках.
+// Номер попытки и последняя ошибка сохраняются в .job файле, после обрыва соединения с шарой оно восстанавливается
+func publishWithRetry(ctx context.Context, conn *smbConnection, jobId, jobFilePath string, jobStatus *common.JobStatus, publish func(fs *smb2.Share) error) error {
+	return common.Retry(ctx, common.GetRetryPolicy(), "Job - "+jobId, func(attempt int) error {
+		if conn.Share == nil {
+			// предыдущее переподключение не удалось, пробуем ещё раз
+			if err := conn.Reconnect(); err != nil {
+				return err
+			}
+		}
+		return publish(conn.Share)
+	}, func(attempt int, err error) {
+		var smbErr *smb2.TransportError
+		if errors.As(err, &smbErr) {
+			log.Printf("Job - %s: reconnecting to share after %v\n", jobId, err)
+			if err := conn.Reconnect(); err != nil {
+				return
+			}
+		}
+		jobStatus.Attempts = attempt
+		jobStatus.LastError = err.Error()
+		writeJobFile(conn.Share, jobFilePath, jobStatus)
+	})
 }
 
+func writeJobFile(fs *smb2.Share, jobFilePath string, jobStatus *common.JobStatus) {
+	content, err := json.Marshal(jobStatus)
+	if err != nil {
+		log.Printf("failed to serialize jobStatus %+v with error %v\n", jobStatus, err)
+		return
+	}
+	if err := fs.WriteFile(jobFilePath, content, 0644); err != nil {
+		log.Println("failed to update job file", jobFilePath, err)
+	}
+}
 
 // TryProcessChunkedArtifact is implemented in chank-utils.go
 
@@ -778,7 +816,7 @@ func smbLoadPypiArtifact(pypiFileName string, artifact common.PypiArtifact, fs *
 
 	_, err = io.Copy(pypiTgtFile, pypiFromFile)
 	if err != nil {
-		log.Println("failed to copy file %s to %s. Error: %v", pypiFileName, pypiTgtFile.Name(), err)
+		log.Printf("failed to copy file %s to %s. Error: %v\n", pypiFileName, pypiTgtFile.Name(), err)
 		return err
 	}
 	defer pypiFromFile.Close()
@@ -0,0 +1,186 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fts-cd-file-utility/cfg"
+	"fts-cd-file-utility/common"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dockerBlobInventory - блобы registry RECEIVE, которые выкладываются на шару для SEND (receive_docker_inventory_enabled).
+// Полностью обновляется обходом registry раз в receive_docker_inventory_period, между обходами дополняется запушенными блобами
+var dockerBlobInventory = struct {
+	sync.Mutex
+	blobs map[string]string
+	// recorded - блобы, запушенные во время обхода registry, они не должны потеряться при замене blobs
+	recorded map[string]string
+	changed  bool
+}{blobs: map[string]string{}, recorded: map[string]string{}}
+
+// PublishDockerBlobInventory обновляет список блобов registry RECEIVE и выкладывает его на шару, пока работает приложение
+func PublishDockerBlobInventory(ctx context.Context, config *cfg.StartupConfig) {
+	u, err := url.Parse(config.NFSPath)
+	if err != nil || strings.ToLower(u.Scheme) != "smb" {
+		log.Printf("docker blob inventory won't be published since NFSPath %s is not smb url\n", config.NFSPath)
+		return
+	}
+	var lastScan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("stop publishing docker blob inventory since stopping application")
+			return
+		default:
+			if time.Since(lastScan) > config.GetDockerInventoryPeriod() {
+				if err := scanDockerBlobInventory(ctx); err != nil {
+					log.Println("failed to scan docker registry for blob inventory", err)
+				} else {
+					lastScan = time.Now()
+				}
+			}
+			writeDockerBlobInventory(*u)
+		}
+		time.Sleep(30 * time.Second)
+	}
+}
+
+// scanDockerBlobInventory обходит все теги всех репозиториев registry RECEIVE и собирает блобы их образов
+func scanDockerBlobInventory(ctx context.Context) error {
+	dockerBlobInventory.Lock()
+	dockerBlobInventory.recorded = map[string]string{}
+	dockerBlobInventory.Unlock()
+
+	client := common.NewRegistryClient(common.StartupConfig.ReceiveDockerRegistry, common.StartupConfig.ReceiveDockerRegistryLogin, common.StartupConfig.ReceiveDockerRegistryPassword, common.StartupConfig.ReceiveDockerRegistryInsecure)
+	repositories, err := client.Catalog(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("scanning %d repositories of docker registry %s for blob inventory\n", len(repositories), common.StartupConfig.ReceiveDockerRegistry)
+	blobs := map[string]string{}
+	for _, repository := range repositories {
+		tags, err := client.ListTags(ctx, repository)
+		if err != nil {
+			log.Printf("failed to list tags of repository %s: %v\n", repository, err)
+			continue
+		}
+		scanned := map[string]bool{}
+		for _, tag := range tags {
+			if err := scanImageBlobs(ctx, client, repository, tag, blobs, scanned); err != nil {
+				log.Printf("failed to scan image %s:%s: %v\n", repository, tag, err)
+			}
+		}
+	}
+
+	dockerBlobInventory.Lock()
+	defer dockerBlobInventory.Unlock()
+	for digest, repository := range dockerBlobInventory.recorded {
+		blobs[digest] = repository
+	}
+	dockerBlobInventory.blobs = blobs
+	dockerBlobInventory.changed = true
+	log.Printf("docker blob inventory contains %d blobs\n", len(blobs))
+	return nil
+}
+
+// scanImageBlobs добавляет в blobs слои образа, для индекса - слои образов всех платформ.
+// scanned - уже просмотренные манифесты репозитория, под разными тегами часто лежит один образ
+func scanImageBlobs(ctx context.Context, client *common.RegistryClient, repository, reference string, blobs map[string]string, scanned map[string]bool) error {
+	if scanned[reference] {
+		return nil
+	}
+	content, descriptor, err := client.GetManifest(ctx, repository, reference)
+	if err != nil {
+		return err
+	}
+	scanned[reference], scanned[descriptor.Digest] = true, true
+	var manifest common.OciManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return err
+	}
+	if common.IsImageIndex(descriptor.MediaType) {
+		for _, child := range manifest.Manifests {
+			if err := scanImageBlobs(ctx, client, repository, child.Digest, blobs, scanned); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, layer := range manifest.Layers {
+		if _, found := blobs[layer.Digest]; !found {
+			blobs[layer.Digest] = repository
+		}
+	}
+	return nil
+}
+
+// writeDockerBlobInventory выкладывает список блобов на шару, если он изменился
+func writeDockerBlobInventory(u url.URL) {
+	dockerBlobInventory.Lock()
+	if !dockerBlobInventory.changed {
+		dockerBlobInventory.Unlock()
+		return
+	}
+	inventory := common.DockerBlobInventory{Registry: common.StartupConfig.ReceiveDockerRegistry, Dttm: time.Now(), Blobs: dockerBlobInventory.blobs}
+	content, err := json.Marshal(inventory)
+	dockerBlobInventory.changed = false
+	dockerBlobInventory.Unlock()
+	if err != nil {
+		log.Println("failed to serialize docker blob inventory", err)
+		return
+	}
+
+	fs, closeShare, err := openSmbShare(u)
+	if err != nil {
+		markDockerBlobInventoryChanged()
+		return
+	}
+	defer closeShare()
+	inventoryFilePath := filepath.Join(common.StartupConfig.SmbSharePath, common.DockerBlobInventoryFileName)
+	if err := fs.WriteFile(inventoryFilePath, content, 0644); err != nil {
+		log.Println("failed to write docker blob inventory", inventoryFilePath, err)
+		markDockerBlobInventoryChanged()
+		return
+	}
+	log.Printf("docker blob inventory with %d blobs written\n", len(inventory.Blobs))
+}
+
+func markDockerBlobInventoryChanged() {
+	dockerBlobInventory.Lock()
+	dockerBlobInventory.changed = true
+	dockerBlobInventory.Unlock()
+}
+
+// recordDockerBlobs добавляет в список блобы запушенного образа
+func recordDockerBlobs(repository string, digests []string) {
+	if !common.StartupConfig.ReceiveDockerInventoryEnabled {
+		return
+	}
+	dockerBlobInventory.Lock()
+	defer dockerBlobInventory.Unlock()
+	for _, digest := range digests {
+		if _, found := dockerBlobInventory.blobs[digest]; !found {
+			dockerBlobInventory.blobs[digest] = repository
+			dockerBlobInventory.changed = true
+		}
+		dockerBlobInventory.recorded[digest] = repository
+	}
+}
+
+// forgetDockerBlob убирает из списка блоб, который не удалось подключить, например удалённый сборщиком мусора registry.
+// Со следующим списком SEND снова начнёт отправлять этот слой
+func forgetDockerBlob(digest string) {
+	dockerBlobInventory.Lock()
+	defer dockerBlobInventory.Unlock()
+	if _, found := dockerBlobInventory.blobs[digest]; !found {
+		return
+	}
+	delete(dockerBlobInventory.blobs, digest)
+	delete(dockerBlobInventory.recorded, digest)
+	dockerBlobInventory.changed = true
+}
@@ -0,0 +1,414 @@
+package deploy
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"fts-cd-file-utility/common"
+	"github.com/hirochachacha/go-smb2"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Загрузка образов в registry RECEIVE без docker daemon (receive_docker_transport = registry).
+// Архив образа - OCI image layout с index.json (его пишет SEND с send_docker_transport = registry и `docker save` начиная с Docker 25)
+// или архив `docker save` только с manifest.json, для которого манифест образа собирается заново.
+// Слоёв из external-blobs.json нет в архиве, они подключаются из других репозиториев registry RECEIVE
+
+// smbPushImageArchive распаковывает архив образа с шары и пушит его в registry RECEIVE. Возвращает digest образа
+func smbPushImageArchive(imageFileName string, artifact common.DockerArtifact, fs *smb2.Share, checksum *checksumVerifier) (string, error) {
+	imageFile, err := fs.OpenFile(imageFileName, os.O_RDONLY, 0644)
+	if err != nil {
+		log.Println("failed to open image", imageFileName, err)
+		return "", err
+	}
+	defer imageFile.Close()
+
+	tempDir, err := os.MkdirTemp("", "image_")
+	if err != nil {
+		log.Println("failed to create temp dir", err)
+		return "", err
+	}
+	defer os.RemoveAll(tempDir)
+
+	imageReader := checksum.Wrap(imageFile)
+	if err := extractImageArchive(imageReader, tempDir); err != nil {
+		log.Printf("failed to extract image %s: %v\n", imageFileName, err)
+		return "", err
+	}
+	if _, err := io.Copy(io.Discard, imageReader); err != nil {
+		log.Println("failed to read image", imageFileName, err)
+		return "", err
+	}
+	if err := checksum.Verify(); err != nil {
+		log.Printf("image %s is corrupted: %v\n", imageFileName, err)
+		return "", err
+	}
+	return pushImageArchive(context.Background(), tempDir, artifact.ImageName)
+}
+
+// pushImageArchiveFile пушит в registry RECEIVE образ из локального архива, например из бандла helm чарта
+func pushImageArchiveFile(imageFilePath string, imageName string) (string, error) {
+	imageFile, err := os.Open(imageFilePath)
+	if err != nil {
+		log.Println("failed to open image", imageFilePath, err)
+		return "", err
+	}
+	defer imageFile.Close()
+
+	tempDir, err := os.MkdirTemp("", "image_")
+	if err != nil {
+		log.Println("failed to create temp dir", err)
+		return "", err
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := extractImageArchive(imageFile, tempDir); err != nil {
+		log.Printf("failed to extract image %s: %v\n", imageFilePath, err)
+		return "", err
+	}
+	return pushImageArchive(context.Background(), tempDir, imageName)
+}
+
+// extractImageArchive распаковывает архив образа с сохранением путей. В отличие от extractTar,
+// пути важны: блобы лежат в blobs/sha256, а слои `docker save` - в каталогах и могут быть символическими ссылками.
+// Символические ссылки не создаются на диске: чтобы запись через ссылку не вышла за пределы dir,
+// файл, на который указывает ссылка внутри архива, подключается жёсткой ссылкой после распаковки
+func extractImageArchive(reader io.Reader, dir string) error {
+	var links [][2]string
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("image archive contains invalid path %s", header.Name)
+		}
+		path := filepath.Join(dir, name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			file, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(file, tarReader)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			linkname := filepath.FromSlash(header.Linkname)
+			target := filepath.Join(filepath.Dir(name), linkname)
+			if filepath.IsAbs(linkname) || !filepath.IsLocal(target) {
+				return fmt.Errorf("image archive contains link %s pointing outside of archive", header.Name)
+			}
+			links = append(links, [2]string{filepath.Join(dir, target), path})
+		}
+	}
+	for _, link := range links {
+		if err := os.MkdirAll(filepath.Dir(link[1]), 0755); err != nil {
+			return err
+		}
+		if err := os.Link(link[0], link[1]); err != nil {
+			return fmt.Errorf("failed to link %s in image archive: %w", link[1], err)
+		}
+	}
+	return nil
+}
+
+// imagePusher пушит манифесты и блобы распакованного архива в один репозиторий registry RECEIVE
+type imagePusher struct {
+	ctx    context.Context
+	dir    string
+	ref    common.ImageReference
+	client *common.RegistryClient
+	// external - слои, не записанные SEND в архив, так как они уже есть в registry RECEIVE
+	external map[string]common.ExternalBlob
+	// pushed - блобы, которые есть в репозитории после push
+	pushed []string
+}
+
+// pushImageArchive пушит распакованный архив образа в registry RECEIVE и возвращает digest образа.
+// Манифесты загружаются без изменений, поэтому digest совпадает с digest образа в registry SEND
+func pushImageArchive(ctx context.Context, dir string, imageName string) (string, error) {
+	ref := common.ParseImageReference(common.StartupConfig.ReceiveDockerRegistry, imageName)
+	pusher := &imagePusher{
+		ctx:    ctx,
+		dir:    dir,
+		ref:    ref,
+		client: common.NewRegistryClient(ref.Registry, common.StartupConfig.ReceiveDockerRegistryLogin, common.StartupConfig.ReceiveDockerRegistryPassword, common.StartupConfig.ReceiveDockerRegistryInsecure),
+	}
+	log.Println("starting to push image", ref.String(), "to registry")
+	if err := pusher.readExternalBlobs(); err != nil {
+		log.Printf("failed to read %s of image %s: %v\n", common.ExternalBlobsFileName, ref.String(), err)
+		return "", err
+	}
+
+	var root common.OciDescriptor
+	var err error
+	if _, statErr := os.Stat(filepath.Join(dir, common.OciIndexFileName)); statErr == nil {
+		root, err = pusher.readIndexRoot()
+	} else {
+		root, err = pusher.buildDockerArchiveManifest()
+	}
+	if err != nil {
+		log.Printf("failed to read image archive of %s: %v\n", ref.String(), err)
+		return "", err
+	}
+
+	reference := ref.Tag
+	if reference == "" {
+		reference = root.Digest
+	}
+	digest, err := pusher.push(root, reference)
+	if err != nil {
+		log.Printf("failed to push image %s. error: %v\n", ref.String(), err)
+		return "", err
+	}
+	if digest != root.Digest {
+		return "", fmt.Errorf("registry returned digest %s for image %s, expected %s: %w", digest, ref.String(), root.Digest, common.ErrChecksumMismatch)
+	}
+	log.Printf("image %s pushed with digest %s\n", ref.String(), digest)
+	recordDockerBlobs(ref.Repository, pusher.pushed)
+	return digest, nil
+}
+
+func (p *imagePusher) readExternalBlobs() error {
+	var external []common.ExternalBlob
+	if err := readJsonFile(filepath.Join(p.dir, common.ExternalBlobsFileName), &external); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	p.external = map[string]common.ExternalBlob{}
+	for _, blob := range external {
+		p.external[blob.Digest] = blob
+	}
+	return nil
+}
+
+// readIndexRoot возвращает манифест из index.json: помеченный тегом образа или единственный
+func (p *imagePusher) readIndexRoot() (common.OciDescriptor, error) {
+	var index common.OciManifest
+	if err := readJsonFile(filepath.Join(p.dir, common.OciIndexFileName), &index); err != nil {
+		return common.OciDescriptor{}, err
+	}
+	if len(index.Manifests) == 0 {
+		return common.OciDescriptor{}, fmt.Errorf("%s contains no manifests", common.OciIndexFileName)
+	}
+	root := index.Manifests[0]
+	for _, descriptor := range index.Manifests {
+		if p.ref.Tag != "" && descriptor.Annotations[common.OciRefNameAnnotation] == p.ref.Tag {
+			root = descriptor
+			break
+		}
+	}
+	if common.IsImageIndex(root.MediaType) {
+		return p.selectAvailableManifest(root)
+	}
+	return root, nil
+}
+
+// selectAvailableManifest проверяет, что в архиве есть все манифесты индекса. `docker save` сохраняет индекс целиком,
+// но манифесты только скачанных платформ - в этом случае пушится манифест образа без индекса
+func (p *imagePusher) selectAvailableManifest(indexDescriptor common.OciDescriptor) (common.OciDescriptor, error) {
+	var index common.OciManifest
+	if err := readJsonFile(p.blobPath(indexDescriptor.Digest), &index); err != nil {
+		return common.OciDescriptor{}, err
+	}
+	var available []common.OciDescriptor
+	for _, descriptor := range index.Manifests {
+		if _, err := os.Stat(p.blobPath(descriptor.Digest)); err == nil {
+			available = append(available, descriptor)
+		}
+	}
+	if len(available) == len(index.Manifests) {
+		return indexDescriptor, nil
+	}
+	if len(available) == 0 {
+		return common.OciDescriptor{}, fmt.Errorf("image archive contains no manifests of index %s", indexDescriptor.Digest)
+	}
+	log.Printf("image archive contains %d of %d manifests of index %s, pushing manifest %s\n", len(available), len(index.Manifests), indexDescriptor.Digest, available[0].Digest)
+	return available[0], nil
+}
+
+// buildDockerArchiveManifest собирает OCI манифест для архива `docker save` без index.json.
+// Слои такого архива не сжаты, их digest совпадает с diff_id из конфигурации образа
+func (p *imagePusher) buildDockerArchiveManifest() (common.OciDescriptor, error) {
+	var dockerManifests []common.DockerArchiveManifest
+	if err := readJsonFile(filepath.Join(p.dir, common.DockerManifestFileName), &dockerManifests); err != nil {
+		return common.OciDescriptor{}, err
+	}
+	if len(dockerManifests) == 0 {
+		return common.OciDescriptor{}, fmt.Errorf("%s contains no images", common.DockerManifestFileName)
+	}
+	dockerManifest := dockerManifests[0]
+	config, err := p.importBlob(dockerManifest.Config, common.MediaTypeOciConfig)
+	if err != nil {
+		return common.OciDescriptor{}, err
+	}
+	manifest := common.OciManifest{SchemaVersion: 2, MediaType: common.MediaTypeOciManifest, Config: &config, Layers: []common.OciDescriptor{}}
+	for _, layerPath := range dockerManifest.Layers {
+		mediaType := common.MediaTypeOciLayer
+		if gzipped, err := isGzipFile(filepath.Join(p.dir, filepath.FromSlash(layerPath))); err != nil {
+			return common.OciDescriptor{}, err
+		} else if gzipped {
+			mediaType += "+gzip"
+		}
+		layer, err := p.importBlob(layerPath, mediaType)
+		if err != nil {
+			return common.OciDescriptor{}, err
+		}
+		manifest.Layers = append(manifest.Layers, layer)
+	}
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		return common.OciDescriptor{}, err
+	}
+	descriptor := common.OciDescriptor{MediaType: common.MediaTypeOciManifest, Digest: fmt.Sprintf("sha256:%x", sha256.Sum256(content)), Size: int64(len(content))}
+	if err := os.MkdirAll(filepath.Dir(p.blobPath(descriptor.Digest)), 0755); err != nil {
+		return common.OciDescriptor{}, err
+	}
+	return descriptor, os.WriteFile(p.blobPath(descriptor.Digest), content, 0644)
+}
+
+// importBlob считает digest файла архива и кладёт его в blobs/sha256, как в OCI layout
+func (p *imagePusher) importBlob(archivePath string, mediaType string) (common.OciDescriptor, error) {
+	path := filepath.Join(p.dir, filepath.FromSlash(archivePath))
+	info, err := os.Stat(path)
+	if err != nil {
+		return common.OciDescriptor{}, err
+	}
+	hash, err := calculateFileHash(path, sha256.New())
+	if err != nil {
+		return common.OciDescriptor{}, err
+	}
+	descriptor := common.OciDescriptor{MediaType: mediaType, Digest: "sha256:" + hash, Size: info.Size()}
+	blobPath := p.blobPath(descriptor.Digest)
+	if _, err := os.Stat(blobPath); err == nil {
+		return descriptor, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0755); err != nil {
+		return common.OciDescriptor{}, err
+	}
+	return descriptor, os.Symlink(path, blobPath)
+}
+
+// push загружает манифест со всеми блобами, на которые он ссылается, и возвращает его digest
+func (p *imagePusher) push(descriptor common.OciDescriptor, reference string) (string, error) {
+	content, err := os.ReadFile(p.blobPath(descriptor.Digest))
+	if err != nil {
+		return "", err
+	}
+	var manifest common.OciManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return "", err
+	}
+	if common.IsImageIndex(descriptor.MediaType) {
+		for _, child := range manifest.Manifests {
+			if _, err := p.push(child, child.Digest); err != nil {
+				return "", err
+			}
+		}
+	} else {
+		if manifest.Config == nil {
+			return "", fmt.Errorf("manifest %s has no config", descriptor.Digest)
+		}
+		for _, blob := range append([]common.OciDescriptor{*manifest.Config}, manifest.Layers...) {
+			if err := p.pushBlob(blob); err != nil {
+				return "", err
+			}
+		}
+	}
+	return p.client.PutManifest(p.ctx, p.ref.Repository, reference, descriptor.MediaType, content)
+}
+
+// pushBlob загружает блоб, если его ещё нет в репозитории
+func (p *imagePusher) pushBlob(blob common.OciDescriptor) error {
+	exists, err := p.client.BlobExists(p.ctx, p.ref.Repository, blob.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		log.Printf("blob %s of image %s already exists\n", blob.Digest, p.ref.String())
+		p.pushed = append(p.pushed, blob.Digest)
+		return nil
+	}
+	if external, found := p.external[blob.Digest]; found {
+		if _, err := os.Stat(p.blobPath(blob.Digest)); errors.Is(err, os.ErrNotExist) {
+			return p.mountBlob(external)
+		}
+	}
+	err = p.client.PutBlob(p.ctx, p.ref.Repository, blob.Digest, blob.Size, func() (io.ReadCloser, error) {
+		return os.Open(p.blobPath(blob.Digest))
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("pushed blob %s (%d bytes) of image %s\n", blob.Digest, blob.Size, p.ref.String())
+	p.pushed = append(p.pushed, blob.Digest)
+	return nil
+}
+
+// mountBlob подключает слой, не записанный в архив, из репозитория, указанного SEND по списку блобов
+func (p *imagePusher) mountBlob(blob common.ExternalBlob) error {
+	mounted, err := p.client.MountBlob(p.ctx, p.ref.Repository, blob.Digest, blob.Repository)
+	if err != nil {
+		return err
+	}
+	if !mounted {
+		// слоя больше нет в registry: убираем его из списка, а SEND по коду ошибки отправит образ заново со всеми слоями
+		forgetDockerBlob(blob.Digest)
+		return fmt.Errorf("%w: layer %s of image %s is not in the archive and can't be mounted from repository %s", common.ErrDockerLayerMissing, blob.Digest, p.ref.String(), blob.Repository)
+	}
+	log.Printf("mounted blob %s (%d bytes) of image %s from %s\n", blob.Digest, blob.Size, p.ref.String(), blob.Repository)
+	p.pushed = append(p.pushed, blob.Digest)
+	return nil
+}
+
+func (p *imagePusher) blobPath(digest string) string {
+	return filepath.Join(p.dir, filepath.FromSlash(common.OciBlobPath(digest)))
+}
+
+func readJsonFile(path string, value interface{}) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, value)
+}
+
+func isGzipFile(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	magic, err := bufio.NewReader(file).Peek(2)
+	if errors.Is(err, io.EOF) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return magic[0] == 0x1f && magic[1] == 0x8b, nil
+}
@@ -0,0 +1,104 @@
+package deploy
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	content  string
+}
+
+func buildTar(t *testing.T, entries []tarEntry) *bytes.Buffer {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := tar.NewWriter(&buffer)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Typeflag: entry.typeflag, Linkname: entry.linkname, Mode: 0644, Size: int64(len(entry.content))}
+		if entry.typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if entry.typeflag == tar.TypeReg {
+			if _, err := writer.Write([]byte(entry.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buffer
+}
+
+func TestExtractImageArchiveRejectsMaliciousEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+	}{
+		{"parent path", []tarEntry{{name: "../passwd", typeflag: tar.TypeReg, content: "x"}}},
+		{"nested parent path", []tarEntry{{name: "blobs/../../passwd", typeflag: tar.TypeReg, content: "x"}}},
+		{"absolute path", []tarEntry{{name: "/passwd", typeflag: tar.TypeReg, content: "x"}}},
+		{"absolute link", []tarEntry{
+			{name: "blobs/evil", typeflag: tar.TypeSymlink, linkname: "/etc"},
+			{name: "blobs/evil/passwd", typeflag: tar.TypeReg, content: "x"},
+		}},
+		{"link to parent", []tarEntry{
+			{name: "blobs/evil", typeflag: tar.TypeSymlink, linkname: "../.."},
+			{name: "blobs/evil/passwd", typeflag: tar.TypeReg, content: "x"},
+		}},
+		{"chained links", []tarEntry{
+			{name: "x/y", typeflag: tar.TypeSymlink, linkname: ".."},
+			{name: "x/y/z", typeflag: tar.TypeSymlink, linkname: ".."},
+			{name: "x/y/z/passwd", typeflag: tar.TypeReg, content: "x"},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			dir := filepath.Join(root, "image")
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			err := extractImageArchive(buildTar(t, test.entries), dir)
+			if _, statErr := os.Stat(filepath.Join(root, "passwd")); statErr == nil {
+				t.Fatalf("archive wrote file outside of %s", dir)
+			}
+			if err == nil {
+				t.Fatal("expected error for malicious archive")
+			}
+		})
+	}
+}
+
+func TestExtractImageArchiveLinksLayers(t *testing.T) {
+	dir := t.TempDir()
+	archive := buildTar(t, []tarEntry{
+		{name: "manifest.json", typeflag: tar.TypeReg, content: "[]"},
+		{name: "b/layer.tar", typeflag: tar.TypeSymlink, linkname: "../a/layer.tar"},
+		{name: "a/", typeflag: tar.TypeDir},
+		{name: "a/layer.tar", typeflag: tar.TypeReg, content: "layer"},
+	})
+	if err := extractImageArchive(archive, dir); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(filepath.Join(dir, "b", "layer.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		t.Fatal("link must not be extracted as a symlink")
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "b", "layer.tar"))
+	if err != nil || string(content) != "layer" {
+		t.Fatalf("linked layer content = %q, %v", content, err)
+	}
+}
@@ -0,0 +1,149 @@
+package deploy
+
+import (
+	"fmt"
+	"fts-cd-file-utility/common"
+	"github.com/hirochachacha/go-smb2"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// smbUploadGoModule распаковывает архив go модуля с шары, сверяет h1: хеш zip архива
+// и раскладывает .info, .mod, .zip и @v/list в raw-hosted репозитории так, как их ожидает GOPROXY.
+// Возвращает url zip архива
+func smbUploadGoModule(bundleFilePath string, artifact common.GoModuleArtifact, fs *smb2.Share, checksum *checksumVerifier) (string, error) {
+	bundleFile, err := fs.OpenFile(bundleFilePath, os.O_RDONLY, 0644)
+	if err != nil {
+		log.Println("failed to open file", bundleFilePath, err)
+		return "", err
+	}
+	defer bundleFile.Close()
+
+	tempDir, err := os.MkdirTemp("", "gomod_")
+	if err != nil {
+		log.Println("failed to create temp dir", err)
+		return "", err
+	}
+	defer os.RemoveAll(tempDir)
+
+	bundleReader := checksum.Wrap(bundleFile)
+	fileNames, err := extractTar(bundleReader, tempDir)
+	if err != nil {
+		log.Printf("failed to extract go module bundle %s: %v\n", bundleFilePath, err)
+		return "", err
+	}
+	if _, err := io.Copy(io.Discard, bundleReader); err != nil {
+		return "", err
+	}
+	if err := checksum.Verify(); err != nil {
+		log.Printf("go module bundle %s is corrupted: %v\n", bundleFilePath, err)
+		return "", err
+	}
+
+	// версия берётся из архива, в задании может быть latest. Файлы архива называются закодированной версией
+	var escapedVersion string
+	for _, fileName := range fileNames {
+		if strings.HasSuffix(fileName, ".zip") {
+			escapedVersion = strings.TrimSuffix(fileName, ".zip")
+		}
+	}
+	if escapedVersion == "" {
+		return "", fmt.Errorf("go module bundle %s doesn't contain zip archive", bundleFilePath)
+	}
+	version, err := common.UnescapeGoModuleVersion(escapedVersion)
+	if err != nil {
+		return "", err
+	}
+	if err := verifyGoModuleZip(tempDir, artifact.ModulePath, version, escapedVersion); err != nil {
+		log.Printf("go module %s@%s is corrupted: %v\n", artifact.ModulePath, version, err)
+		return "", err
+	}
+
+	escapedPath, err := common.EscapeGoModulePath(artifact.ModulePath)
+	if err != nil {
+		return "", err
+	}
+	if err := writeGoModuleList(tempDir, escapedPath, version); err != nil {
+		return "", err
+	}
+
+	repository := common.StartupConfig.ReceiveNexusGoRepository
+	fields := []componentField{{Name: "raw.directory", Value: "/" + escapedPath + "/@v"}}
+	for i, fileName := range []string{escapedVersion + ".info", escapedVersion + ".mod", escapedVersion + ".zip", "list"} {
+		asset := "raw.asset" + strconv.Itoa(i+1)
+		fields = append(fields,
+			componentField{Name: asset, FilePath: filepath.Join(tempDir, fileName)},
+			componentField{Name: asset + ".filename", Value: fileName})
+	}
+	if err := uploadNexusComponent(repository, fields); err != nil {
+		return "", err
+	}
+
+	location := buildNexusRepoName(repository) + escapedPath + "/@v/" + escapedVersion + ".zip"
+	log.Printf("go module %s@%s uploaded successfully to %s\n", artifact.ModulePath, version, location)
+	return location, nil
+}
+
+// verifyGoModuleZip сверяет h1: хеш zip архива с .ziphash, посчитанным SEND
+func verifyGoModuleZip(dir, modulePath, version, escapedVersion string) error {
+	zipPath := filepath.Join(dir, escapedVersion+".zip")
+	if err := common.CheckGoModuleZip(zipPath, modulePath, version); err != nil {
+		return err
+	}
+	expected, err := os.ReadFile(filepath.Join(dir, escapedVersion+".ziphash"))
+	if err != nil {
+		return err
+	}
+	actual, err := common.GoModuleZipHash(zipPath)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(expected)) != actual {
+		return fmt.Errorf("%w: expected %s, got %s", common.ErrChecksumMismatch, strings.TrimSpace(string(expected)), actual)
+	}
+	return nil
+}
+
+// writeGoModuleList дополняет @v/list из репозитория RECEIVE версией version и пишет его в dir
+func writeGoModuleList(dir, escapedPath, version string) error {
+	listUrl := buildNexusRepoName(common.StartupConfig.ReceiveNexusGoRepository) + escapedPath + "/@v/list"
+	req, err := http.NewRequest(http.MethodGet, listUrl, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(common.StartupConfig.ReceiveNexusLogin, common.StartupConfig.ReceiveNexusPassword)
+	resp, err := common.HttpClient.Do(req)
+	if err != nil {
+		log.Println("failed to get version list", listUrl, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	var versions []string
+	switch resp.StatusCode {
+	case http.StatusOK:
+		content, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		versions = strings.Fields(string(content))
+	case http.StatusNotFound:
+	default:
+		return &common.HttpStatusError{Url: listUrl, StatusCode: resp.StatusCode}
+	}
+	found := false
+	for _, listedVersion := range versions {
+		if listedVersion == version {
+			found = true
+		}
+	}
+	if !found {
+		versions = append(versions, version)
+	}
+	return os.WriteFile(filepath.Join(dir, "list"), []byte(strings.Join(versions, "\n")+"\n"), 0644)
+}
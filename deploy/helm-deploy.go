@@ -0,0 +1,136 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"fts-cd-file-utility/cfg"
+	"fts-cd-file-utility/common"
+	"github.com/docker/docker/client"
+	"github.com/hirochachacha/go-smb2"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// smbUploadHelmChart распаковывает архив helm чарта с шары, пушит его образы в registry RECEIVE
+// и загружает чарт в helm-hosted репозиторий. Образы пушатся первыми, чтобы чарт не ссылался на отсутствующие образы.
+// Возвращает url чарта
+func smbUploadHelmChart(bundleFilePath string, artifact common.HelmArtifact, fs *smb2.Share, checksum *checksumVerifier) (string, error) {
+	bundleFile, err := fs.OpenFile(bundleFilePath, os.O_RDONLY, 0644)
+	if err != nil {
+		log.Println("failed to open file", bundleFilePath, err)
+		return "", err
+	}
+	defer bundleFile.Close()
+
+	tempDir, err := os.MkdirTemp("", "helm_")
+	if err != nil {
+		log.Println("failed to create temp dir", err)
+		return "", err
+	}
+	defer os.RemoveAll(tempDir)
+
+	bundleReader := checksum.Wrap(bundleFile)
+	if _, err := extractTar(bundleReader, tempDir); err != nil {
+		log.Printf("failed to extract helm bundle %s: %v\n", bundleFilePath, err)
+		return "", err
+	}
+	if _, err := io.Copy(io.Discard, bundleReader); err != nil {
+		return "", err
+	}
+	if err := checksum.Verify(); err != nil {
+		log.Printf("helm bundle %s is corrupted: %v\n", bundleFilePath, err)
+		return "", err
+	}
+
+	manifestContent, err := os.ReadFile(filepath.Join(tempDir, common.HelmBundleManifestName))
+	if err != nil {
+		log.Printf("helm bundle %s doesn't contain %s\n", bundleFilePath, common.HelmBundleManifestName)
+		return "", err
+	}
+	var manifest common.HelmBundleManifest
+	if err := json.Unmarshal(manifestContent, &manifest); err != nil {
+		log.Println("failed to read helm bundle manifest", err)
+		return "", err
+	}
+
+	if len(manifest.Images) > 0 {
+		if !common.StartupConfig.ReceiveDockerEnabled {
+			return "", fmt.Errorf("chart %s contains images, but property `receive_docker_enabled` set to false", artifact.GetOriginalResourceName())
+		}
+		if err := loadHelmImages(tempDir, manifest.Images); err != nil {
+			return "", err
+		}
+	}
+
+	err = uploadNexusComponent(common.StartupConfig.ReceiveNexusHelmRepository, []componentField{
+		{Name: "helm.asset", FilePath: filepath.Join(tempDir, manifest.Chart)},
+	})
+	if err != nil {
+		return "", err
+	}
+	location := buildNexusRepoName(common.StartupConfig.ReceiveNexusHelmRepository) + manifest.Chart
+	log.Printf("helm chart %s uploaded successfully to %s\n", artifact.GetOriginalResourceName(), location)
+	return location, nil
+}
+
+// loadHelmImages загружает образы чарта в docker, тегирует и пушит их так же, как образы DOCKER
+func loadHelmImages(dir string, images []common.HelmBundleImage) error {
+	if common.StartupConfig.ReceiveDockerTransport == cfg.RegistryDockerTransport {
+		for _, bundleImage := range images {
+			digest, err := pushImageArchiveFile(filepath.Join(dir, filepath.Base(bundleImage.File)), bundleImage.Image)
+			if err != nil {
+				return err
+			}
+			log.Printf("image %s of helm chart pushed with digest %s\n", bundleImage.Image, digest)
+		}
+		return nil
+	}
+	apiClient, err := client.NewClientWithOpts(client.WithVersion(common.DockerApiVersion))
+	if err != nil {
+		log.Println("failed to open docker api client", err)
+		return err
+	}
+	defer apiClient.Close()
+
+	for _, bundleImage := range images {
+		dockerArtifact := common.DockerArtifact{ImageName: bundleImage.Image}
+		if err := loadImageFile(apiClient, filepath.Join(dir, filepath.Base(bundleImage.File))); err != nil {
+			return err
+		}
+		receiveTag, digest, err := tagAndPushImage(apiClient, dockerArtifact)
+		if err != nil {
+			return err
+		}
+		log.Printf("image %s of helm chart pushed with digest %s\n", receiveTag, digest)
+		if err := dockerArtifact.DeployCleanup(); err != nil {
+			log.Printf("failed to remove image %s. Error: %v\n", receiveTag, err)
+		}
+	}
+	return nil
+}
+
+func loadImageFile(apiClient *client.Client, imageFilePath string) error {
+	log.Println("starting to load image", imageFilePath)
+	imageFile, err := os.Open(imageFilePath)
+	if err != nil {
+		log.Println("failed to open image", imageFilePath, err)
+		return err
+	}
+	defer imageFile.Close()
+	load, err := apiClient.ImageLoad(context.Background(), imageFile, false)
+	if err != nil {
+		log.Println("failed to load image", imageFilePath, err)
+		return err
+	}
+	defer load.Body.Close()
+	body, err := io.ReadAll(load.Body)
+	if err != nil {
+		log.Println("failed to read loadResponse!", err)
+		return err
+	}
+	log.Println(string(body))
+	return nil
+}
@@ -0,0 +1,157 @@
+package deploy
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"fts-cd-file-utility/common"
+	"github.com/hirochachacha/go-smb2"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// smbUploadHfBundle читает архив модели с шары и загружает каждый файл в hf репозиторий в ту же раскладку,
+// что и на стороне SEND: <model>/<path> или [datasets/|spaces/]<repo>/resolve/<revision>/<path>.
+// Перед загрузкой файл сверяется с размером и sha256 из hf-model.json. Возвращает url каталога файлов
+func smbUploadHfBundle(bundleFilePath string, artifact common.HfArtifact, fs *smb2.Share, checksum *checksumVerifier) (string, error) {
+	bundleFile, err := fs.OpenFile(bundleFilePath, os.O_RDONLY, 0644)
+	if err != nil {
+		log.Println("failed to open file", bundleFilePath, err)
+		return "", err
+	}
+	defer bundleFile.Close()
+
+	bundleReader := checksum.Wrap(bundleFile)
+	tarReader := tar.NewReader(bundleReader)
+	header, err := tarReader.Next()
+	if err != nil || header.Name != common.HfBundleManifestName {
+		return "", fmt.Errorf("model bundle %s doesn't start with %s", bundleFilePath, common.HfBundleManifestName)
+	}
+	var manifest common.HfModelManifest
+	if err := json.NewDecoder(tarReader).Decode(&manifest); err != nil {
+		return "", err
+	}
+	files := map[string]common.HfModelFile{}
+	for _, file := range manifest.Files {
+		files[file.Path] = file
+	}
+
+	modelUrl := buildNexusHfRepoName() + escapeUrlPath(manifest.RepoPath()) + "/"
+	uploaded := 0
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("failed to read model bundle %s: %v\n", bundleFilePath, err)
+			return "", err
+		}
+		file, found := files[header.Name]
+		if !found {
+			return "", fmt.Errorf("file %s is not listed in %s", header.Name, common.HfBundleManifestName)
+		}
+		if err := uploadHfModelFile(tarReader, file, modelUrl+escapeUrlPath(file.Path)); err != nil {
+			return "", err
+		}
+		uploaded++
+	}
+	if _, err := io.Copy(io.Discard, bundleReader); err != nil {
+		return "", err
+	}
+	if err := checksum.Verify(); err != nil {
+		log.Printf("model bundle %s is corrupted: %v\n", bundleFilePath, err)
+		return "", err
+	}
+	if uploaded != len(manifest.Files) {
+		return "", fmt.Errorf("model bundle %s contains %d of %d files", bundleFilePath, uploaded, len(manifest.Files))
+	}
+	log.Printf("model %s: %d files uploaded to %s\n", artifact.GetOriginalResourceName(), uploaded, modelUrl)
+	return modelUrl, nil
+}
+
+// uploadHfModelFile сохраняет файл из архива во временный файл, сверяет его размер и sha256 и загружает в Nexus
+func uploadHfModelFile(reader io.Reader, file common.HfModelFile, uploadUrl string) error {
+	tempFile, err := os.CreateTemp("", "hf_")
+	if err != nil {
+		log.Println("failed to create temp file", err)
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tempFile, hash), reader)
+	tempFile.Close()
+	if err != nil {
+		log.Printf("failed to extract %s: %v\n", file.Path, err)
+		return err
+	}
+	if size != file.Size {
+		return fmt.Errorf("%w: %s expected %d bytes, got %d", common.ErrChecksumMismatch, file.Path, file.Size, size)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); file.Sha256 != "" && actual != file.Sha256 {
+		return fmt.Errorf("%w: %s expected %s, got %s", common.ErrChecksumMismatch, file.Path, file.Sha256, actual)
+	}
+	if err := putNexusFile(uploadUrl, tempFile.Name()); err != nil {
+		return err
+	}
+	log.Printf("File %s uploaded successfully to %s\n", file.Path, uploadUrl)
+	return nil
+}
+
+// putNexusFile загружает файл в raw репозиторий Nexus запросом PUT
+func putNexusFile(uploadUrl, filePath string) error {
+	uploadFile, err := os.Open(filePath)
+	if err != nil {
+		log.Println("failed to open file for upload", filePath, err)
+		return err
+	}
+	defer uploadFile.Close()
+
+	info, err := uploadFile.Stat()
+	if err != nil {
+		log.Println("failed to get file info", filePath, err)
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, uploadUrl, uploadFile)
+	if err != nil {
+		log.Println("failed to create request", err)
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.SetBasicAuth(common.StartupConfig.ReceiveNexusLogin, common.StartupConfig.ReceiveNexusPassword)
+
+	resp, err := common.HttpClient.Do(req)
+	if err != nil {
+		log.Println("upload request failed", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Println("failed to read response", err)
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("upload failed with status %d: %s\n", resp.StatusCode, string(respBody))
+		return &common.HttpStatusError{Url: uploadUrl, StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// escapeUrlPath экранирует каждый сегмент пути, сохраняя '/'
+func escapeUrlPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
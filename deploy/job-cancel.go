@@ -0,0 +1,86 @@
+package deploy
+
+import (
+	"fmt"
+	"fts-cd-file-utility/common"
+	"github.com/hirochachacha/go-smb2"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"time"
+)
+
+// CancelJobHandler кладёт на шару маркер отмены задания.
+// Цикл загрузки артефактов удалит задание вместо его обработки
+func CancelJobHandler(c echo.Context) error {
+	jobId := c.Param("jobId")
+	u, err := url.Parse(common.StartupConfig.NFSPath)
+	if err != nil {
+		log.Printf("failed to parse NFSPath property %s. It is not valid url\n", common.StartupConfig.NFSPath)
+		return err
+	}
+	fs, closeShare, err := openSmbShare(*u)
+	if err != nil {
+		return c.JSONPretty(http.StatusServiceUnavailable, map[string]interface{}{
+			"success":      false,
+			"errorMessage": fmt.Sprintf("failed to connect to share: %v", err),
+		}, "  ")
+	}
+	defer closeShare()
+
+	jobFilePath := filepath.Join(common.StartupConfig.SmbSharePath, common.GetJobMetaFileName(jobId))
+	if _, err := fs.Stat(jobFilePath); err != nil {
+		return c.JSONPretty(http.StatusNotFound, map[string]interface{}{
+			"success":      false,
+			"errorMessage": fmt.Sprintf("job %s not found on share", jobId),
+		}, "  ")
+	}
+	markerPath := filepath.Join(common.StartupConfig.SmbSharePath, common.GetJobCancelFileName(jobId))
+	if err := fs.WriteFile(markerPath, []byte(time.Now().Format(time.RFC3339)), 0644); err != nil {
+		log.Println("failed to write cancel marker", markerPath, err)
+		return c.JSONPretty(http.StatusInternalServerError, map[string]interface{}{
+			"success":      false,
+			"errorMessage": fmt.Sprintf("failed to write cancel marker: %v", err),
+		}, "  ")
+	}
+	log.Printf("Job - %s: cancellation requested\n", jobId)
+	return c.JSONPretty(http.StatusAccepted, map[string]interface{}{
+		"success": true,
+		"jobId":   jobId,
+	}, "  ")
+}
+
+func isJobCancelled(fs *smb2.Share, jobId string) bool {
+	_, err := fs.Stat(filepath.Join(common.StartupConfig.SmbSharePath, common.GetJobCancelFileName(jobId)))
+	return err == nil
+}
+
+// dropCancelledJob подтверждает отмену и удаляет с шары артефакт, фрагменты, .job файл и маркер отмены.
+// Как и в dropFailedJob, без записанного подтверждения задание остаётся на шаре до следующего опроса
+func dropCancelledJob(fs *smb2.Share, jobId string, jobStatus *common.JobStatus) {
+	ack := common.DeployAck{JobId: jobId, Result: common.CANCELLED, Checksum: jobStatus.SHA256Hash, Attempts: jobStatus.Attempts, Dttm: time.Now()}
+	if writeDeployAck(fs, ack) != nil {
+		return
+	}
+	log.Printf("Job - %s: cancelled, removing it from share\n", jobId)
+	removeJobFromShare(fs, jobId, jobStatus)
+}
+
+// removeJobFromShare удаляет с шары .job файл задания, его артефакт и фрагменты
+func removeJobFromShare(fs *smb2.Share, jobId string, jobStatus *common.JobStatus) {
+	sharePath := common.StartupConfig.SmbSharePath
+	leftovers := []string{filepath.Join(sharePath, "chunks_"+jobId)}
+	if jobStatus.ArtifactPath != "" {
+		leftovers = append(leftovers, filepath.Join(sharePath, jobStatus.ArtifactPath))
+	}
+	leftovers = append(leftovers,
+		filepath.Join(sharePath, common.GetJobMetaFileName(jobId)),
+		filepath.Join(sharePath, common.GetJobCancelFileName(jobId)))
+	for _, leftover := range leftovers {
+		if err := fs.RemoveAll(leftover); err != nil {
+			log.Printf("Job - %s: failed to remove %s: %v\n", jobId, leftover, err)
+		}
+	}
+}
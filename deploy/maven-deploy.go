@@ -0,0 +1,164 @@
+package deploy
+
+import (
+	"archive/tar"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"fts-cd-file-utility/common"
+	"github.com/hirochachacha/go-smb2"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// smbUploadMavenArtifact распаковывает архив maven артефакта с шары, сверяет файлы с их контрольными суммами
+// и загружает основной файл и POM в maven-hosted репозиторий. Возвращает url основного файла
+func smbUploadMavenArtifact(bundleFilePath string, artifact common.MavenArtifact, fs *smb2.Share, checksum *checksumVerifier) (string, error) {
+	bundleFile, err := fs.OpenFile(bundleFilePath, os.O_RDONLY, 0644)
+	if err != nil {
+		log.Println("failed to open file", bundleFilePath, err)
+		return "", err
+	}
+	defer bundleFile.Close()
+
+	tempDir, err := os.MkdirTemp("", "maven_")
+	if err != nil {
+		log.Println("failed to create temp dir", err)
+		return "", err
+	}
+	defer os.RemoveAll(tempDir)
+
+	bundleReader := checksum.Wrap(bundleFile)
+	fileNames, err := extractTar(bundleReader, tempDir)
+	if err != nil {
+		log.Printf("failed to extract maven bundle %s: %v\n", bundleFilePath, err)
+		return "", err
+	}
+	if _, err := io.Copy(io.Discard, bundleReader); err != nil {
+		return "", err
+	}
+	if err := checksum.Verify(); err != nil {
+		log.Printf("maven bundle %s is corrupted: %v\n", bundleFilePath, err)
+		return "", err
+	}
+
+	var mainFileName, pomFileName string
+	for _, fileName := range fileNames {
+		if common.IsMavenChecksumFile(fileName) {
+			continue
+		}
+		if err := verifyMavenChecksums(tempDir, fileName); err != nil {
+			log.Printf("maven file %s is corrupted: %v\n", fileName, err)
+			return "", err
+		}
+		if strings.HasSuffix(fileName, ".pom") && artifact.GetExtension() != "pom" {
+			pomFileName = fileName
+		} else {
+			mainFileName = fileName
+		}
+	}
+	if mainFileName == "" {
+		return "", fmt.Errorf("maven bundle %s doesn't contain %s file", bundleFilePath, artifact.GetExtension())
+	}
+
+	fields := []componentField{
+		{Name: "maven2.groupId", Value: artifact.GroupId},
+		{Name: "maven2.artifactId", Value: artifact.ArtifactId},
+		{Name: "maven2.version", Value: artifact.Version},
+		{Name: "maven2.asset1", FilePath: filepath.Join(tempDir, mainFileName)},
+		{Name: "maven2.asset1.extension", Value: artifact.GetExtension()},
+	}
+	if artifact.Classifier != "" {
+		fields = append(fields, componentField{Name: "maven2.asset1.classifier", Value: artifact.Classifier})
+	}
+	if pomFileName != "" {
+		fields = append(fields,
+			componentField{Name: "maven2.generate-pom", Value: "false"},
+			componentField{Name: "maven2.asset2", FilePath: filepath.Join(tempDir, pomFileName)},
+			componentField{Name: "maven2.asset2.extension", Value: "pom"})
+	} else {
+		fields = append(fields, componentField{Name: "maven2.generate-pom", Value: "true"})
+	}
+	if err := uploadNexusComponent(common.StartupConfig.ReceiveNexusMavenRepository, fields); err != nil {
+		return "", err
+	}
+
+	location := fmt.Sprintf("%s%s/%s/%s/%s", buildNexusRepoName(common.StartupConfig.ReceiveNexusMavenRepository),
+		strings.ReplaceAll(artifact.GroupId, ".", "/"), artifact.ArtifactId, artifact.Version, mainFileName)
+	log.Printf("maven artifact %s uploaded successfully to %s\n", artifact.GetOriginalResourceName(), location)
+	return location, nil
+}
+
+// extractTar распаковывает tar архив в dir и возвращает имена файлов
+func extractTar(reader io.Reader, dir string) ([]string, error) {
+	var fileNames []string
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return fileNames, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		// в архиве только плоский список файлов, пути из архива не используются
+		fileName := filepath.Base(header.Name)
+		file, err := os.Create(filepath.Join(dir, fileName))
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(file, tarReader)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		fileNames = append(fileNames, fileName)
+	}
+}
+
+// verifyMavenChecksums сверяет файл с лежащими рядом .sha1, .md5, .sha256 и .sha512
+func verifyMavenChecksums(dir, fileName string) error {
+	hashes := map[string]func() hash.Hash{".sha1": sha1.New, ".md5": md5.New, ".sha256": sha256.New, ".sha512": sha512.New}
+	for _, checksumExtension := range common.MavenChecksumExtensions {
+		content, err := os.ReadFile(filepath.Join(dir, fileName+checksumExtension))
+		if err != nil {
+			continue
+		}
+		fields := strings.Fields(string(content))
+		if len(fields) == 0 {
+			continue
+		}
+		expected := strings.ToLower(fields[0])
+		actual, err := calculateFileHash(filepath.Join(dir, fileName), hashes[checksumExtension]())
+		if err != nil {
+			return err
+		}
+		if actual != expected {
+			return fmt.Errorf("%w: %s of %s expected %s, got %s", common.ErrChecksumMismatch, checksumExtension, fileName, expected, actual)
+		}
+	}
+	return nil
+}
+
+func calculateFileHash(filePath string, hasher hash.Hash) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,78 @@
+package deploy
+
+import (
+	"fmt"
+	"fts-cd-file-utility/common"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// componentField - поле формы components API Nexus: значение или файл
+type componentField struct {
+	Name     string
+	Value    string
+	FilePath string
+}
+
+// uploadNexusComponent загружает компонент в репозиторий Nexus на стороне RECEIVE
+// через POST /service/rest/v1/components. Файлы передаются потоком
+func uploadNexusComponent(repository string, fields []componentField) error {
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(writeComponentForm(form, fields))
+	}()
+
+	uploadUrl := fmt.Sprintf("%s/service/rest/v1/components?repository=%s", common.StartupConfig.ReceiveNexusUrl, repository)
+	req, err := http.NewRequest(http.MethodPost, uploadUrl, body)
+	if err != nil {
+		body.Close()
+		log.Println("failed to create request", err)
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.SetBasicAuth(common.StartupConfig.ReceiveNexusLogin, common.StartupConfig.ReceiveNexusPassword)
+
+	resp, err := common.HttpClient.Do(req)
+	if err != nil {
+		log.Println("upload request failed", err)
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("upload failed with status %d: %s\n", resp.StatusCode, string(respBody))
+		return &common.HttpStatusError{Url: uploadUrl, StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+func writeComponentForm(form *multipart.Writer, fields []componentField) error {
+	for _, field := range fields {
+		if field.FilePath == "" {
+			if err := form.WriteField(field.Name, field.Value); err != nil {
+				return err
+			}
+			continue
+		}
+		part, err := form.CreateFormFile(field.Name, filepath.Base(field.FilePath))
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(field.FilePath)
+		if err != nil {
+			log.Println("failed to open file for upload", field.FilePath, err)
+			return err
+		}
+		_, err = io.Copy(part, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return form.Close()
+}
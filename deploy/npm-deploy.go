@@ -0,0 +1,51 @@
+package deploy
+
+import (
+	"fmt"
+	"fts-cd-file-utility/common"
+	"github.com/hirochachacha/go-smb2"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// smbUploadNpmPackage загружает tarball npm пакета с шары в npm-hosted репозиторий
+// через components API Nexus и возвращает url загруженного tarball
+func smbUploadNpmPackage(npmFilePath, artifactFileName string, artifact common.NpmArtifact, fs *smb2.Share, checksum *checksumVerifier) (string, error) {
+	npmFromFile, err := fs.OpenFile(npmFilePath, os.O_RDONLY, 0644)
+	if err != nil {
+		log.Println("failed to open file", npmFilePath, err)
+		return "", err
+	}
+	defer npmFromFile.Close()
+
+	// tarball копируется локально, чтобы не загрузить в Nexus повреждённый пакет
+	npmTgtFile, err := os.Create(artifactFileName)
+	if err != nil {
+		log.Println("failed to create target file", artifactFileName, err)
+		return "", err
+	}
+	defer os.Remove(artifactFileName)
+	defer npmTgtFile.Close()
+	if _, err := io.Copy(npmTgtFile, checksum.Wrap(npmFromFile)); err != nil {
+		log.Println("failed to copy file from", npmFilePath, "to", artifactFileName, err)
+		return "", err
+	}
+	if err := checksum.Verify(); err != nil {
+		log.Printf("npm package %s is corrupted: %v\n", npmFilePath, err)
+		return "", err
+	}
+	npmTgtFile.Close()
+
+	err = uploadNexusComponent(common.StartupConfig.ReceiveNexusNpmRepository, []componentField{
+		{Name: "npm.asset", FilePath: artifactFileName},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	location := fmt.Sprintf("%s%s/-/%s", buildNexusRepoName(common.StartupConfig.ReceiveNexusNpmRepository), artifact.GetOriginalResourceName(), filepath.Base(artifactFileName))
+	log.Printf("npm package %s uploaded successfully to %s\n", artifact.GetOriginalResourceName(), location)
+	return location, nil
+}
@@ -0,0 +1,21 @@
+package deploy
+
+import (
+	"fts-cd-file-utility/common"
+	"github.com/hirochachacha/go-smb2"
+)
+
+// smbUploadNugetPackage загружает .nupkg пакет с шары в nuget-hosted репозиторий и возвращает url пакета
+func smbUploadNugetPackage(nupkgFilePath string, jobStatus *common.JobStatus, fs *smb2.Share, checksum *checksumVerifier) (string, error) {
+	repository := common.StartupConfig.ReceiveNexusNugetRepository
+	return smbUploadOsPackage(nupkgFilePath, repository, fs, checksum, func(localFilePath string) []componentField {
+		return []componentField{{Name: "nuget.asset", FilePath: localFilePath}}
+	}, func(fileName string) string {
+		name, version := jobStatus.Metadata[common.PackageMetaName], jobStatus.Metadata[common.PackageMetaVersion]
+		if name == "" || version == "" {
+			return buildNexusRepoName(repository) + fileName
+		}
+		// nuget-hosted отдаёт пакет по <id>/<version>
+		return buildNexusRepoName(repository) + name + "/" + version
+	})
+}
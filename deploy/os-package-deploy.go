@@ -0,0 +1,97 @@
+package deploy
+
+import (
+	"fts-cd-file-utility/common"
+	"github.com/hirochachacha/go-smb2"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// smbUploadAptPackage загружает .deb пакет с шары в apt-hosted репозиторий и возвращает url пакета
+func smbUploadAptPackage(debFilePath string, jobStatus *common.JobStatus, fs *smb2.Share, checksum *checksumVerifier) (string, error) {
+	repository := common.StartupConfig.ReceiveNexusAptRepository
+	return smbUploadOsPackage(debFilePath, repository, fs, checksum, func(localFilePath string) []componentField {
+		return []componentField{{Name: "apt.asset", FilePath: localFilePath}}
+	}, func(fileName string) string {
+		// apt-hosted раскладывает пакеты по pool/<первая буква>/<имя пакета>/
+		packageName := jobStatus.Metadata[common.PackageMetaName]
+		if packageName == "" {
+			packageName = strings.SplitN(fileName, "_", 2)[0]
+		}
+		return buildNexusRepoName(repository) + "pool/" + packageName[:1] + "/" + packageName + "/" + fileName
+	})
+}
+
+// smbUploadYumPackage загружает .rpm пакет с шары в yum-hosted репозиторий в тот же каталог, что и в исходном репозитории.
+// Возвращает url пакета
+func smbUploadYumPackage(rpmFilePath string, jobStatus *common.JobStatus, fs *smb2.Share, checksum *checksumVerifier) (string, error) {
+	repository := common.StartupConfig.ReceiveNexusYumRepository
+	directory := strings.Trim(path.Dir(jobStatus.Metadata[common.PackageMetaPath]), "/.")
+	return smbUploadOsPackage(rpmFilePath, repository, fs, checksum, func(localFilePath string) []componentField {
+		return []componentField{
+			{Name: "yum.directory", Value: "/" + directory},
+			{Name: "yum.asset", FilePath: localFilePath},
+			{Name: "yum.asset.filename", Value: filepath.Base(localFilePath)},
+		}
+	}, func(fileName string) string {
+		if directory == "" {
+			return buildNexusRepoName(repository) + fileName
+		}
+		return buildNexusRepoName(repository) + directory + "/" + fileName
+	})
+}
+
+// smbUploadOsPackage копирует пакет с шары локально, сверяет хеш-сумму и загружает его через components API Nexus
+func smbUploadOsPackage(packageFilePath, repository string, fs *smb2.Share, checksum *checksumVerifier,
+	buildFields func(localFilePath string) []componentField, buildLocation func(fileName string) string) (string, error) {
+	tempDir, err := os.MkdirTemp("", "package_")
+	if err != nil {
+		log.Println("failed to create temp dir", err)
+		return "", err
+	}
+	defer os.RemoveAll(tempDir)
+
+	localFilePath, err := copyVerifiedPackage(packageFilePath, tempDir, fs, checksum)
+	if err != nil {
+		return "", err
+	}
+	if err := uploadNexusComponent(repository, buildFields(localFilePath)); err != nil {
+		return "", err
+	}
+	fileName := filepath.Base(localFilePath)
+	location := buildLocation(fileName)
+	log.Printf("package %s uploaded successfully to %s\n", fileName, location)
+	return location, nil
+}
+
+// copyVerifiedPackage копирует пакет с шары в каталог dir и сверяет хеш-сумму,
+// чтобы не загрузить в Nexus повреждённый файл. Возвращает путь локальной копии
+func copyVerifiedPackage(packageFilePath, dir string, fs *smb2.Share, checksum *checksumVerifier) (string, error) {
+	packageFromFile, err := fs.OpenFile(packageFilePath, os.O_RDONLY, 0644)
+	if err != nil {
+		log.Println("failed to open file", packageFilePath, err)
+		return "", err
+	}
+	defer packageFromFile.Close()
+
+	localFilePath := filepath.Join(dir, filepath.Base(packageFilePath))
+	localFile, err := os.Create(localFilePath)
+	if err != nil {
+		log.Println("failed to create target file", localFilePath, err)
+		return "", err
+	}
+	defer localFile.Close()
+	if _, err := io.Copy(localFile, checksum.Wrap(packageFromFile)); err != nil {
+		log.Println("failed to copy file from", packageFilePath, "to", localFilePath, err)
+		return "", err
+	}
+	if err := checksum.Verify(); err != nil {
+		log.Printf("package %s is corrupted: %v\n", packageFilePath, err)
+		return "", err
+	}
+	return localFilePath, localFile.Close()
+}
@@ -0,0 +1,92 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"fts-cd-file-utility/common"
+	"github.com/hirochachacha/go-smb2"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// smbUploadPypiBundle распаковывает архив с пакетом и его зависимостями и загружает через twine
+// только те файлы, которых ещё нет в pypi репозитории RECEIVE
+func smbUploadPypiBundle(bundleFilePath string, artifact common.PypiArtifact, fs *smb2.Share, checksum *checksumVerifier) error {
+	bundleFile, err := fs.OpenFile(bundleFilePath, os.O_RDONLY, 0644)
+	if err != nil {
+		log.Println("failed to open file", bundleFilePath, err)
+		return err
+	}
+	defer bundleFile.Close()
+
+	tempDir, err := os.MkdirTemp("", "pypi_")
+	if err != nil {
+		log.Println("failed to create temp dir", err)
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	bundleReader := checksum.Wrap(bundleFile)
+	if _, err := extractTar(bundleReader, tempDir); err != nil {
+		log.Printf("failed to extract pypi bundle %s: %v\n", bundleFilePath, err)
+		return err
+	}
+	if _, err := io.Copy(io.Discard, bundleReader); err != nil {
+		return err
+	}
+	if err := checksum.Verify(); err != nil {
+		log.Printf("pypi bundle %s is corrupted: %v\n", bundleFilePath, err)
+		return err
+	}
+
+	content, err := os.ReadFile(filepath.Join(tempDir, common.PypiBundleManifestName))
+	if err != nil {
+		return fmt.Errorf("pypi bundle %s doesn't contain %s: %w", bundleFilePath, common.PypiBundleManifestName, err)
+	}
+	var manifest common.PypiBundleManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return err
+	}
+	if len(manifest.Unresolved) > 0 {
+		log.Printf("pypi bundle %s doesn't contain dependencies of %s\n", bundleFilePath, strings.Join(manifest.Unresolved, ", "))
+	}
+
+	var fileNames []string
+	for _, pkg := range manifest.Packages {
+		exists, err := pypiFileExists(pkg)
+		if err != nil {
+			return err
+		}
+		if exists {
+			log.Printf("package %s %s already exists in %s, skipping\n", pkg.Name, pkg.Version, buildNexusPypiRepoName())
+			continue
+		}
+		fileNames = append(fileNames, filepath.Join(tempDir, filepath.Base(pkg.File)))
+	}
+	if len(fileNames) == 0 {
+		log.Printf("all %d packages of %s are already present\n", len(manifest.Packages), artifact.PackageName)
+		return nil
+	}
+	log.Printf("uploading %d of %d packages of %s\n", len(fileNames), len(manifest.Packages), artifact.PackageName)
+	return twineUpload(fileNames...)
+}
+
+// pypiFileExists проверяет по simple index, есть ли файл пакета в pypi репозитории RECEIVE
+func pypiFileExists(pkg common.PypiBundlePackage) (bool, error) {
+	indexUrl := buildNexusPypiRepoName() + "simple/" + common.NormalizePypiName(pkg.Name) + "/"
+	distributions, err := common.FetchPypiSimpleIndex(context.Background(), indexUrl,
+		common.StartupConfig.ReceiveNexusLogin, common.StartupConfig.ReceiveNexusPassword)
+	if err != nil {
+		return false, err
+	}
+	for _, distribution := range distributions {
+		if distribution.FileName == filepath.Base(pkg.File) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,74 @@
+package deploy
+
+import (
+	"fts-cd-file-utility/common"
+	"github.com/hirochachacha/go-smb2"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// smbUploadRawFile загружает файл с шары в raw-hosted репозиторий через components API Nexus
+// и возвращает url загруженного файла
+func smbUploadRawFile(rawFilePath, artifactFileName string, artifact common.HttpArtifact, fs *smb2.Share, checksum *checksumVerifier) (string, error) {
+	rawFromFile, err := fs.OpenFile(rawFilePath, os.O_RDONLY, 0644)
+	if err != nil {
+		log.Println("failed to open file", rawFilePath, err)
+		return "", err
+	}
+	defer rawFromFile.Close()
+
+	tempDir, err := os.MkdirTemp("", "raw_")
+	if err != nil {
+		log.Println("failed to create temp dir", err)
+		return "", err
+	}
+	defer os.RemoveAll(tempDir)
+
+	// файл копируется локально, чтобы не загрузить в Nexus повреждённый файл
+	rawTgtFilePath := filepath.Join(tempDir, filepath.Base(artifactFileName))
+	rawTgtFile, err := os.Create(rawTgtFilePath)
+	if err != nil {
+		log.Println("failed to create target file", rawTgtFilePath, err)
+		return "", err
+	}
+	defer rawTgtFile.Close()
+	if _, err := io.Copy(rawTgtFile, checksum.Wrap(rawFromFile)); err != nil {
+		log.Println("failed to copy file from", rawFilePath, "to", rawTgtFilePath, err)
+		return "", err
+	}
+	if err := checksum.Verify(); err != nil {
+		log.Printf("raw file %s is corrupted: %v\n", rawFilePath, err)
+		return "", err
+	}
+	rawTgtFile.Close()
+
+	directory := getRawDirectory(artifact)
+	err = uploadNexusComponent(common.StartupConfig.ReceiveNexusRawRepository, []componentField{
+		{Name: "raw.directory", Value: "/" + directory},
+		{Name: "raw.asset1", FilePath: rawTgtFilePath},
+		{Name: "raw.asset1.filename", Value: filepath.Base(artifactFileName)},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	location := buildNexusRepoName(common.StartupConfig.ReceiveNexusRawRepository)
+	if directory != "" {
+		location += directory + "/"
+	}
+	location += filepath.Base(artifactFileName)
+	log.Printf("raw file %s uploaded successfully to %s\n", artifact.GetOriginalResourceName(), location)
+	return location, nil
+}
+
+// getRawDirectory возвращает каталог из задания или `receive_nexus_raw_directory` без ведущего и завершающего '/'
+func getRawDirectory(artifact common.HttpArtifact) string {
+	directory := artifact.Directory
+	if directory == "" {
+		directory = common.StartupConfig.ReceiveNexusRawDirectory
+	}
+	return strings.Trim(directory, "/")
+}
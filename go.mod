@@ -4,7 +4,9 @@ go 1.21
 
 require (
 	github.com/docker/docker v26.1.3+incompatible
+	github.com/hirochachacha/go-smb2 v1.1.0
 	github.com/labstack/echo/v4 v4.12.0
+	go.etcd.io/bbolt v1.3.10
 )
 
 require (
@@ -19,7 +21,6 @@ require (
 	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/golang-jwt/jwt v3.2.2+incompatible // indirect
-	github.com/hirochachacha/go-smb2 v1.1.0 // indirect
 	github.com/labstack/gommon v0.4.2 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
@@ -28,16 +28,6 @@ func main() {
 	}
 	//log.Println(initConfig)
 	setupConfig(*initConfig)
-	/*
-		jobFilePath := "D:\\tmp\\pypi\\20241028094027.job"
-		jobFile, err := os.Open(jobFilePath)
-		jobFileContent, err := io.ReadAll(jobFile)
-		if deploy.IsDockerArtifact(jobFileContent) {
-			log.Println("docker artifact upload job found")
-		} else if deploy.IsPypiArtifact(jobFileContent) {
-			log.Println("pypi artifact upload job found")
-
-		}*/
 	runApp()
 }
 
@@ -61,24 +51,48 @@ func runApp() {
 	e.GET("/", common.ReadConfig)
 
 	if common.StartupConfig.Mode == cfg.CdSendMode {
+		if err := deliver.InitJobStore(&common.StartupConfig); err != nil {
+			log.Fatalln("failed to open job store", err)
+		}
+		defer deliver.CloseJobStore()
+
 		e.GET("/cd-ping/:jobId", deliver.GetJobStatus)
 		e.GET("/cd-ping/latest", deliver.GetLatestJobStatus)
-		//e.POST("/cd-start/:jobId", deliver.StartFileCdHandler)
-		e.POST("/cd-pypi-start", deliver.StartPypiCdHandler)
-		e.POST("/cd-hf-start", deliver.StartHfCdHandler)
+		e.POST("/cd-start", deliver.StartFileCdHandler)
+		e.POST("/cd-start/:type", deliver.StartCdHandler)
+		e.POST("/cd-start/:type/:jobId", deliver.StartCdHandler)
+		// эндпоинты /cd-<name>-start строятся по реестру типов артефактов
+		for _, definition := range common.GetArtifactTypeDefinitions() {
+			if !definition.IsSendEnabled() {
+				continue
+			}
+			e.POST("/cd-"+definition.Name+"-start", deliver.NewStartCdHandler(definition))
+			e.POST("/cd-"+definition.Name+"-start/:jobId", deliver.NewStartCdHandler(definition))
+		}
+		e.GET("/cd-jobs", deliver.ListJobsHandler)
+		e.GET("/cd-jobs/:jobId/events", deliver.JobEventsHandler)
+		e.GET("/cd-jobs/:jobId/wait", deliver.WaitJobHandler)
+		e.DELETE("/cd-jobs/:jobId", deliver.CancelJobHandler)
 
 		if common.StartupConfig.SendDockerEnabled {
-			common.InitDockerClientApiVersion()
-			e.POST("/cd-docker-start/:jobId", deliver.StartDockerCdHandlerWithJobId)
-			e.POST("/cd-docker-start", deliver.StartDockerCdHandler)
+			if common.StartupConfig.SendDockerTransport == cfg.DaemonDockerTransport {
+				common.InitDockerClientApiVersion()
+			} else {
+				log.Println("docker images will be pulled from registry without docker daemon")
+			}
 		} else {
 			log.Println("docker artifacts won't be sent since property `send_docker_enabled` set to false")
 		}
-		// start goroutine that will move jobs from status DOWNLOADING_DONE to SUCCESS
+		// docker api version is known at this point, so resumed docker jobs can start
+		deliver.ResumeInterruptedJobs()
+		// start goroutine that will move jobs from status DOWNLOADING_DONE to status from RECEIVE deploy ack
 		go deliver.CheckDownloadingDoneJobs()
 
 		go deliver.DeleteStaleJobs()
 	} else if common.StartupConfig.Mode == cfg.CdReceiveMode {
+		if err := deploy.RegisterArtifactPublishers(); err != nil {
+			log.Fatalln("failed to register artifact publishers", err)
+		}
 		if common.StartupConfig.ReceivePypiEnabled {
 			if !common.IsTwineInstalled() {
 				log.Fatalln("Twine is not installed. Can't proceed\nInstall Twine or set `receive_pypi_enabled` property to true in receive-config.json")
@@ -88,11 +102,19 @@ func runApp() {
 		}
 
 		if common.StartupConfig.ReceiveDockerEnabled {
-			common.InitDockerClientApiVersion()
-			e.POST("/cd-docker-deploy/:jobId", deploy.StartDockerDeployHandler)
+			if common.StartupConfig.ReceiveDockerTransport == cfg.DaemonDockerTransport {
+				common.InitDockerClientApiVersion()
+				e.POST("/cd-docker-deploy/:jobId", deploy.StartDockerDeployHandler)
+			} else {
+				log.Println("docker images will be pushed to registry without docker daemon")
+			}
+			if common.StartupConfig.ReceiveDockerInventoryEnabled {
+				go deploy.PublishDockerBlobInventory(ctx, &common.StartupConfig)
+			}
 		} else {
 			log.Println("docker artifacts won't be processed since property `receive_docker_enabled` set to false")
 		}
+		e.DELETE("/cd-jobs/:jobId", deploy.CancelJobHandler)
 		go deploy.LoadArtifacts(ctx, &common.StartupConfig)
 	} else {
 		log.Fatalln("invalid mode set", common.StartupConfig.Mode)